@@ -8,119 +8,256 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"strconv"
+	"syscall"
 
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/cache"
+	"omnichannel_inventory/internal/config"
 	"omnichannel_inventory/internal/db"
 	"omnichannel_inventory/internal/events"
 	"omnichannel_inventory/internal/handlers"
+	"omnichannel_inventory/internal/health"
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/migrations"
+	"omnichannel_inventory/internal/ratelimit"
 	"omnichannel_inventory/internal/services"
+	"omnichannel_inventory/internal/tracing"
+	"omnichannel_inventory/internal/webhooks"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	// Configure logging
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.SetOutput(os.Stdout)
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("failed to load configuration", err)
+	}
 
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	// Structured logging; the standard library logger writes through it too
+	if _, err := logging.Setup(cfg.Logging, os.Stdout); err != nil {
+		fatal("failed to initialize logging", err)
 	}
+	slog.Info("configuration loaded", "config", cfg.String())
 
-	// Debug environment variables
-	webhookURL := os.Getenv("WEBHOOK_URL")
-	if webhookURL == "" {
-		log.Printf("WARNING: WEBHOOK_URL is not set in environment variables")
-	} else {
-		log.Printf("Webhook URL configured: %s", webhookURL)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	}
+
+	if cfg.Slack.WebhookURL == "" {
+		slog.Warn("SLACK_WEBHOOK_URL is not set, low stock alerts are disabled")
+	}
+
+	// Cancelled on SIGINT or SIGTERM to begin shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing, exported to OTLP or stdout when configured
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		fatal("failed to initialize tracing", err)
 	}
 
 	// Initialize database connections
-	if err := db.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	database, err := db.Connect(ctx, cfg.Database)
+	if err != nil {
+		fatal("failed to initialize database", err)
 	}
-	defer db.CloseDB()
 
-	if err := db.InitRedis(); err != nil {
-		log.Fatalf("Failed to initialize Redis: %v", err)
+	// Refuse to serve against an outdated schema
+	if err := migrations.Check(ctx, database); err != nil {
+		fatal("schema check failed", err)
 	}
-	defer db.CloseRedis()
 
-	// Debug environment variables
-	slackURL := os.Getenv("SLACK_WEBHOOK_URL")
-	if slackURL == "" {
-		log.Printf("WARNING: SLACK_WEBHOOK_URL is not set in environment variables")
-	} else {
-		log.Printf("Slack webhook URL configured: %s", slackURL)
+	redisClient, err := db.ConnectRedis(ctx, cfg.Redis)
+	if err != nil {
+		fatal("failed to initialize Redis", err)
 	}
 
 	// Initialize services
-	inventoryService := services.NewInventoryService(db.GetDB(), db.GetRedis())
+	inventoryService := services.NewInventoryService(database, redisClient)
+	inventoryService.SetLowStockThreshold(cfg.Inventory.LowStockThreshold)
+	if ttl := cfg.Cache.StockTTL.Duration(); ttl > 0 {
+		inventoryService.SetStockCache(cache.NewStock(redisClient, ttl, cfg.Cache.StockLockTimeout.Duration()))
+	}
 	handlers.SetInventoryService(inventoryService)
 
-	// Initialize event processor
-	processor := events.NewEventProcessor()
-	ctx := context.Background()
-	processor.Start(ctx)
-	defer processor.Stop()
+	// Background workers keep running until in-flight requests have drained
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Initialize event processor, delivering alerts through a webhook queue.
+	// The processor is stopped explicitly so that buffered events still run.
+	slack := webhooks.NewSlackNotifier(cfg.Slack, cfg.Inventory.LowStockThreshold)
+	notifier := webhooks.NewQueue(slack, webhooks.QueueSize)
+	processor := events.NewEventProcessor(database, notifier, cfg.Inventory.LowStockThreshold)
+	processor.Start(context.Background())
+	inventoryService.SetExpiryNotifier(notifier, cfg.Inventory.ExpiryAlertDays)
+	inventoryService.SetReplenishmentSettings(cfg.Replenishment.Settings())
+	inventoryService.SetReplenishmentNotifier(notifier)
+	rebalancingConstraints, err := cfg.Rebalancing.Constraints()
+	if err != nil {
+		fatal("invalid rebalancing configuration", err)
+	}
+	inventoryService.SetRebalancingConstraints(rebalancingConstraints)
+	inventoryService.SetValuationMethod(cfg.Inventory.ValuationMethod)
 
 	// Start event consumer
-	go events.StartInventoryEventConsumer(ctx, processor)
+	consumerDone := events.StartInventoryEventConsumer(workerCtx, redisClient, processor)
+
+	// Start periodic stock snapshots
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		inventoryService.RunSnapshotScheduler(workerCtx, cfg.Inventory.SnapshotInterval.Duration())
+	}()
+
+	// Start periodic near-expiry alerts for lots
+	expiryDone := make(chan struct{})
+	go func() {
+		defer close(expiryDone)
+		inventoryService.RunExpiryAlerts(workerCtx, cfg.Inventory.ExpiryCheckInterval.Duration())
+	}()
+
+	// Start the periodic replenishment report
+	replenishmentDone := make(chan struct{})
+	go func() {
+		defer close(replenishmentDone)
+		inventoryService.RunReplenishmentReports(workerCtx, cfg.Replenishment.ReportInterval.Duration())
+	}()
+
+	// Start the periodic rebalancing analysis
+	rebalancingDone := make(chan struct{})
+	go func() {
+		defer close(rebalancingDone)
+		inventoryService.RunRebalancingAnalysis(workerCtx, cfg.Rebalancing.Interval.Duration())
+	}()
 
 	// Create Gin router
-	router := gin.Default()
-
-	// Add logging middleware
-	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{
-		Formatter: func(param gin.LogFormatterParams) string {
-			return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-				param.ClientIP,
-				param.TimeStamp.Format(time.RFC1123),
-				param.Method,
-				param.Path,
-				param.Request.Proto,
-				param.StatusCode,
-				param.Latency,
-				param.Request.UserAgent(),
-				param.ErrorMessage,
-			)
-		},
-		Output: gin.DefaultWriter,
-	}))
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Trace each request, continuing any trace context from the caller
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+
+	// Record request counts and latency per route
+	router.Use(metrics.Middleware())
+
+	// Attach request ID and client address for the audit trail and logs
+	router.Use(handlers.RequestMetadata())
+
+	// Log each completed request with its request ID and trace
+	router.Use(logging.Middleware())
 
 	// Serve static files
 	router.Static("/static", "./static")
 	router.LoadHTMLGlob("static/*.html")
 
+	// Authentication
+	var authMiddleware gin.HandlerFunc
+	if cfg.Auth.Disabled {
+		slog.Warn("authentication is disabled, all requests are treated as admin")
+		authMiddleware = auth.Disabled()
+	} else {
+		authenticator, err := auth.NewAuthenticator(cfg.Auth.Authenticator())
+		if err != nil {
+			fatal("failed to initialize authentication", err)
+		}
+		authMiddleware = auth.Middleware(authenticator)
+	}
+
+	anyRole := auth.RequireRole(auth.RoleViewer, auth.RoleWarehouseOperator, auth.RoleChannelIntegration)
+	operator := auth.RequireRole(auth.RoleWarehouseOperator)
+	channel := auth.RequireRole(auth.RoleChannelIntegration)
+	admin := auth.RequireRole(auth.RoleAdmin)
+
+	// Rate limiting, shared across instances through Redis
+	rateLimitPolicy, err := cfg.RateLimit.Policy()
+	if err != nil {
+		fatal("invalid rate limit configuration", err)
+	}
+	rateLimitStore := ratelimit.NewFallbackStore(ratelimit.NewRedisStore(redisClient), ratelimit.NewMemoryStore())
+	limiter := ratelimit.NewLimiter(rateLimitStore, rateLimitPolicy)
+
 	// API routes
-	api := router.Group("/api")
+	api := router.Group("/api", authMiddleware, limiter.Middleware())
 	{
-		api.POST("/stock", handlers.AddOrUpdateStock)
-		api.GET("/stock/:sku", handlers.GetConsolidatedStock)
-		api.POST("/orders/simulate", handlers.SimulateOrder)
-		api.GET("/history/:sku", handlers.GetInventoryHistory)
+		api.POST("/stock", operator, handlers.AddOrUpdateStock)
+		api.GET("/stock", anyRole, handlers.ListStock)
+		api.GET("/stock/:sku", anyRole, handlers.GetConsolidatedStock)
+		api.GET("/stock/:sku/lots", anyRole, handlers.GetLots)
+		api.GET("/stock/:sku/bins", anyRole, handlers.GetBinStock)
+		api.GET("/stock/:sku/cost-layers", anyRole, handlers.GetCostLayers)
+		api.POST("/stock/put-away", operator, handlers.PutAway)
+		api.POST("/stock/bin-moves", operator, handlers.MoveBinStock)
+		api.GET("/warehouses/:id/locations", anyRole, handlers.ListLocations)
+		api.POST("/warehouses/:id/locations", admin, handlers.CreateLocation)
+		api.GET("/lots/:lot_number", anyRole, handlers.TraceLot)
+		api.GET("/serials/:serial", anyRole, handlers.TraceSerial)
+		api.GET("/products/:sku", anyRole, handlers.GetProduct)
+		api.PUT("/products/:sku", admin, handlers.SaveProduct)
+		api.GET("/products/:sku/variants", anyRole, handlers.GetVariantMatrix)
+		api.POST("/orders/simulate", channel, handlers.SimulateOrder)
+		api.GET("/purchase-orders", anyRole, handlers.ListPurchaseOrders)
+		api.POST("/purchase-orders", admin, handlers.CreatePurchaseOrder)
+		api.GET("/purchase-orders/:id", anyRole, handlers.GetPurchaseOrder)
+		api.POST("/purchase-orders/:id/receipts", operator, handlers.ReceivePurchaseOrder)
+		api.POST("/purchase-orders/:id/close", admin, handlers.ClosePurchaseOrder)
+		api.GET("/replenishment", anyRole, handlers.GetReplenishment)
+		api.GET("/valuation", anyRole, handlers.GetValuation)
+		api.POST("/rebalancing/analyze", admin, handlers.AnalyzeRebalancing)
+		api.GET("/rebalancing/proposals", anyRole, handlers.ListTransferProposals)
+		api.GET("/rebalancing/proposals/:id", anyRole, handlers.GetTransferProposal)
+		api.POST("/rebalancing/proposals/:id/approve", operator, handlers.ApproveTransferProposal)
+		api.POST("/rebalancing/proposals/:id/reject", operator, handlers.RejectTransferProposal)
+		api.GET("/history/:sku", anyRole, handlers.GetInventoryHistory)
+		api.GET("/ledger/consistency", anyRole, handlers.CheckLedgerConsistency)
+		api.POST("/ledger/snapshots", admin, handlers.CreateStockSnapshot)
+		api.GET("/audit", admin, handlers.ListAuditEntries)
+		api.GET("/audit/verify", admin, handlers.VerifyAuditChain)
 	}
 
 	// Debug endpoint
-	router.GET("/debug/env", func(c *gin.Context) {
-		envVars := map[string]string{
-			"SLACK_WEBHOOK_URL": os.Getenv("SLACK_WEBHOOK_URL"),
+	router.GET("/debug/env", authMiddleware, admin, func(c *gin.Context) {
+		envVars := map[string]bool{
+			"SLACK_WEBHOOK_URL": cfg.Slack.WebhookURL != "",
 		}
 		c.JSON(200, envVars)
 	})
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-			"time":   time.Now().Format(time.RFC3339),
-		})
-	})
+	// Health check endpoints. Liveness ignores dependencies; readiness
+	// fails when Postgres or Redis is down and degrades on consumer lag.
+	checker := health.NewChecker(cfg.Health.CheckTimeout.Duration(),
+		health.Check{Name: "postgres", Critical: true, Run: health.Postgres(database)},
+		health.Check{Name: "redis", Critical: true, Run: health.Redis(redisClient)},
+		health.Check{
+			Name: "event_consumer",
+			Run:  health.EventConsumer(processor, redisClient, consumerDone, cfg.Health.MaxConsumerLag.Duration()),
+		},
+	)
+	router.GET("/health/live", health.Live())
+	router.GET("/health/ready", checker.Ready())
+	router.GET("/health", checker.Ready())
+
+	// Prometheus metrics, including pool statistics and stock totals
+	// gathered at scrape time
+	prometheus.MustRegister(
+		metrics.NewPoolCollector(database),
+		metrics.NewStockCollector(inventoryService),
+	)
+	router.GET("/metrics", metrics.Handler())
 
 	// Web interface routes
 	router.GET("/", func(c *gin.Context) {
@@ -128,12 +265,71 @@ func main() {
 	})
 
 	// Start server
-	port := os.Getenv("APP_PORT")
-	if port == "" {
-		port = "8081"
+	port := strconv.Itoa(cfg.App.Port)
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "port", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutdown signal received")
+	case serveErr = <-serverErr:
+		slog.Error("server failed", "error", serveErr)
+	}
+	// A second signal terminates immediately
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.App.ShutdownTimeout.Duration())
+	defer cancel()
+
+	// Stop accepting connections and wait for in-flight requests
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("error draining HTTP requests", "error", err)
+	}
+
+	// Stop the stream consumer, snapshot scheduler, expiry alerts,
+	// replenishment reports and rebalancing analysis
+	stopWorkers()
+	for _, done := range []<-chan struct{}{consumerDone, schedulerDone, expiryDone, replenishmentDone, rebalancingDone} {
+		select {
+		case <-done:
+		case <-shutdownCtx.Done():
+		}
+	}
+
+	// Finish events already read from the stream, then deliver queued alerts
+	if err := processor.Stop(shutdownCtx); err != nil {
+		slog.Error("error draining inventory events", "error", err)
 	}
-	log.Printf("Starting server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := notifier.Close(shutdownCtx); err != nil {
+		slog.Error("error flushing webhook queue", "error", err)
 	}
-} 
\ No newline at end of file
+
+	redisClient.Close()
+	database.Close()
+
+	// Export spans recorded during shutdown
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("error flushing traces", "error", err)
+	}
+
+	if serveErr != nil {
+		fatal("failed to start server", serveErr)
+	}
+	slog.Info("shutdown complete")
+}
+
+// fatal logs err and exits with a non-zero status.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
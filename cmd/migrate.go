@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"omnichannel_inventory/internal/config"
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/migrations"
+)
+
+const migrateUsage = "usage: main migrate up | down [n] | status"
+
+// runMigrate handles the migrate subcommand:
+//
+//	main migrate up         apply all pending migrations
+//	main migrate down [n]   roll back the last n migrations (default 1)
+//	main migrate status     list migrations and whether they are applied
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+	database, err := db.Connect(ctx, cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "up":
+		versions, err := migrations.Up(ctx, database)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			slog.Info("schema is up to date")
+		}
+		for _, v := range versions {
+			slog.Info("applied migration", "version", v)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of migrations to roll back: %s", args[1])
+			}
+		}
+		versions, err := migrations.Down(ctx, database, steps)
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			slog.Info("rolled back migration", "version", v)
+		}
+	case "status":
+		statuses, err := migrations.List(ctx, database)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(os.Stdout, "%04d %-24s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+)
+
+// AnonymousActor is recorded when a change is made without an authenticated identity.
+const AnonymousActor = "anonymous"
+
+// Widths of the audit_log metadata columns, in characters. Identities longer
+// than MaxActorLength are rejected at authentication; request IDs and source
+// addresses are cut to fit.
+const (
+	MaxActorLength     = 255
+	MaxRequestIDLength = 100
+	MaxSourceIPLength  = 64
+)
+
+// Metadata describes who made a change and where the request came from.
+type Metadata struct {
+	Actor     string
+	RequestID string
+	SourceIP  string
+}
+
+type contextKey struct{}
+
+// WithMetadata returns a copy of ctx carrying the request metadata.
+func WithMetadata(ctx context.Context, m Metadata) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the request metadata stored in ctx, if any.
+func FromContext(ctx context.Context) Metadata {
+	m, _ := ctx.Value(contextKey{}).(Metadata)
+	if m.Actor == "" {
+		m.Actor = AnonymousActor
+	}
+	return m
+}
+
+// Hash computes the chained hash of an entry. Every field except ID and
+// Hash itself is covered, together with the previous entry's hash, so
+// altering or removing any row breaks the chain from that point on.
+func Hash(prevHash string, e models.AuditEntry) string {
+	payload, _ := json.Marshal(struct {
+		PrevHash      string `json:"prev_hash"`
+		OccurredAt    string `json:"occurred_at"`
+		Actor         string `json:"actor"`
+		RequestID     string `json:"request_id"`
+		SourceIP      string `json:"source_ip"`
+		Action        string `json:"action"`
+		SKU           string `json:"sku"`
+		WarehouseID   int    `json:"warehouse_id"`
+		Change        int    `json:"change"`
+		Channel       string `json:"channel"`
+		Reason        string `json:"reason"`
+		ReasonCode    string `json:"reason_code"`
+		TransactionID int    `json:"transaction_id"`
+	}{
+		PrevHash:      prevHash,
+		OccurredAt:    e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		Actor:         e.Actor,
+		RequestID:     e.RequestID,
+		SourceIP:      e.SourceIP,
+		Action:        e.Action,
+		SKU:           e.SKU,
+		WarehouseID:   e.WarehouseID,
+		Change:        e.Change,
+		Channel:       e.Channel,
+		Reason:        e.Reason,
+		ReasonCode:    e.ReasonCode,
+		TransactionID: e.TransactionID,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, AnonymousActor, FromContext(context.Background()).Actor)
+
+	ctx := WithMetadata(context.Background(), Metadata{Actor: "alice", RequestID: "req-1", SourceIP: "10.0.0.1"})
+	assert.Equal(t, Metadata{Actor: "alice", RequestID: "req-1", SourceIP: "10.0.0.1"}, FromContext(ctx))
+}
+
+func TestHash(t *testing.T) {
+	entry := models.AuditEntry{
+		OccurredAt: time.Date(2024, 5, 4, 1, 20, 12, 0, time.UTC),
+		Actor:      "alice",
+		Action:     "stock_update",
+		SKU:        "PROD001",
+		Change:     5,
+		ReasonCode: models.ReasonReceipt,
+	}
+	first := Hash("", entry)
+	assert.Len(t, first, 64)
+	assert.Equal(t, first, Hash("", entry))
+
+	assert.NotEqual(t, first, Hash("abc", entry))
+
+	tampered := entry
+	tampered.Change = 50
+	assert.NotEqual(t, first, Hash("", tampered))
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"omnichannel_inventory/internal/audit"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles recognised by the API.
+const (
+	RoleViewer             = "viewer"
+	RoleWarehouseOperator  = "warehouse-operator"
+	RoleChannelIntegration = "channel-integration"
+	RoleAdmin              = "admin"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrNoCredentialSource = errors.New("no API keys or JWT verification keys configured")
+)
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleViewer, RoleWarehouseOperator, RoleChannelIntegration, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// isValidSubject reports whether subject can be recorded as the actor of
+// audited changes.
+func isValidSubject(subject string) bool {
+	return subject != "" && utf8.RuneCountInString(subject) <= audit.MaxActorLength
+}
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	Subject    string `json:"subject"`
+	Role       string `json:"role"`
+	Warehouses []int  `json:"warehouses,omitempty"`
+}
+
+// HasRole reports whether the principal holds one of the given roles.
+// Admins hold every role.
+func (p *Principal) HasRole(roles ...string) bool {
+	if p.Role == RoleAdmin {
+		return true
+	}
+	for _, r := range roles {
+		if p.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessWarehouse reports whether the principal may change stock in the
+// warehouse. Warehouse operators are limited to their assigned warehouses;
+// other roles are limited only if warehouses were assigned explicitly.
+func (p *Principal) CanAccessWarehouse(warehouseID int) bool {
+	if p.Role == RoleAdmin {
+		return true
+	}
+	if len(p.Warehouses) == 0 {
+		return p.Role != RoleWarehouseOperator
+	}
+	for _, id := range p.Warehouses {
+		if id == warehouseID {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the authenticated principal, or nil if there is none.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+type Config struct {
+	// APIKeysFile is a JSON array of API key entries.
+	APIKeysFile string
+	// HS256Secret enables HS256-signed JWTs.
+	HS256Secret string
+	// JWKSFile is a local JWKS document with RSA keys for RS256-signed JWTs.
+	JWKSFile string
+	Issuer   string
+	Audience string
+}
+
+// apiKeyEntry is one entry in the API keys file. Only the SHA-256 of the
+// key is stored so the file does not hold usable secrets.
+type apiKeyEntry struct {
+	KeySHA256  string `json:"key_sha256"`
+	Subject    string `json:"subject"`
+	Role       string `json:"role"`
+	Warehouses []int  `json:"warehouses"`
+}
+
+type Authenticator struct {
+	apiKeys    map[string]*Principal
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	a := &Authenticator{
+		apiKeys: map[string]*Principal{},
+		rsaKeys: map[string]*rsa.PublicKey{},
+	}
+
+	if cfg.APIKeysFile != "" {
+		if err := a.loadAPIKeys(cfg.APIKeysFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.HS256Secret != "" {
+		a.hmacSecret = []byte(cfg.HS256Secret)
+	}
+	if cfg.JWKSFile != "" {
+		if err := a.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(a.apiKeys) == 0 && a.hmacSecret == nil && len(a.rsaKeys) == 0 {
+		return nil, ErrNoCredentialSource
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	return a, nil
+}
+
+func (a *Authenticator) loadAPIKeys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read API keys file: %v", err)
+	}
+	var entries []apiKeyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("unable to parse API keys file: %v", err)
+	}
+	for _, e := range entries {
+		if len(e.KeySHA256) != sha256.Size*2 || !isValidSubject(e.Subject) || !IsValidRole(e.Role) {
+			return fmt.Errorf("invalid API key entry for subject %q", e.Subject)
+		}
+		a.apiKeys[strings.ToLower(e.KeySHA256)] = &Principal{
+			Subject:    e.Subject,
+			Role:       e.Role,
+			Warehouses: e.Warehouses,
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read JWKS file: %v", err)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return fmt.Errorf("unable to parse JWKS file: %v", err)
+	}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus for key %q: %v", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent for key %q: %v", k.Kid, err)
+		}
+		a.rsaKeys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return nil
+}
+
+// AuthenticateAPIKey resolves a raw API key to its principal.
+func (a *Authenticator) AuthenticateAPIKey(key string) (*Principal, error) {
+	// Keys are looked up by digest, so lookup timing reveals nothing about the key
+	sum := sha256.Sum256([]byte(key))
+	if p, ok := a.apiKeys[hex.EncodeToString(sum[:])]; ok {
+		return p, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+type tokenClaims struct {
+	Role       string `json:"role"`
+	Warehouses []int  `json:"warehouses"`
+	jwt.RegisteredClaims
+}
+
+// AuthenticateToken verifies a JWT and builds the principal from its claims.
+func (a *Authenticator) AuthenticateToken(raw string) (*Principal, error) {
+	var claims tokenClaims
+	_, err := a.parser.ParseWithClaims(raw, &claims, a.verificationKey)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !isValidSubject(claims.Subject) || !IsValidRole(claims.Role) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		Subject:    claims.Subject,
+		Role:       claims.Role,
+		Warehouses: claims.Warehouses,
+	}, nil
+}
+
+func (a *Authenticator) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case "HS256":
+		if a.hmacSecret == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return a.hmacSecret, nil
+	case "RS256":
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := a.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		// A JWKS with a single key may be used without key IDs
+		if kid == "" && len(a.rsaKeys) == 1 {
+			for _, key := range a.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
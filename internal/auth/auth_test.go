@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func keyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewAuthenticatorRequiresCredentialSource(t *testing.T) {
+	_, err := NewAuthenticator(Config{})
+	assert.Equal(t, ErrNoCredentialSource, err)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	path := writeFile(t, "keys.json", fmt.Sprintf(
+		`[{"key_sha256":%q,"subject":"wh-1-scanner","role":"warehouse-operator","warehouses":[1]}]`,
+		keyDigest("secret-key")))
+	a, err := NewAuthenticator(Config{APIKeysFile: path})
+	require.NoError(t, err)
+
+	p, err := a.AuthenticateAPIKey("secret-key")
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "wh-1-scanner", Role: RoleWarehouseOperator, Warehouses: []int{1}}, p)
+
+	_, err = a.AuthenticateAPIKey("wrong-key")
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
+
+func TestAuthenticateAPIKeyRejectsUnknownRole(t *testing.T) {
+	path := writeFile(t, "keys.json", fmt.Sprintf(`[{"key_sha256":%q,"subject":"x","role":"root"}]`, keyDigest("k")))
+	_, err := NewAuthenticator(Config{APIKeysFile: path})
+	assert.Error(t, err)
+}
+
+func TestAuthenticateAPIKeyRejectsLongSubject(t *testing.T) {
+	path := writeFile(t, "keys.json", fmt.Sprintf(`[{"key_sha256":%q,"subject":%q,"role":"viewer"}]`, keyDigest("k"), strings.Repeat("s", 256)))
+	_, err := NewAuthenticator(Config{APIKeysFile: path})
+	assert.Error(t, err)
+}
+
+func TestSampleAPIKeysFileGrantsNoAccess(t *testing.T) {
+	// The sample is a template; used unedited it must not start the server
+	_, err := NewAuthenticator(Config{APIKeysFile: "../../configs/api_keys.sample.json"})
+	assert.EqualError(t, err, `invalid API key entry for subject "local-admin"`)
+}
+
+func TestAuthenticateTokenHS256(t *testing.T) {
+	a, err := NewAuthenticator(Config{HS256Secret: "shh", Issuer: "idp"})
+	require.NoError(t, err)
+
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("shh"))
+		require.NoError(t, err)
+		return token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	p, err := a.AuthenticateToken(sign(jwt.MapClaims{"sub": "shopify", "role": "channel-integration", "iss": "idp", "exp": exp}))
+	require.NoError(t, err)
+	assert.Equal(t, "shopify", p.Subject)
+	assert.Equal(t, RoleChannelIntegration, p.Role)
+
+	_, err = a.AuthenticateToken(sign(jwt.MapClaims{"sub": "shopify", "role": "channel-integration", "iss": "other", "exp": exp}))
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	_, err = a.AuthenticateToken(sign(jwt.MapClaims{"sub": "shopify", "role": "channel-integration", "iss": "idp"}))
+	assert.Equal(t, ErrInvalidCredentials, err, "tokens without expiry are rejected")
+
+	_, err = a.AuthenticateToken(sign(jwt.MapClaims{"sub": "shopify", "role": "channel-integration", "iss": "idp", "exp": time.Now().Add(-time.Minute).Unix()}))
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	_, err = a.AuthenticateToken(sign(jwt.MapClaims{"sub": strings.Repeat("s", 256), "role": "channel-integration", "iss": "idp", "exp": exp}))
+	assert.Equal(t, ErrInvalidCredentials, err, "subjects too long to audit are rejected")
+}
+
+func TestAuthenticateTokenRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	a, err := NewAuthenticator(Config{JWKSFile: writeFile(t, "jwks.json", jwks)})
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "alice", "role": "admin", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	p, err := a.AuthenticateToken(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", p.Subject)
+
+	// HS256 is not accepted when only a JWKS is configured
+	hs, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice", "role": "admin", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("guess"))
+	_, err = a.AuthenticateToken(hs)
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
+
+func TestPrincipalAuthorization(t *testing.T) {
+	operator := &Principal{Role: RoleWarehouseOperator, Warehouses: []int{1, 3}}
+	assert.True(t, operator.CanAccessWarehouse(3))
+	assert.False(t, operator.CanAccessWarehouse(2))
+	assert.False(t, (&Principal{Role: RoleWarehouseOperator}).CanAccessWarehouse(1))
+	assert.True(t, (&Principal{Role: RoleChannelIntegration}).CanAccessWarehouse(1))
+	assert.True(t, (&Principal{Role: RoleAdmin, Warehouses: []int{1}}).CanAccessWarehouse(9))
+
+	assert.True(t, operator.HasRole(RoleViewer, RoleWarehouseOperator))
+	assert.False(t, operator.HasRole(RoleChannelIntegration))
+	assert.True(t, (&Principal{Role: RoleAdmin}).HasRole(RoleChannelIntegration))
+}
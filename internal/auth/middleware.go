@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Middleware authenticates requests with an API key or a bearer JWT and
+// records the principal in the request context and the audit metadata.
+func Middleware(a *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			principal *Principal
+			err       error
+		)
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			principal, err = a.AuthenticateAPIKey(key)
+		} else if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			principal, err = a.AuthenticateToken(token)
+		} else {
+			err = ErrMissingCredentials
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, err.Error()))
+			return
+		}
+
+		setPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// Disabled admits every request as an anonymous admin. It is intended for
+// local development only.
+func Disabled() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setPrincipal(c, &Principal{Subject: audit.AnonymousActor, Role: RoleAdmin})
+		c.Next()
+	}
+}
+
+func setPrincipal(c *gin.Context, p *Principal) {
+	ctx := WithPrincipal(c.Request.Context(), p)
+	meta := audit.FromContext(ctx)
+	meta.Actor = p.Subject
+	c.Request = c.Request.WithContext(audit.WithMetadata(ctx, meta))
+}
+
+// RequireRole rejects requests whose principal holds none of the roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := FromContext(c.Request.Context())
+		if p == nil {
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, ErrMissingCredentials.Error()))
+			return
+		}
+		if !p.HasRole(roles...) {
+			problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeForbidden, "Your role does not permit this operation."))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"omnichannel_inventory/internal/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	path := writeFile(t, "keys.json", fmt.Sprintf(
+		`[{"key_sha256":%q,"subject":"dashboard","role":"viewer"}]`, keyDigest("viewer-key")))
+	a, err := NewAuthenticator(Config{APIKeysFile: path})
+	require.NoError(t, err)
+
+	var actor string
+	router := gin.New()
+	router.Use(Middleware(a))
+	router.GET("/read", RequireRole(RoleViewer), func(c *gin.Context) {
+		actor = audit.FromContext(c.Request.Context()).Actor
+	})
+	router.POST("/write", RequireRole(RoleWarehouseOperator), func(c *gin.Context) {})
+
+	do := func(method, target, key string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/read", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/read", "nope"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/read", "viewer-key"))
+	assert.Equal(t, "dashboard", actor)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/write", "viewer-key"))
+}
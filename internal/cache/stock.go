@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// Each SKU has three keys sharing a hash tag: the cached entry, a version
+// counter bumped on every invalidation, and a fill lock. Entries are stored
+// as "<version>:<payload>" and are only served while their version matches
+// the counter, so a fill that read the database before a committed write
+// can never be served after that write has been invalidated.
+
+// lookupScript returns {1, version, payload} on a hit. On a miss it tries to
+// take the fill lock and returns {2, version, ""} if it did and
+// {3, version, ""} if another caller is already filling.
+const lookupScript = `
+local version = redis.call('GET', KEYS[2]) or '0'
+local entry = redis.call('GET', KEYS[1])
+if entry then
+	local sep = string.find(entry, ':', 1, true)
+	if sep and string.sub(entry, 1, sep - 1) == version then
+		return {1, version, string.sub(entry, sep + 1)}
+	end
+end
+if redis.call('SET', KEYS[3], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return {2, version, ''}
+end
+return {3, version, ''}
+`
+
+// fillScript stores the payload if the version is still current and
+// releases the fill lock if the caller holds it. It returns 1 if stored.
+const fillScript = `
+local stored = 0
+if (redis.call('GET', KEYS[2]) or '0') == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1] .. ':' .. ARGV[2], 'PX', ARGV[3])
+	stored = 1
+end
+if redis.call('GET', KEYS[3]) == ARGV[4] then
+	redis.call('DEL', KEYS[3])
+end
+return stored
+`
+
+// releaseScript releases the fill lock if the caller holds it.
+const releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// invalidateScript bumps the version, drops the entry and clears any fill
+// lock so readers of the new version do not wait on a fill that can no
+// longer be stored.
+const invalidateScript = `
+redis.call('INCR', KEYS[2])
+redis.call('DEL', KEYS[1], KEYS[3])
+return 0
+`
+
+const (
+	statusHit  = 1
+	statusFill = 2
+	statusBusy = 3
+)
+
+// pollInterval is how often a caller waiting on another's fill looks again.
+const pollInterval = 20 * time.Millisecond
+
+// Evaler runs the cache scripts. Pipelined batches scripts for several
+// SKUs, whose keys may be in different cluster slots.
+type Evaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
+// Stock is a read-through cache of stock summaries per SKU. Concurrent
+// misses for a SKU are collapsed into one database read per process, and
+// across processes only the holder of the fill lock reads the database
+// while others wait up to the lock timeout for it to finish.
+type Stock struct {
+	client      Evaler
+	prefix      string
+	ttl         time.Duration
+	lockTimeout time.Duration
+	flights     singleflight.Group
+}
+
+func NewStock(client Evaler, ttl, lockTimeout time.Duration) *Stock {
+	return &Stock{client: client, prefix: "cache:stock:", ttl: ttl, lockTimeout: lockTimeout}
+}
+
+func (c *Stock) keys(sku string) (entry, version, lock string) {
+	base := c.prefix + "{" + sku + "}"
+	return base, base + ":version", base + ":lock"
+}
+
+// Get returns the cached stock levels for sku, calling load on a miss. If
+// Redis fails the cache is bypassed and load is called directly.
+func (c *Stock) Get(ctx context.Context, sku string, load func(ctx context.Context) (models.StockSummary, error)) (models.StockSummary, error) {
+	token := strconv.FormatInt(rand.Int63(), 36)
+	status, version, summary, err := c.lookup(ctx, sku, token)
+	if err != nil {
+		metrics.StockCacheLookups.WithLabelValues("error").Inc()
+		slog.WarnContext(ctx, "stock cache unavailable, reading from database", "sku", sku, "error", err)
+		return load(ctx)
+	}
+	if status == statusHit {
+		metrics.StockCacheLookups.WithLabelValues("hit").Inc()
+		return summary, nil
+	}
+	metrics.StockCacheLookups.WithLabelValues("miss").Inc()
+
+	// Callers that saw the same version share one load. A caller arriving
+	// after an invalidation sees a newer version and loads afresh.
+	v, err, _ := c.flights.Do(sku+"@"+version, func() (interface{}, error) {
+		if status == statusBusy {
+			return c.wait(ctx, sku, token, load)
+		}
+		return c.fill(ctx, sku, version, token, load)
+	})
+	if err != nil {
+		return models.StockSummary{}, err
+	}
+	return v.(models.StockSummary), nil
+}
+
+func (c *Stock) lookup(ctx context.Context, sku, token string) (int64, string, models.StockSummary, error) {
+	entry, version, lock := c.keys(sku)
+	reply, err := c.client.Eval(ctx, lookupScript, []string{entry, version, lock}, token, c.lockTimeout.Milliseconds()).Slice()
+	if err != nil {
+		return 0, "", models.StockSummary{}, err
+	}
+	if len(reply) != 3 {
+		return 0, "", models.StockSummary{}, fmt.Errorf("unexpected stock cache reply %v", reply)
+	}
+	status, _ := reply[0].(int64)
+	ver, _ := reply[1].(string)
+	if status != statusHit {
+		return status, ver, models.StockSummary{}, nil
+	}
+
+	payload, _ := reply[2].(string)
+	var summary models.StockSummary
+	if err := json.Unmarshal([]byte(payload), &summary); err != nil {
+		return 0, "", models.StockSummary{}, fmt.Errorf("corrupt stock cache entry: %v", err)
+	}
+	return status, ver, summary, nil
+}
+
+// fill loads from the database while holding the fill lock and stores the
+// result unless the SKU was invalidated in the meantime.
+func (c *Stock) fill(ctx context.Context, sku, version, token string, load func(ctx context.Context) (models.StockSummary, error)) (models.StockSummary, error) {
+	entry, versionKey, lock := c.keys(sku)
+	summary, err := load(ctx)
+	if err != nil {
+		c.client.Eval(ctx, releaseScript, []string{lock}, token)
+		return models.StockSummary{}, err
+	}
+
+	payload, err := json.Marshal(summary)
+	if err == nil {
+		err = c.client.Eval(ctx, fillScript, []string{entry, versionKey, lock}, version, payload, c.ttl.Milliseconds(), token).Err()
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "error filling stock cache", "sku", sku, "error", err)
+	}
+	return summary, nil
+}
+
+// wait polls until another caller's fill lands, the lock is released
+// without a fill, or the lock timeout passes, in which case it reads the
+// database without caching.
+func (c *Stock) wait(ctx context.Context, sku, token string, load func(ctx context.Context) (models.StockSummary, error)) (models.StockSummary, error) {
+	deadline := time.Now().Add(c.lockTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return models.StockSummary{}, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+
+		status, version, summary, err := c.lookup(ctx, sku, token)
+		switch {
+		case err != nil:
+			return load(ctx)
+		case status == statusHit:
+			return summary, nil
+		case status == statusFill:
+			return c.fill(ctx, sku, version, token, load)
+		}
+	}
+	return load(ctx)
+}
+
+// Invalidate discards the cached stock of each SKU. It must be called after
+// the change is committed and before the change is acknowledged. Each SKU
+// is invalidated by its own script, as the keys of different SKUs can be
+// in different cluster slots.
+func (c *Stock) Invalidate(ctx context.Context, skus ...string) error {
+	if len(skus) == 0 {
+		return nil
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sku := range skus {
+			entry, version, lock := c.keys(sku)
+			pipe.Eval(ctx, invalidateScript, []string{entry, version, lock})
+		}
+		return nil
+	})
+	return err
+}
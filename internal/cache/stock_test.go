@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T) (*Stock, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewStock(client, time.Minute, time.Second), server
+}
+
+// fakeStore stands in for the stock_levels table.
+type fakeStore struct {
+	mu       sync.Mutex
+	quantity int
+	loads    int32
+}
+
+func (s *fakeStore) load(ctx context.Context) (models.StockSummary, error) {
+	atomic.AddInt32(&s.loads, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return models.StockSummary{SKU: "test", OnHand: s.quantity, Available: s.quantity}, nil
+}
+
+// write commits a new quantity and invalidates the cache, as the service does.
+func (s *fakeStore) write(t *testing.T, c *Stock, quantity int) {
+	s.mu.Lock()
+	s.quantity = quantity
+	s.mu.Unlock()
+	require.NoError(t, c.Invalidate(context.Background(), "test"))
+}
+
+func TestGetCachesUntilInvalidated(t *testing.T) {
+	c, _ := newTestCache(t)
+	store := &fakeStore{quantity: 5}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		summary, err := c.Get(ctx, "test", store.load)
+		require.NoError(t, err)
+		assert.Equal(t, 5, summary.OnHand)
+	}
+	assert.Equal(t, int32(1), store.loads)
+
+	store.write(t, c, 7)
+	summary, err := c.Get(ctx, "test", store.load)
+	require.NoError(t, err)
+	assert.Equal(t, 7, summary.OnHand)
+	assert.Equal(t, int32(2), store.loads)
+}
+
+// pipelineRecorder records the keys of every script run in a pipeline.
+type pipelineRecorder struct {
+	*redis.Client
+	keys [][]string
+}
+
+func (r *pipelineRecorder) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	cmds, err := r.Client.Pipelined(ctx, fn)
+	for _, cmd := range cmds {
+		// EVAL script numkeys key...
+		var keys []string
+		for _, arg := range cmd.Args()[3:] {
+			keys = append(keys, arg.(string))
+		}
+		r.keys = append(r.keys, keys)
+	}
+	return cmds, err
+}
+
+func TestInvalidateSeveralSKUs(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := &pipelineRecorder{Client: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+	t.Cleanup(func() { client.Close() })
+	c := NewStock(client, time.Minute, time.Second)
+	ctx := context.Background()
+
+	quantities := map[string]int{"a": 1, "b": 2}
+	loads := 0
+	get := func(sku string) int {
+		summary, err := c.Get(ctx, sku, func(ctx context.Context) (models.StockSummary, error) {
+			loads++
+			return models.StockSummary{SKU: sku, OnHand: quantities[sku]}, nil
+		})
+		require.NoError(t, err)
+		return summary.OnHand
+	}
+	get("a")
+	get("b")
+
+	quantities["a"], quantities["b"] = 3, 4
+	require.NoError(t, c.Invalidate(ctx, "a", "b"))
+	assert.Equal(t, 3, get("a"))
+	assert.Equal(t, 4, get("b"))
+	assert.Equal(t, 4, loads)
+
+	// One script per SKU, so every script's keys share a cluster slot
+	assert.Equal(t, [][]string{
+		{"cache:stock:{a}", "cache:stock:{a}:version", "cache:stock:{a}:lock"},
+		{"cache:stock:{b}", "cache:stock:{b}:version", "cache:stock:{b}:lock"},
+	}, client.keys)
+}
+
+func TestGetNeverServesFillOlderThanCommittedWrite(t *testing.T) {
+	c, _ := newTestCache(t)
+	store := &fakeStore{quantity: 5}
+	ctx := context.Background()
+
+	// The reader queries the database, then a write commits and invalidates
+	// before the reader stores what it read.
+	stale := func(ctx context.Context) (models.StockSummary, error) {
+		summary, err := store.load(ctx)
+		store.write(t, c, 7)
+		return summary, err
+	}
+	summary, err := c.Get(ctx, "test", stale)
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.OnHand, "the racing reader itself began before the write")
+
+	summary, err = c.Get(ctx, "test", store.load)
+	require.NoError(t, err)
+	assert.Equal(t, 7, summary.OnHand)
+}
+
+func TestGetCollapsesConcurrentMisses(t *testing.T) {
+	c, _ := newTestCache(t)
+	release := make(chan struct{})
+	var loads int32
+	slow := func(ctx context.Context) (models.StockSummary, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return models.StockSummary{SKU: "test", OnHand: 5, Available: 5}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			summary, err := c.Get(context.Background(), "test", slow)
+			assert.NoError(t, err)
+			assert.Equal(t, 5, summary.OnHand)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads)
+}
+
+func TestGetWaitsForFillByAnotherInstance(t *testing.T) {
+	c, server := newTestCache(t)
+	other := NewStock(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute, time.Second)
+	store := &fakeStore{quantity: 5}
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		other.Get(context.Background(), "test", func(ctx context.Context) (models.StockSummary, error) {
+			close(started)
+			time.Sleep(60 * time.Millisecond)
+			return store.load(ctx)
+		})
+	}()
+	<-started
+
+	summary, err := c.Get(context.Background(), "test", store.load)
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.OnHand)
+	<-done
+	assert.Equal(t, int32(1), store.loads)
+}
+
+func TestGetBypassesCacheWhenRedisFails(t *testing.T) {
+	c, server := newTestCache(t)
+	server.Close()
+	store := &fakeStore{quantity: 5}
+
+	summary, err := c.Get(context.Background(), "test", store.load)
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.OnHand)
+}
+
+func TestGetDoesNotCacheLoadErrors(t *testing.T) {
+	c, _ := newTestCache(t)
+	_, err := c.Get(context.Background(), "test", func(ctx context.Context) (models.StockSummary, error) {
+		return models.StockSummary{}, errors.New("database down")
+	})
+	assert.Error(t, err)
+
+	store := &fakeStore{quantity: 5}
+	summary, err := c.Get(context.Background(), "test", store.load)
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.OnHand)
+}
@@ -0,0 +1,569 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/ratelimit"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Secret is a string that is masked whenever it is printed or serialised.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Value returns the unmasked secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// Duration is a time.Duration written as a Go duration string, e.g. "90s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+type Config struct {
+	App           AppConfig           `yaml:"app" toml:"app"`
+	Database      DatabaseConfig      `yaml:"database" toml:"database"`
+	Redis         RedisConfig         `yaml:"redis" toml:"redis"`
+	Slack         SlackConfig         `yaml:"slack" toml:"slack"`
+	Auth          AuthConfig          `yaml:"auth" toml:"auth"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit" toml:"rate_limit"`
+	Inventory     InventoryConfig     `yaml:"inventory" toml:"inventory"`
+	Replenishment ReplenishmentConfig `yaml:"replenishment" toml:"replenishment"`
+	Rebalancing   RebalancingConfig   `yaml:"rebalancing" toml:"rebalancing"`
+	Cache         CacheConfig         `yaml:"cache" toml:"cache"`
+	Health        HealthConfig        `yaml:"health" toml:"health"`
+	Tracing       TracingConfig       `yaml:"tracing" toml:"tracing"`
+	Logging       LoggingConfig       `yaml:"logging" toml:"logging"`
+}
+
+type AppConfig struct {
+	Port int `yaml:"port" toml:"port" env:"APP_PORT"`
+	// ShutdownTimeout bounds how long shutdown waits for requests, events
+	// and webhook deliveries to finish.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"APP_SHUTDOWN_TIMEOUT"`
+}
+
+type DatabaseConfig struct {
+	Host            string   `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port            int      `yaml:"port" toml:"port" env:"DB_PORT"`
+	User            string   `yaml:"user" toml:"user" env:"DB_USER"`
+	Password        Secret   `yaml:"password" toml:"password" env:"DB_PASSWORD"`
+	Name            string   `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode         string   `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE"`
+	MaxConns        int      `yaml:"max_conns" toml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns        int      `yaml:"min_conns" toml:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime Duration `yaml:"max_conn_lifetime" toml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime Duration `yaml:"max_conn_idle_time" toml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+}
+
+// URL returns the connection string, including the password.
+func (c DatabaseConfig) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password.Value()),
+		Host:     fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:     "/" + c.Name,
+		RawQuery: url.Values{"sslmode": {c.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
+type RedisConfig struct {
+	Addr         string `yaml:"addr" toml:"addr" env:"REDIS_ADDR"`
+	Password     Secret `yaml:"password" toml:"password" env:"REDIS_PASSWORD"`
+	DB           int    `yaml:"db" toml:"db" env:"REDIS_DB"`
+	PoolSize     int    `yaml:"pool_size" toml:"pool_size" env:"REDIS_POOL_SIZE"`
+	MinIdleConns int    `yaml:"min_idle_conns" toml:"min_idle_conns" env:"REDIS_MIN_IDLE_CONNS"`
+}
+
+type SlackConfig struct {
+	WebhookURL Secret   `yaml:"webhook_url" toml:"webhook_url" env:"SLACK_WEBHOOK_URL"`
+	Timeout    Duration `yaml:"timeout" toml:"timeout" env:"SLACK_TIMEOUT"`
+}
+
+type AuthConfig struct {
+	Disabled    bool   `yaml:"disabled" toml:"disabled" env:"AUTH_DISABLED"`
+	APIKeysFile string `yaml:"api_keys_file" toml:"api_keys_file" env:"AUTH_API_KEYS_FILE"`
+	HS256Secret Secret `yaml:"jwt_hs256_secret" toml:"jwt_hs256_secret" env:"AUTH_JWT_HS256_SECRET"`
+	JWKSFile    string `yaml:"jwks_file" toml:"jwks_file" env:"AUTH_JWKS_FILE"`
+	JWTIssuer   string `yaml:"jwt_issuer" toml:"jwt_issuer" env:"AUTH_JWT_ISSUER"`
+	JWTAudience string `yaml:"jwt_audience" toml:"jwt_audience" env:"AUTH_JWT_AUDIENCE"`
+}
+
+// Authenticator returns the settings for auth.NewAuthenticator.
+func (c AuthConfig) Authenticator() auth.Config {
+	return auth.Config{
+		APIKeysFile: c.APIKeysFile,
+		HS256Secret: c.HS256Secret.Value(),
+		JWKSFile:    c.JWKSFile,
+		Issuer:      c.JWTIssuer,
+		Audience:    c.JWTAudience,
+	}
+}
+
+// RateLimitConfig holds rules written as "<limit>/<window>", e.g. "600/1m".
+// Routes are keyed by method and route pattern.
+type RateLimitConfig struct {
+	Default string            `yaml:"default" toml:"default" env:"RATE_LIMIT_DEFAULT"`
+	Roles   map[string]string `yaml:"roles" toml:"roles" env:"RATE_LIMIT_ROLES"`
+	Routes  map[string]string `yaml:"routes" toml:"routes" env:"RATE_LIMIT_ROUTES"`
+}
+
+// Policy parses the configured rules.
+func (c RateLimitConfig) Policy() (ratelimit.Policy, error) {
+	var policy ratelimit.Policy
+	var err error
+	if c.Default != "" {
+		if policy.Default, err = ratelimit.ParseRule(c.Default); err != nil {
+			return policy, err
+		}
+	}
+	parse := func(rules map[string]string) (map[string]ratelimit.Rule, error) {
+		parsed := map[string]ratelimit.Rule{}
+		for key, value := range rules {
+			rule, err := ratelimit.ParseRule(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			parsed[key] = rule
+		}
+		return parsed, nil
+	}
+	if policy.Roles, err = parse(c.Roles); err != nil {
+		return policy, err
+	}
+	policy.Routes, err = parse(c.Routes)
+	return policy, err
+}
+
+type InventoryConfig struct {
+	LowStockThreshold int      `yaml:"low_stock_threshold" toml:"low_stock_threshold" env:"LOW_STOCK_THRESHOLD"`
+	SnapshotInterval  Duration `yaml:"snapshot_interval" toml:"snapshot_interval" env:"STOCK_SNAPSHOT_INTERVAL"`
+	// ExpiryAlertDays is how many days before expiry a stocked lot is alerted.
+	ExpiryAlertDays     int      `yaml:"expiry_alert_days" toml:"expiry_alert_days" env:"EXPIRY_ALERT_DAYS"`
+	ExpiryCheckInterval Duration `yaml:"expiry_check_interval" toml:"expiry_check_interval" env:"EXPIRY_CHECK_INTERVAL"`
+	// ValuationMethod is how issued stock is costed, fifo or average.
+	ValuationMethod string `yaml:"valuation_method" toml:"valuation_method" env:"VALUATION_METHOD"`
+}
+
+// ReplenishmentConfig holds the default settings reorder suggestions are
+// computed with and how often the reorder report is sent.
+type ReplenishmentConfig struct {
+	// WindowDays is how many days of orders sales velocity is measured over.
+	WindowDays      int `yaml:"window_days" toml:"window_days" env:"REPLENISHMENT_WINDOW_DAYS"`
+	LeadTimeDays    int `yaml:"lead_time_days" toml:"lead_time_days" env:"REPLENISHMENT_LEAD_TIME_DAYS"`
+	SafetyStockDays int `yaml:"safety_stock_days" toml:"safety_stock_days" env:"REPLENISHMENT_SAFETY_STOCK_DAYS"`
+	// CoverDays is how many days of sales a suggested order adds on top of
+	// the reorder point.
+	CoverDays      int      `yaml:"cover_days" toml:"cover_days" env:"REPLENISHMENT_COVER_DAYS"`
+	ReportInterval Duration `yaml:"report_interval" toml:"report_interval" env:"REPLENISHMENT_REPORT_INTERVAL"`
+}
+
+// Settings returns the configured replenishment settings.
+func (c ReplenishmentConfig) Settings() models.ReplenishmentSettings {
+	return models.ReplenishmentSettings{
+		WindowDays:      c.WindowDays,
+		LeadTimeDays:    c.LeadTimeDays,
+		SafetyStockDays: c.SafetyStockDays,
+		CoverDays:       c.CoverDays,
+	}
+}
+
+// RebalancingConfig holds the constraints on transfers recommended between
+// warehouses and how often the recommendations are recomputed. Routes lists
+// the allowed routes as "<from>><to>" warehouse ID pairs, e.g. "1>2,2>1";
+// every route is allowed when it is empty.
+type RebalancingConfig struct {
+	MinTransferQuantity int      `yaml:"min_transfer_quantity" toml:"min_transfer_quantity" env:"REBALANCING_MIN_TRANSFER_QUANTITY"`
+	Routes              string   `yaml:"routes" toml:"routes" env:"REBALANCING_ROUTES"`
+	Interval            Duration `yaml:"interval" toml:"interval" env:"REBALANCING_INTERVAL"`
+}
+
+// Constraints parses the configured rebalancing constraints.
+func (c RebalancingConfig) Constraints() (models.RebalancingConstraints, error) {
+	constraints := models.RebalancingConstraints{MinTransferQuantity: c.MinTransferQuantity}
+	for _, route := range strings.Split(c.Routes, ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(route, ">")
+		fromID, fromErr := strconv.Atoi(strings.TrimSpace(from))
+		toID, toErr := strconv.Atoi(strings.TrimSpace(to))
+		if !ok || fromErr != nil || toErr != nil || fromID <= 0 || toID <= 0 || fromID == toID {
+			return constraints, fmt.Errorf("route %q must be two different warehouse IDs as <from>><to>", route)
+		}
+		constraints.Routes = append(constraints.Routes, models.Route{From: fromID, To: toID})
+	}
+	return constraints, nil
+}
+
+type CacheConfig struct {
+	// StockTTL bounds how long consolidated stock is cached per SKU. Zero
+	// disables the cache.
+	StockTTL Duration `yaml:"stock_ttl" toml:"stock_ttl" env:"CACHE_STOCK_TTL"`
+	// StockLockTimeout bounds how long a cache miss waits for another
+	// instance to load the same SKU before reading the database itself.
+	StockLockTimeout Duration `yaml:"stock_lock_timeout" toml:"stock_lock_timeout" env:"CACHE_STOCK_LOCK_TIMEOUT"`
+}
+
+type HealthConfig struct {
+	CheckTimeout   Duration `yaml:"check_timeout" toml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	MaxConsumerLag Duration `yaml:"max_consumer_lag" toml:"max_consumer_lag" env:"HEALTH_MAX_CONSUMER_LAG"`
+}
+
+// Trace exporters.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+)
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp.
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318.
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG"`
+}
+
+type LoggingConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	// Format is json or text.
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() Config {
+	return Config{
+		App: AppConfig{
+			Port:            8081,
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Name:            "inventory",
+			SSLMode:         "disable",
+			MaxConns:        10,
+			MinConns:        0,
+			MaxConnLifetime: Duration(time.Hour),
+			MaxConnIdleTime: Duration(30 * time.Minute),
+		},
+		Redis: RedisConfig{
+			Addr:     "localhost:6379",
+			PoolSize: 10,
+		},
+		Slack: SlackConfig{
+			Timeout: Duration(5 * time.Second),
+		},
+		RateLimit: RateLimitConfig{
+			Default: "600/1m",
+			Routes: map[string]string{
+				"POST /api/orders/simulate": "120/1m",
+			},
+		},
+		Inventory: InventoryConfig{
+			LowStockThreshold:   10,
+			SnapshotInterval:    Duration(time.Hour),
+			ExpiryAlertDays:     30,
+			ExpiryCheckInterval: Duration(time.Hour),
+			ValuationMethod:     models.ValuationFIFO,
+		},
+		Replenishment: ReplenishmentConfig{
+			WindowDays:      28,
+			LeadTimeDays:    7,
+			SafetyStockDays: 7,
+			CoverDays:       30,
+			ReportInterval:  Duration(24 * time.Hour),
+		},
+		Rebalancing: RebalancingConfig{
+			MinTransferQuantity: 10,
+			Interval:            Duration(24 * time.Hour),
+		},
+		Cache: CacheConfig{
+			StockTTL:         Duration(30 * time.Second),
+			StockLockTimeout: Duration(2 * time.Second),
+		},
+		Health: HealthConfig{
+			CheckTimeout:   Duration(2 * time.Second),
+			MaxConsumerLag: Duration(time.Minute),
+		},
+		Tracing: TracingConfig{
+			Exporter:    TraceExporterNone,
+			ServiceName: "omnichannel-inventory",
+			SampleRatio: 1,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, then the file named by
+// CONFIG_FILE (YAML or TOML), then environment variables, which may be
+// supplied through a .env file in the working directory. Maps in the file
+// are merged into the defaults; maps set through the environment replace
+// them. The result is validated before it is returned.
+func Load() (Config, error) {
+	cfg := Default()
+
+	// Variables already set in the environment take precedence over .env
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("unable to load .env: %v", err)
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file type %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// applyEnv overrides fields tagged with `env` from the environment. Maps are
+// written as "key=value" pairs separated by semicolons.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+
+		switch {
+		case field.Type == durationType:
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%s: invalid duration %q", name, raw)
+			}
+			value.SetInt(int64(d))
+		case field.Type.Kind() == reflect.String:
+			value.SetString(raw)
+		case field.Type.Kind() == reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: invalid integer %q", name, raw)
+			}
+			value.SetInt(int64(n))
+		case field.Type.Kind() == reflect.Float64:
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s: invalid number %q", name, raw)
+			}
+			value.SetFloat(f)
+		case field.Type.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: invalid boolean %q", name, raw)
+			}
+			value.SetBool(b)
+		case field.Type.Kind() == reflect.Map:
+			m := map[string]string{}
+			for _, pair := range strings.Split(raw, ";") {
+				if strings.TrimSpace(pair) == "" {
+					continue
+				}
+				k, val, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("%s: invalid entry %q, expected key=value", name, pair)
+				}
+				m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+			}
+			value.Set(reflect.ValueOf(m))
+		}
+	}
+	return nil
+}
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.App.Port > 0 && c.App.Port < 65536, "APP_PORT: must be between 1 and 65535")
+	check(c.App.ShutdownTimeout > 0, "APP_SHUTDOWN_TIMEOUT: must be positive")
+
+	check(c.Database.Host != "", "DB_HOST: required")
+	check(c.Database.Port > 0 && c.Database.Port < 65536, "DB_PORT: must be between 1 and 65535")
+	check(c.Database.User != "", "DB_USER: required")
+	check(c.Database.Name != "", "DB_NAME: required")
+	check(sslModes[c.Database.SSLMode], "DB_SSLMODE: unsupported mode %q", c.Database.SSLMode)
+	check(c.Database.MaxConns > 0, "DB_MAX_CONNS: must be positive")
+	check(c.Database.MinConns >= 0 && c.Database.MinConns <= c.Database.MaxConns,
+		"DB_MIN_CONNS: must be between 0 and DB_MAX_CONNS")
+	check(c.Database.MaxConnLifetime > 0, "DB_MAX_CONN_LIFETIME: must be positive")
+	check(c.Database.MaxConnIdleTime > 0, "DB_MAX_CONN_IDLE_TIME: must be positive")
+
+	check(c.Redis.Addr != "", "REDIS_ADDR: required")
+	check(c.Redis.DB >= 0 && c.Redis.DB <= 15, "REDIS_DB: must be between 0 and 15")
+	check(c.Redis.PoolSize > 0, "REDIS_POOL_SIZE: must be positive")
+	check(c.Redis.MinIdleConns >= 0 && c.Redis.MinIdleConns <= c.Redis.PoolSize,
+		"REDIS_MIN_IDLE_CONNS: must be between 0 and REDIS_POOL_SIZE")
+
+	if c.Slack.WebhookURL != "" {
+		u, err := url.Parse(c.Slack.WebhookURL.Value())
+		check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "",
+			"SLACK_WEBHOOK_URL: must be an http(s) URL")
+	}
+	check(c.Slack.Timeout > 0, "SLACK_TIMEOUT: must be positive")
+
+	if !c.Auth.Disabled {
+		check(c.Auth.APIKeysFile != "" || c.Auth.HS256Secret != "" || c.Auth.JWKSFile != "",
+			"AUTH_API_KEYS_FILE, AUTH_JWT_HS256_SECRET or AUTH_JWKS_FILE: at least one is required unless AUTH_DISABLED is set")
+	}
+
+	if _, err := c.RateLimit.Policy(); err != nil {
+		errs = append(errs, fmt.Errorf("rate limit: %v", err))
+	}
+
+	check(c.Inventory.LowStockThreshold >= 0, "LOW_STOCK_THRESHOLD: must not be negative")
+	check(c.Inventory.SnapshotInterval > 0, "STOCK_SNAPSHOT_INTERVAL: must be positive")
+	check(c.Inventory.ExpiryAlertDays >= 0, "EXPIRY_ALERT_DAYS: must not be negative")
+	check(c.Inventory.ExpiryCheckInterval > 0, "EXPIRY_CHECK_INTERVAL: must be positive")
+	check(models.IsValidValuationMethod(c.Inventory.ValuationMethod), "VALUATION_METHOD: must be fifo or average")
+
+	check(c.Replenishment.WindowDays > 0, "REPLENISHMENT_WINDOW_DAYS: must be positive")
+	check(c.Replenishment.LeadTimeDays >= 0, "REPLENISHMENT_LEAD_TIME_DAYS: must not be negative")
+	check(c.Replenishment.SafetyStockDays >= 0, "REPLENISHMENT_SAFETY_STOCK_DAYS: must not be negative")
+	check(c.Replenishment.CoverDays >= 0, "REPLENISHMENT_COVER_DAYS: must not be negative")
+	check(c.Replenishment.ReportInterval > 0, "REPLENISHMENT_REPORT_INTERVAL: must be positive")
+
+	check(c.Rebalancing.MinTransferQuantity > 0, "REBALANCING_MIN_TRANSFER_QUANTITY: must be positive")
+	if _, err := c.Rebalancing.Constraints(); err != nil {
+		errs = append(errs, fmt.Errorf("REBALANCING_ROUTES: %v", err))
+	}
+	check(c.Rebalancing.Interval > 0, "REBALANCING_INTERVAL: must be positive")
+
+	check(c.Cache.StockTTL >= 0, "CACHE_STOCK_TTL: must not be negative")
+	check(c.Cache.StockLockTimeout > 0, "CACHE_STOCK_LOCK_TIMEOUT: must be positive")
+
+	check(c.Health.CheckTimeout > 0, "HEALTH_CHECK_TIMEOUT: must be positive")
+	check(c.Health.MaxConsumerLag > 0, "HEALTH_MAX_CONSUMER_LAG: must be positive")
+
+	switch c.Tracing.Exporter {
+	case TraceExporterNone, TraceExporterStdout:
+	case TraceExporterOTLP:
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "",
+			"OTEL_EXPORTER_OTLP_ENDPOINT: must be an http(s) URL when OTEL_TRACES_EXPORTER is otlp")
+	default:
+		errs = append(errs, fmt.Errorf("OTEL_TRACES_EXPORTER: must be none, stdout or otlp"))
+	}
+	check(c.Tracing.ServiceName != "", "OTEL_SERVICE_NAME: required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "OTEL_TRACES_SAMPLER_ARG: must be between 0 and 1")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Logging.Level)) == nil, "LOG_LEVEL: must be debug, info, warn or error")
+	check(c.Logging.Format == "json" || c.Logging.Format == "text", "LOG_FORMAT: must be json or text")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// String renders the configuration with secrets masked, for logging.
+func (c Config) String() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
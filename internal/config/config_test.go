@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validEnv sets the minimum needed for a valid configuration and isolates
+// the test from any .env file in the working directory.
+func validEnv(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("AUTH_DISABLED", "true")
+}
+
+func TestLoadDefaults(t *testing.T) {
+	validEnv(t)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 8081, cfg.App.Port)
+	assert.Equal(t, 30*time.Second, cfg.App.ShutdownTimeout.Duration())
+	assert.Equal(t, "disable", cfg.Database.SSLMode)
+	assert.Equal(t, 10, cfg.Inventory.LowStockThreshold)
+	assert.Equal(t, time.Hour, cfg.Inventory.SnapshotInterval.Duration())
+	assert.Equal(t, 30, cfg.Inventory.ExpiryAlertDays)
+	assert.Equal(t, "fifo", cfg.Inventory.ValuationMethod)
+	assert.Equal(t, models.ReplenishmentSettings{WindowDays: 28, LeadTimeDays: 7, SafetyStockDays: 7, CoverDays: 30}, cfg.Replenishment.Settings())
+	assert.Equal(t, 24*time.Hour, cfg.Replenishment.ReportInterval.Duration())
+	assert.Equal(t, 10, cfg.Rebalancing.MinTransferQuantity)
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	validEnv(t)
+	t.Setenv("DB_SSLMODE", "verify-full")
+	t.Setenv("DB_MAX_CONNS", "25")
+	t.Setenv("REDIS_DB", "3")
+	t.Setenv("STOCK_SNAPSHOT_INTERVAL", "15m")
+	t.Setenv("RATE_LIMIT_ROLES", "viewer=5/1s;admin=100/1m")
+	t.Setenv("REBALANCING_ROUTES", "1>2, 2>1")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "verify-full", cfg.Database.SSLMode)
+	assert.Equal(t, 25, cfg.Database.MaxConns)
+	assert.Equal(t, 3, cfg.Redis.DB)
+	assert.Equal(t, 15*time.Minute, cfg.Inventory.SnapshotInterval.Duration())
+
+	policy, err := cfg.RateLimit.Policy()
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Rule{Limit: 5, Window: time.Second}, policy.Roles["viewer"])
+
+	constraints, err := cfg.Rebalancing.Constraints()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Route{{From: 1, To: 2}, {From: 2, To: 1}}, constraints.Routes)
+}
+
+func TestLoadFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "database:\n  host: pg.internal\n  max_conns: 40\ninventory:\n  snapshot_interval: 30m\nrate_limit:\n  routes:\n    POST /api/stock: 10/1s\n",
+		"config.toml": "[database]\nhost = \"pg.internal\"\nmax_conns = 40\n\n[inventory]\nsnapshot_interval = \"30m\"\n\n[rate_limit.routes]\n\"POST /api/stock\" = \"10/1s\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			validEnv(t)
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			t.Setenv("CONFIG_FILE", path)
+			// Environment variables win over the file
+			t.Setenv("DB_MAX_CONNS", "50")
+
+			cfg, err := Load()
+			require.NoError(t, err)
+			assert.Equal(t, "pg.internal", cfg.Database.Host)
+			assert.Equal(t, 50, cfg.Database.MaxConns)
+			assert.Equal(t, 30*time.Minute, cfg.Inventory.SnapshotInterval.Duration())
+			// File maps are merged into the defaults
+			assert.Equal(t, map[string]string{"POST /api/stock": "10/1s", "POST /api/orders/simulate": "120/1m"}, cfg.RateLimit.Routes)
+		})
+	}
+}
+
+func TestLoadDotEnv(t *testing.T) {
+	validEnv(t)
+	require.NoError(t, os.WriteFile(".env", []byte("APP_PORT=9090\n"), 0o600))
+	t.Cleanup(func() { os.Unsetenv("APP_PORT") })
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 9090, cfg.App.Port)
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.MinConns = 100
+	cfg.Redis.DB = 42
+	cfg.RateLimit.Default = "lots"
+	cfg.Rebalancing.Routes = "1>1"
+	cfg.Inventory.ValuationMethod = "lifo"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, field := range []string{"DB_SSLMODE", "DB_MIN_CONNS", "REDIS_DB", "rate limit", "AUTH_API_KEYS_FILE", "REBALANCING_ROUTES", "VALUATION_METHOD"} {
+		assert.Contains(t, err.Error(), field)
+	}
+}
+
+func TestLoadRejectsInvalidEnv(t *testing.T) {
+	validEnv(t)
+	t.Setenv("DB_PORT", "five")
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "DB_PORT")
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Slack.WebhookURL = "https://hooks.slack.com/services/T/B/token"
+
+	for _, rendered := range []string{cfg.String(), fmt.Sprintf("%v", cfg), fmt.Sprintf("%+v", cfg.Database)} {
+		assert.NotContains(t, rendered, "hunter2")
+		assert.NotContains(t, rendered, "token")
+	}
+	assert.Contains(t, cfg.Database.URL(), "hunter2")
+}
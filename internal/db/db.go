@@ -4,27 +4,41 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"omnichannel_inventory/internal/config"
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/tracing"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-)
-
-var (
-	dbPool      *pgxpool.Pool
-	redisClient *redis.Client
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type DB interface {
 	Exec(ctx context.Context, sql string, args ...interface{}) error
 	Query(ctx context.Context, sql string, args ...interface{}) (Rows, error)
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Tx is a database transaction. Rows returned by Query must be closed
+// before the next statement is issued on the same transaction.
+type Tx interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) error
+	Query(ctx context.Context, sql string, args ...interface{}) (Rows, error)
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
 }
 
 type Redis interface {
 	Publish(ctx context.Context, channel string, message interface{}) error
 	XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd
 	XRead(ctx context.Context, args *redis.XReadArgs) *redis.XStreamSliceCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
 }
 
 type DBWrapper struct {
@@ -32,19 +46,108 @@ type DBWrapper struct {
 }
 
 func (w *DBWrapper) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	ctx, done := instrument(ctx, "db.Exec", sql)
 	_, err := w.pool.Exec(ctx, sql, args...)
+	done(err)
 	return err
 }
 
 func (w *DBWrapper) Query(ctx context.Context, sql string, args ...interface{}) (Rows, error) {
-	return w.pool.Query(ctx, sql, args...)
+	ctx, done := instrument(ctx, "db.Query", sql)
+	rows, err := w.pool.Query(ctx, sql, args...)
+	done(err)
+	return rows, err
+}
+
+func (w *DBWrapper) Begin(ctx context.Context) (Tx, error) {
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &TxWrapper{tx: tx}, nil
+}
+
+type TxWrapper struct {
+	tx pgx.Tx
+}
+
+func (w *TxWrapper) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	ctx, done := instrument(ctx, "db.Exec", sql)
+	_, err := w.tx.Exec(ctx, sql, args...)
+	done(err)
+	return err
+}
+
+func (w *TxWrapper) Query(ctx context.Context, sql string, args ...interface{}) (Rows, error) {
+	ctx, done := instrument(ctx, "db.Query", sql)
+	rows, err := w.tx.Query(ctx, sql, args...)
+	done(err)
+	return rows, err
+}
+
+func (w *TxWrapper) Commit(ctx context.Context) error {
+	return w.tx.Commit(ctx)
+}
+
+func (w *TxWrapper) Rollback(ctx context.Context) error {
+	return w.tx.Rollback(ctx)
+}
+
+var tablePattern = regexp.MustCompile(`(?i)\b(?:from|into|update|join|table(?:\s+if\s+not\s+exists)?)\s+([a-z_][a-z0-9_]*)`)
+
+// describe labels a statement by its leading keyword and the first table it
+// names, so latency is tracked per query shape without unbounded labels.
+// Query latency covers execution up to the first row, not reading results.
+func describe(sql string) (operation, table string) {
+	var lines []string
+	for _, line := range strings.Split(sql, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			lines = append(lines, trimmed)
+		}
+	}
+	fields := strings.Fields(strings.Join(lines, " "))
+	if len(fields) == 0 {
+		return "unknown", "none"
+	}
+	operation = strings.ToLower(fields[0])
+	table = "none"
+	if m := tablePattern.FindStringSubmatch(strings.Join(fields, " ")); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	return operation, table
+}
+
+// instrument starts a span and latency measurement for a statement. The
+// returned function ends both.
+func instrument(ctx context.Context, name, sql string) (context.Context, func(error)) {
+	operation, table := describe(sql)
+	ctx, span := tracing.Start(ctx, name,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", operation),
+		attribute.String("db.sql.table", table),
+		attribute.String("db.statement", strings.TrimSpace(sql)),
+	)
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.DBQueryErrors.WithLabelValues(operation, table).Inc()
+		}
+		tracing.End(span, err)
+	}
 }
 
 type RedisWrapper struct {
 	client *redis.Client
 }
 
-func (w *RedisWrapper) Publish(ctx context.Context, channel string, message interface{}) error {
+func (w *RedisWrapper) Publish(ctx context.Context, channel string, message interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "redis.PUBLISH",
+		attribute.String("db.system", "redis"),
+		attribute.String("messaging.destination.name", channel),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	// Convert message to JSON before publishing
 	data, err := json.Marshal(message)
 	if err != nil {
@@ -55,14 +158,24 @@ func (w *RedisWrapper) Publish(ctx context.Context, channel string, message inte
 }
 
 func (w *RedisWrapper) XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd {
-	// Convert values to JSON strings
+	ctx, span := tracing.Start(ctx, "redis.XADD",
+		attribute.String("db.system", "redis"),
+		attribute.String("messaging.destination.name", args.Stream),
+	)
+
+	// Strings are stored as-is so consumers read them back unchanged; other
+	// values are JSON-encoded
 	values := make(map[string]interface{})
 	if args.Values != nil {
 		if m, ok := args.Values.(map[string]interface{}); ok {
 			for k, v := range m {
+				if str, ok := v.(string); ok {
+					values[k] = str
+					continue
+				}
 				data, err := json.Marshal(v)
 				if err != nil {
-					log.Printf("Error marshaling value for key %s: %v", k, err)
+					slog.ErrorContext(ctx, "error encoding stream value", "key", k, "error", err)
 					continue
 				}
 				values[k] = string(data)
@@ -70,82 +183,111 @@ func (w *RedisWrapper) XAdd(ctx context.Context, args *redis.XAddArgs) *redis.St
 		}
 	}
 	args.Values = values
-	return w.client.XAdd(ctx, args)
+	cmd := w.client.XAdd(ctx, args)
+	tracing.End(span, cmd.Err())
+	return cmd
 }
 
+// XRead records a span only for reads that returned entries or failed, so
+// idle blocking reads by the consumer do not flood the trace backend.
 func (w *RedisWrapper) XRead(ctx context.Context, args *redis.XReadArgs) *redis.XStreamSliceCmd {
-	return w.client.XRead(ctx, args)
+	start := time.Now()
+	cmd := w.client.XRead(ctx, args)
+	streams, err := cmd.Result()
+	if err == redis.Nil || (err == nil && len(streams) == 0) {
+		return cmd
+	}
+
+	entries := 0
+	for _, stream := range streams {
+		entries += len(stream.Messages)
+	}
+	_, span := tracing.StartAt(ctx, "redis.XREAD", start,
+		attribute.String("db.system", "redis"),
+		attribute.Int("messaging.batch.message_count", entries),
+	)
+	tracing.End(span, err)
+	return cmd
+}
+
+func (w *RedisWrapper) XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
+	return w.client.XRangeN(ctx, stream, start, stop, count)
 }
 
-func InitDB() error {
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPass := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
+func (w *RedisWrapper) Ping(ctx context.Context) error {
+	return w.client.Ping(ctx).Err()
+}
+
+func (w *RedisWrapper) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return w.client.Eval(ctx, script, keys, args...)
+}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		dbUser, dbPass, dbHost, dbPort, dbName)
+func (w *RedisWrapper) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return w.client.Pipelined(ctx, fn)
+}
 
-	config, err := pgxpool.ParseConfig(connStr)
+// Connect opens a connection pool to Postgres and verifies it is reachable.
+func Connect(ctx context.Context, cfg config.DatabaseConfig) (*DBWrapper, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL())
 	if err != nil {
-		return fmt.Errorf("unable to parse database config: %v", err)
+		return nil, fmt.Errorf("unable to parse database config: %v", err)
 	}
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime.Duration()
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime.Duration()
 
-	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
-		return fmt.Errorf("unable to connect to database: %v", err)
+		return nil, fmt.Errorf("unable to connect to database: %v", err)
 	}
 
-	dbPool = pool
-	log.Println("Successfully connected to database")
-	return nil
+	slog.Info("connected to database", "host", cfg.Host, "database", cfg.Name)
+	return &DBWrapper{pool: pool}, nil
 }
 
-func InitRedis() error {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	redisPass := os.Getenv("REDIS_PASSWORD")
-	redisDB := 0
-
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPass,
-		DB:       redisDB,
-	})
-
-	if err := client.Ping(context.Background()).Err(); err != nil {
-		return fmt.Errorf("unable to connect to Redis: %v", err)
-	}
+func (w *DBWrapper) Close() {
+	w.pool.Close()
+}
 
-	redisClient = client
-	log.Println("Successfully connected to Redis")
-	return nil
+// Ping acquires a connection from the pool and checks the server responds.
+func (w *DBWrapper) Ping(ctx context.Context) error {
+	return w.pool.Ping(ctx)
 }
 
-func CloseDB() {
-	if dbPool != nil {
-		dbPool.Close()
-	}
+// Stat returns connection pool statistics.
+func (w *DBWrapper) Stat() *pgxpool.Stat {
+	return w.pool.Stat()
 }
 
-func CloseRedis() {
-	if redisClient != nil {
-		if err := redisClient.Close(); err != nil {
-			log.Printf("Error closing Redis connection: %v", err)
-		}
+// ConnectRedis creates a Redis client and verifies it is reachable.
+func ConnectRedis(ctx context.Context, cfg config.RedisConfig) (*RedisWrapper, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password.Value(),
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to connect to Redis: %v", err)
 	}
-}
 
-func GetDB() DB {
-	return &DBWrapper{pool: dbPool}
+	slog.Info("connected to Redis", "addr", cfg.Addr)
+	return &RedisWrapper{client: client}, nil
 }
 
-func GetRedis() Redis {
-	return &RedisWrapper{client: redisClient}
+func (w *RedisWrapper) Close() {
+	if err := w.client.Close(); err != nil {
+		slog.Error("error closing Redis connection", "error", err)
+	}
 }
 
 type Rows interface {
 	Close()
 	Next() bool
 	Scan(dest ...interface{}) error
-} 
\ No newline at end of file
+	Err() error
+}
@@ -1,13 +1,49 @@
 package db
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/config"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestInit(t *testing.T) {
-	err := Init()
-	assert.Nil(t, err)
-	Close()
-} 
\ No newline at end of file
+func TestConnectUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg := config.Default().Database
+	cfg.Port = 1
+	_, err := Connect(ctx, cfg)
+	assert.NotNil(t, err)
+}
+
+func TestConnectRedisUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg := config.Default().Redis
+	cfg.Addr = "127.0.0.1:1"
+	_, err := ConnectRedis(ctx, cfg)
+	assert.NotNil(t, err)
+}
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		sql, operation, table string
+	}{
+		{"\n\t\tSELECT sku, quantity\n\t\tFROM stock_levels\n\t\tWHERE sku = $1\n\t", "select", "stock_levels"},
+		{"INSERT INTO inventory_transactions (sku) VALUES ($1)", "insert", "inventory_transactions"},
+		{"UPDATE stock_levels SET quantity = $1", "update", "stock_levels"},
+		{"-- Audit Log\nCREATE TABLE IF NOT EXISTS audit_log (id SERIAL)", "create", "audit_log"},
+		{"SELECT pg_advisory_xact_lock($1)", "select", "none"},
+		{"", "unknown", "none"},
+	}
+	for _, c := range cases {
+		operation, table := describe(c.sql)
+		assert.Equal(t, c.operation, operation, c.sql)
+		assert.Equal(t, c.table, table, c.sql)
+	}
+}
@@ -3,48 +3,115 @@ package events
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"omnichannel_inventory/internal/db"
-	"omnichannel_inventory/internal/webhooks"
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/tracing"
 
 	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	InventoryStream = "inventory_events"
 	EventBufferSize = 100
-	LowStockThreshold = 10
 )
 
+// ConsumerBlock is how long a stream read waits for new events.
+const ConsumerBlock = time.Second
+
 type InventoryEvent struct {
 	SKU         string
 	WarehouseID int
 	Change      int
 	Channel     string
 	Reason      string
+	// RequestID identifies the API request that caused the change.
+	RequestID string
+
+	// spanContext is the trace context of the request that caused the
+	// change, carried through the stream entry's fields
+	spanContext trace.SpanContext
+}
+
+type DB interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error)
+}
+
+type StreamWriter interface {
+	XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd
+}
+
+type Stream interface {
+	StreamWriter
+	XRead(ctx context.Context, args *redis.XReadArgs) *redis.XStreamSliceCmd
+}
+
+type LowStockNotifier interface {
+	NotifyLowStock(ctx context.Context, sku string, warehouseID int, stock int) error
 }
 
 type EventProcessor struct {
-	eventsCh chan InventoryEvent
-	doneCh   chan struct{}
+	db        DB
+	notifier  LowStockNotifier
+	threshold int
+	eventsCh  chan InventoryEvent
+	doneCh    chan struct{}
+	stoppedCh chan struct{}
+	inFlight  sync.WaitGroup
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Status reports the progress of the stream consumer and processor.
+type Status struct {
+	// ConsumerStartedAt is when the consumer began reading new entries.
+	ConsumerStartedAt time.Time `json:"consumer_started_at"`
+	// LastEventID is the ID of the last stream entry handed to the processor.
+	LastEventID string `json:"last_event_id,omitempty"`
+	// LastProcessedAt is when an event was last processed successfully.
+	LastProcessedAt time.Time `json:"last_processed_at"`
+}
+
+func (p *EventProcessor) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
 }
 
-func NewEventProcessor() *EventProcessor {
+func (p *EventProcessor) updateStatus(update func(*Status)) {
+	p.mu.Lock()
+	update(&p.status)
+	p.mu.Unlock()
+}
+
+func NewEventProcessor(db DB, notifier LowStockNotifier, threshold int) *EventProcessor {
 	return &EventProcessor{
-		eventsCh: make(chan InventoryEvent, EventBufferSize),
-		doneCh:   make(chan struct{}),
+		db:        db,
+		notifier:  notifier,
+		threshold: threshold,
+		eventsCh:  make(chan InventoryEvent, EventBufferSize),
+		doneCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
 	}
 }
 
 func (p *EventProcessor) Start(ctx context.Context) {
 	go func() {
+		defer close(p.stoppedCh)
 		for {
 			select {
 			case event := <-p.eventsCh:
-				// Process event asynchronously
-				go p.processEvent(ctx, event)
+				metrics.EventQueueDepth.Set(float64(len(p.eventsCh)))
+				p.dispatch(ctx, event)
 			case <-p.doneCh:
 				return
 			case <-ctx.Done():
@@ -54,114 +121,244 @@ func (p *EventProcessor) Start(ctx context.Context) {
 	}()
 }
 
-func (p *EventProcessor) Stop() {
-	close(p.doneCh)
-}
-
-func (p *EventProcessor) processEvent(ctx context.Context, event InventoryEvent) {
-	log.Printf("Received event: SKU=%s, WarehouseID=%d, Change=%d", event.SKU, event.WarehouseID, event.Change)
-	
-	// Check for low stock and trigger webhook if needed
-	if event.Change < 0 {
-		log.Printf("Processing negative stock change event for SKU %s in warehouse %d", event.SKU, event.WarehouseID)
-		
-		// Get current stock level
-		sql := `
-			SELECT quantity
-			FROM stock_levels
-			WHERE sku = $1 AND warehouse_id = $2
-		`
-		rows, err := db.GetDB().Query(ctx, sql, event.SKU, event.WarehouseID)
+// dispatch processes the event asynchronously, tracking it so Stop can wait
+// for it to finish.
+func (p *EventProcessor) dispatch(ctx context.Context, event InventoryEvent) {
+	p.inFlight.Add(1)
+	go func() {
+		defer p.inFlight.Done()
+		ctx := trace.ContextWithRemoteSpanContext(ctx, event.spanContext)
+		ctx = logging.WithRequestID(ctx, event.RequestID)
+		ctx, span := tracing.Start(ctx, "events.process",
+			attribute.String("sku", event.SKU),
+			attribute.Int("warehouse_id", event.WarehouseID),
+			attribute.Int("change", event.Change),
+		)
+		err := p.processEvent(ctx, event)
+		tracing.End(span, err)
+		metrics.EventsProcessed.WithLabelValues(metrics.Result(err)).Inc()
 		if err != nil {
-			log.Printf("Error querying stock level: %v", err)
+			slog.ErrorContext(ctx, "error processing inventory event",
+				"sku", event.SKU, "warehouse_id", event.WarehouseID, "error", err)
 			return
 		}
-		defer rows.Close()
+		p.updateStatus(func(s *Status) { s.LastProcessedAt = time.Now() })
+	}()
+}
 
-		if rows.Next() {
-			var quantity int
-			if err := rows.Scan(&quantity); err != nil {
-				log.Printf("Error scanning stock level: %v", err)
-				return
-			}
+// Stop stops accepting events, processes any still buffered and waits for
+// in-flight events to finish or ctx to expire. The stream consumer feeding
+// the processor must be stopped first.
+func (p *EventProcessor) Stop(ctx context.Context) error {
+	close(p.doneCh)
+	<-p.stoppedCh
 
-			log.Printf("Current stock for SKU %s in warehouse %d: %d (Threshold: %d)", 
-				event.SKU, event.WarehouseID, quantity, LowStockThreshold)
-			
-			if quantity < LowStockThreshold {
-				log.Printf("Low stock detected! Triggering webhook for SKU %s (Current: %d, Threshold: %d)", 
-					event.SKU, quantity, LowStockThreshold)
-				// Trigger low stock webhook
-				if err := webhooks.NotifyLowStock(event.SKU, event.WarehouseID, quantity); err != nil {
-					log.Printf("Failed to send low stock notification: %v", err)
-				} else {
-					log.Printf("Low stock notification sent successfully")
-				}
-			} else {
-				log.Printf("Stock level (%d) is above threshold (%d), no notification needed", 
-					quantity, LowStockThreshold)
-			}
-		} else {
-			log.Printf("No stock level found for SKU %s in warehouse %d", event.SKU, event.WarehouseID)
-		}
-	} else {
-		log.Printf("Positive stock change, no notification needed")
+	// Events buffered before the consumer stopped are still processed
+	for len(p.eventsCh) > 0 {
+		p.dispatch(ctx, <-p.eventsCh)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *EventProcessor) processEvent(ctx context.Context, event InventoryEvent) error {
+	log := slog.With("sku", event.SKU, "warehouse_id", event.WarehouseID)
+	log.DebugContext(ctx, "received inventory event", "change", event.Change, "channel", event.Channel)
+
+	// Only decreases can take stock below the threshold
+	if event.Change >= 0 {
+		return nil
+	}
+
+	// Get current stock level
+	sql := `
+		SELECT quantity
+		FROM stock_levels
+		WHERE sku = $1 AND warehouse_id = $2
+	`
+	rows, err := p.db.Query(ctx, sql, event.SKU, event.WarehouseID)
+	if err != nil {
+		return fmt.Errorf("error querying stock level: %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		log.WarnContext(ctx, "no stock level found for inventory event")
+		return rows.Err()
+	}
+	var quantity int
+	if err := rows.Scan(&quantity); err != nil {
+		return fmt.Errorf("error scanning stock level: %v", err)
+	}
+
+	if quantity >= p.threshold {
+		log.DebugContext(ctx, "stock above threshold", "stock", quantity, "threshold", p.threshold)
+		return nil
+	}
+
+	// Trigger low stock webhook
+	log.InfoContext(ctx, "low stock detected", "stock", quantity, "threshold", p.threshold)
+	metrics.LowStockAlerts.Inc()
+	if err := p.notifier.NotifyLowStock(ctx, event.SKU, event.WarehouseID, quantity); err != nil {
+		log.ErrorContext(ctx, "failed to queue low stock alert", "error", err)
 	}
+	return nil
 }
 
-func PublishInventoryEvent(ctx context.Context, event InventoryEvent) error {
-	log.Printf("Publishing inventory event: SKU=%s, WarehouseID=%d, Change=%d", event.SKU, event.WarehouseID, event.Change)
-	_, err := db.GetRedis().XAdd(ctx, &redis.XAddArgs{
+func PublishInventoryEvent(ctx context.Context, client StreamWriter, event InventoryEvent) error {
+	values := map[string]interface{}{
+		"sku":          event.SKU,
+		"warehouse_id": event.WarehouseID,
+		"change":       event.Change,
+		"channel":      event.Channel,
+		"reason":       event.Reason,
+		"request_id":   logging.RequestID(ctx),
+	}
+	tracing.Inject(ctx, values)
+	_, err := client.XAdd(ctx, &redis.XAddArgs{
 		Stream: InventoryStream,
-		Values: map[string]interface{}{
-			"sku":          event.SKU,
-			"warehouse_id": event.WarehouseID,
-			"change":       event.Change,
-			"channel":      event.Channel,
-			"reason":       event.Reason,
-		},
+		Values: values,
 	}).Result()
 	if err != nil {
-		log.Printf("Error publishing event to Redis: %v", err)
-	} else {
-		log.Printf("Event published to Redis successfully")
+		return err
 	}
-	return err
+	slog.DebugContext(ctx, "published inventory event",
+		"sku", event.SKU, "warehouse_id", event.WarehouseID, "change", event.Change)
+	return nil
 }
 
-func StartInventoryEventConsumer(ctx context.Context, processor *EventProcessor) {
+// StartInventoryEventConsumer reads the inventory stream and feeds events
+// to the processor until ctx is cancelled. The returned channel is closed
+// once the consumer has stopped.
+func StartInventoryEventConsumer(ctx context.Context, client Stream, processor *EventProcessor) <-chan struct{} {
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		lastID := "$"
+		processor.updateStatus(func(s *Status) { s.ConsumerStartedAt = time.Now() })
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
-				streams, err := db.GetRedis().XRead(ctx, &redis.XReadArgs{
-					Streams: []string{InventoryStream, lastID},
-					Block:   0,
-					Count:   10,
-				}).Result()
-				if err != nil && err != redis.Nil {
-					time.Sleep(time.Second)
-					continue
+			}
+
+			// Block for a bounded time so cancellation is noticed promptly
+			streams, err := client.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{InventoryStream, lastID},
+				Block:   ConsumerBlock,
+				Count:   10,
+			}).Result()
+			if err != nil && err != redis.Nil {
+				if ctx.Err() == nil {
+					slog.WarnContext(ctx, "error reading inventory stream", "error", err)
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
 				}
-				for _, stream := range streams {
-					for _, msg := range stream.Messages {
-						lastID = msg.ID
-						event := InventoryEvent{
-							SKU:         fmt.Sprint(msg.Values["sku"]),
-							WarehouseID: atoi(msg.Values["warehouse_id"]),
-							Change:      atoi(msg.Values["change"]),
-							Channel:     fmt.Sprint(msg.Values["channel"]),
-							Reason:      fmt.Sprint(msg.Values["reason"]),
-						}
-						processor.eventsCh <- event
+				continue
+			}
+			observeRead(streams)
+			for _, stream := range streams {
+				for _, msg := range stream.Messages {
+					lastID = msg.ID
+					event := InventoryEvent{
+						SKU:         fmt.Sprint(msg.Values["sku"]),
+						WarehouseID: atoi(msg.Values["warehouse_id"]),
+						Change:      atoi(msg.Values["change"]),
+						Channel:     fmt.Sprint(msg.Values["channel"]),
+						Reason:      fmt.Sprint(msg.Values["reason"]),
+						RequestID:   str(msg.Values["request_id"]),
+						spanContext: trace.SpanContextFromContext(tracing.Extract(ctx, msg.Values)),
+					}
+					select {
+					case processor.eventsCh <- event:
+						metrics.EventQueueDepth.Set(float64(len(processor.eventsCh)))
+						processor.updateStatus(func(s *Status) { s.LastEventID = msg.ID })
+					case <-ctx.Done():
+						return
 					}
 				}
 			}
 		}
 	}()
+	return done
+}
+
+type StreamRanger interface {
+	XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd
+}
+
+// ConsumerLag returns how long the oldest stream entry the consumer has not
+// read yet has been waiting, or zero if the consumer is caught up.
+func ConsumerLag(ctx context.Context, client StreamRanger, status Status) (time.Duration, error) {
+	// Entries added before the consumer started are never read
+	start := "-"
+	if status.LastEventID != "" {
+		start = "(" + status.LastEventID
+	} else if !status.ConsumerStartedAt.IsZero() {
+		start = strconv.FormatInt(status.ConsumerStartedAt.UnixMilli(), 10)
+	}
+
+	messages, err := client.XRangeN(ctx, InventoryStream, start, "+", 1).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	added, err := entryTime(messages[0].ID)
+	if err != nil {
+		return 0, err
+	}
+	if lag := time.Since(added); lag > 0 {
+		return lag, nil
+	}
+	return 0, nil
+}
+
+// entryTime returns when a stream entry was added, from the millisecond
+// timestamp in its ID.
+func entryTime(id string) (time.Time, error) {
+	millis, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected stream entry ID %q", id)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// observeRead records throughput and lag for a batch read by the consumer.
+// The first entry in a batch is the oldest the consumer had not yet read;
+// an empty read means the consumer is caught up.
+func observeRead(streams []redis.XStream) {
+	var lag time.Duration
+	for _, stream := range streams {
+		metrics.StreamEventsRead.Add(float64(len(stream.Messages)))
+		if len(stream.Messages) > 0 {
+			if added, err := entryTime(stream.Messages[0].ID); err == nil && time.Since(added) > lag {
+				lag = time.Since(added)
+			}
+		}
+	}
+	metrics.StreamConsumerLag.Set(lag.Seconds())
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
 }
 
 func atoi(v interface{}) int {
@@ -175,4 +372,4 @@ func atoi(v interface{}) int {
 	var i int
 	fmt.Sscanf(s, "%d", &i)
 	return i
-} 
\ No newline at end of file
+}
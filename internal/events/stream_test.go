@@ -2,12 +2,65 @@ package events
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
+	"time"
 
+	"omnichannel_inventory/internal/db"
+
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 )
 
+type fakeStream struct {
+	added []*redis.XAddArgs
+}
+
+func (f *fakeStream) XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd {
+	f.added = append(f.added, args)
+	return redis.NewStringResult("1-0", nil)
+}
+
+func (f *fakeStream) XRead(ctx context.Context, args *redis.XReadArgs) *redis.XStreamSliceCmd {
+	return redis.NewXStreamSliceCmdResult(nil, errors.New("not connected"))
+}
+
+type fakeDB struct {
+	quantity int
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error) {
+	return &fakeRows{values: []int{f.quantity}}, nil
+}
+
+type fakeRows struct {
+	values []int
+	pos    int
+}
+
+func (r *fakeRows) Close()     {}
+func (r *fakeRows) Err() error { return nil }
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	reflect.ValueOf(dest[0]).Elem().SetInt(int64(r.values[r.pos-1]))
+	return nil
+}
+
+type fakeNotifier struct {
+	alerts chan int
+}
+
+func (f *fakeNotifier) NotifyLowStock(ctx context.Context, sku string, warehouseID int, stock int) error {
+	f.alerts <- stock
+	return nil
+}
+
 func TestPublishInventoryEvent(t *testing.T) {
+	stream := &fakeStream{}
 	event := InventoryEvent{
 		SKU:         "test",
 		WarehouseID: 1,
@@ -15,12 +68,79 @@ func TestPublishInventoryEvent(t *testing.T) {
 		Channel:     "test",
 		Reason:      "test",
 	}
-	err := PublishInventoryEvent(context.Background(), event)
-	assert.NotNil(t, err) // Redis not connected in test
+	err := PublishInventoryEvent(context.Background(), stream, event)
+	assert.Nil(t, err)
+	assert.Equal(t, InventoryStream, stream.added[0].Stream)
 }
 
 func TestStartInventoryEventConsumer(t *testing.T) {
-	eventsCh := make(chan InventoryEvent)
-	StartInventoryEventConsumer(context.Background(), eventsCh)
-	// Test passes if it doesn't panic
-} 
\ No newline at end of file
+	ctx, cancel := context.WithCancel(context.Background())
+	processor := NewEventProcessor(&fakeDB{}, &fakeNotifier{}, 10)
+	done := StartInventoryEventConsumer(ctx, &fakeStream{}, processor)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not stop after cancellation")
+	}
+}
+
+func TestStopDrainsBufferedEvents(t *testing.T) {
+	notifier := &fakeNotifier{alerts: make(chan int, 2)}
+	processor := NewEventProcessor(&fakeDB{quantity: 3}, notifier, 10)
+
+	// Events queued before the loop picks them up must still be processed
+	processor.eventsCh <- InventoryEvent{SKU: "a", WarehouseID: 1, Change: -1}
+	processor.eventsCh <- InventoryEvent{SKU: "b", WarehouseID: 1, Change: -1}
+	processor.Start(context.Background())
+
+	assert.NoError(t, processor.Stop(context.Background()))
+	assert.Len(t, notifier.alerts, 2)
+}
+
+func TestProcessEventNotifiesLowStock(t *testing.T) {
+	notifier := &fakeNotifier{alerts: make(chan int, 1)}
+	processor := NewEventProcessor(&fakeDB{quantity: 3}, notifier, 10)
+
+	processor.processEvent(context.Background(), InventoryEvent{SKU: "test", WarehouseID: 1, Change: -2})
+	select {
+	case stock := <-notifier.alerts:
+		assert.Equal(t, 3, stock)
+	case <-time.After(time.Second):
+		t.Fatal("expected a low stock notification")
+	}
+
+	processor = NewEventProcessor(&fakeDB{quantity: 30}, notifier, 10)
+	processor.processEvent(context.Background(), InventoryEvent{SKU: "test", WarehouseID: 1, Change: -2})
+	assert.Empty(t, notifier.alerts)
+}
+
+type fakeRanger struct {
+	start string
+}
+
+func (f *fakeRanger) XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
+	f.start = start
+	return redis.NewXMessageSliceCmdResult(nil, nil)
+}
+
+func TestConsumerLagStartsAfterLastEvent(t *testing.T) {
+	ranger := &fakeRanger{}
+	lag, err := ConsumerLag(context.Background(), ranger, Status{ConsumerStartedAt: time.UnixMilli(1000), LastEventID: "1500-0"})
+	assert.NoError(t, err)
+	assert.Zero(t, lag)
+	assert.Equal(t, "(1500-0", ranger.start)
+
+	// Before any event is read, entries added since the consumer started count
+	ConsumerLag(context.Background(), ranger, Status{ConsumerStartedAt: time.UnixMilli(1000)})
+	assert.Equal(t, "1000", ranger.start)
+}
+
+func TestDispatchRecordsProcessedTime(t *testing.T) {
+	processor := NewEventProcessor(&fakeDB{quantity: 30}, &fakeNotifier{}, 10)
+	processor.Start(context.Background())
+	processor.eventsCh <- InventoryEvent{SKU: "a", WarehouseID: 1, Change: -1}
+
+	assert.NoError(t, processor.Stop(context.Background()))
+	assert.False(t, processor.Status().LastProcessedAt.IsZero())
+}
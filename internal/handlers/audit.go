@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List audit entries
+// @Description List audit trail entries, newest first
+// @Tags audit
+// @Produce json
+// @Param sku query string false "Product SKU"
+// @Param actor query string false "Actor identity"
+// @Param reason_code query string false "Reason code"
+// @Param from query string false "RFC 3339 lower bound"
+// @Param to query string false "RFC 3339 upper bound"
+// @Param limit query int false "Maximum number of entries"
+// @Success 200 {object} []models.AuditEntry
+// @Router /api/audit [get]
+func ListAuditEntries(c *gin.Context) {
+	filter := models.AuditFilter{
+		SKU:        c.Query("sku"),
+		Actor:      c.Query("actor"),
+		ReasonCode: c.Query("reason_code"),
+	}
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(c, services.Invalid("from", "must be an RFC 3339 timestamp"))
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(c, services.Invalid("to", "must be an RFC 3339 timestamp"))
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			respondError(c, services.Invalid("limit", "must be a positive integer"))
+			return
+		}
+	}
+
+	entries, err := inventoryService.ListAuditEntries(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// @Summary Verify the audit chain
+// @Description Recompute the audit hash chain and report the first tampered entry
+// @Tags audit
+// @Produce json
+// @Success 200 {object} models.AuditVerification
+// @Router /api/audit/verify [get]
+func VerifyAuditChain(c *gin.Context) {
+	result, err := inventoryService.VerifyAuditChain(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
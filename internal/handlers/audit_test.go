@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListAuditEntries(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	ListAuditEntries(newJSONContext(w, http.MethodGet, "/api/audit?sku=test", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	ListAuditEntries(newJSONContext(w, http.MethodGet, "/api/audit?limit=-1", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	ListAuditEntries(newJSONContext(w, http.MethodGet, "/api/audit?from=monday", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	VerifyAuditChain(newJSONContext(w, http.MethodGet, "/api/audit/verify", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"valid":true,"entries_checked":0}`, w.Body.String())
+}
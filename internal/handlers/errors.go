@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"omnichannel_inventory/internal/problem"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError writes err as a problem details response. Typed service
+// errors map to their own status and code; anything else is logged and
+// reported as an internal error without exposing its message.
+func respondError(c *gin.Context, err error) {
+	var (
+		validation  *services.ValidationError
+		notFound    *services.NotFoundError
+		shortage    *services.InsufficientStockError
+		conflict    *services.ConflictError
+		unavailable *services.UnavailableError
+		p           *problem.Problem
+	)
+	switch {
+	case errors.As(err, &validation):
+		p = problem.New(http.StatusBadRequest, problem.CodeValidation, "The request contains invalid fields.")
+		for _, f := range validation.Fields {
+			p.Errors = append(p.Errors, problem.FieldError{Field: f.Field, Message: f.Message})
+		}
+	case errors.As(err, &notFound):
+		p = problem.New(http.StatusNotFound, problem.CodeNotFound, notFound.Error())
+	case errors.As(err, &shortage):
+		p = problem.New(http.StatusConflict, problem.CodeInsufficientStock, shortage.Error())
+		p.Extensions = map[string]interface{}{
+			"sku":       shortage.SKU,
+			"requested": shortage.Requested,
+			"available": shortage.Available,
+			"shortfall": shortage.Shortfall(),
+		}
+	case errors.As(err, &conflict):
+		slog.WarnContext(c.Request.Context(), "request conflicted with a concurrent change", "error", err)
+		p = problem.New(http.StatusConflict, problem.CodeConflict, "The request conflicted with a concurrent change. Retry it.")
+	case errors.As(err, &unavailable):
+		slog.ErrorContext(c.Request.Context(), "dependency unavailable", "error", err)
+		p = problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "A dependency is temporarily unavailable. Retry later.")
+		c.Header("Retry-After", "1")
+	default:
+		slog.ErrorContext(c.Request.Context(), "request failed", "error", err)
+		p = problem.New(http.StatusInternalServerError, problem.CodeInternal, "An internal error occurred.")
+	}
+	problem.Abort(c, p)
+}
+
+// bindJSON decodes the request body into obj, converting decoding failures
+// into validation errors that name the offending field.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return nil
+	}
+	var (
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return services.Invalid(typeErr.Field, fmt.Sprintf("must be of type %s", typeErr.Type))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return services.Invalid("body", "must be valid JSON")
+	case errors.Is(err, io.EOF):
+		return services.Invalid("body", "is required")
+	}
+	return services.Invalid("body", err.Error())
+}
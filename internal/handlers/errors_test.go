@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"omnichannel_inventory/internal/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespondErrorHidesInternalErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/audit", "")
+	c.Header(RequestIDHeader, "req-1")
+
+	respondError(c, errors.New(`relation "audit_log" does not exist`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "audit_log")
+	assert.Contains(t, w.Body.String(), `"code":"internal_error"`)
+	assert.Contains(t, w.Body.String(), `"request_id":"req-1"`)
+	assert.True(t, c.IsAborted())
+}
+
+func TestRespondErrorStatuses(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{services.Invalid("sku", "is required"), http.StatusBadRequest, "validation_failed"},
+		{&services.NotFoundError{Resource: "SKU", ID: "test"}, http.StatusNotFound, "not_found"},
+		{&services.ConflictError{Err: errors.New("serialization failure")}, http.StatusConflict, "conflict"},
+		{&services.UnavailableError{Err: errors.New("dial tcp: connection refused")}, http.StatusServiceUnavailable, "service_unavailable"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		respondError(newJSONContext(w, http.MethodGet, "/api/stock/test", ""), tc.err)
+		assert.Equal(t, tc.status, w.Code, tc.code)
+		assert.Contains(t, w.Body.String(), `"code":"`+tc.code+`"`)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeDB answers Query calls from canned results keyed by a fragment of the
+// SQL text, records their arguments and accepts and records every Exec.
+type fakeDB struct {
+	results   map[string][][]interface{}
+	queryArgs [][]interface{}
+	execs     []fakeExec
+}
+
+type fakeExec struct {
+	sql  string
+	args []interface{}
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	f.execs = append(f.execs, fakeExec{sql: sql, args: args})
+	return nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error) {
+	f.queryArgs = append(f.queryArgs, args)
+	for fragment, rows := range f.results {
+		if strings.Contains(sql, fragment) {
+			return &fakeRows{rows: rows, pos: -1}, nil
+		}
+	}
+	return &fakeRows{pos: -1}, nil
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (db.Tx, error) {
+	return &fakeTx{f}, nil
+}
+
+type fakeTx struct {
+	*fakeDB
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error { return nil }
+
+func (t *fakeTx) Rollback(ctx context.Context) error { return nil }
+
+type fakeRows struct {
+	rows [][]interface{}
+	pos  int
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.rows[r.pos][i]))
+	}
+	return nil
+}
+
+type fakeRedis struct{}
+
+func (fakeRedis) Publish(ctx context.Context, channel string, message interface{}) error {
+	return nil
+}
+
+func (fakeRedis) XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd {
+	return redis.NewStringResult("1-0", nil)
+}
+
+func useFakeService(results map[string][][]interface{}) {
+	SetInventoryService(services.NewInventoryService(&fakeDB{results: results}, fakeRedis{}))
+}
@@ -3,19 +3,18 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"omnichannel_inventory/internal/auth"
 	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/problem"
 	"omnichannel_inventory/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-var (
-	ErrInvalidSKU         = errors.New("invalid SKU")
-	ErrInvalidWarehouseID = errors.New("invalid warehouse ID")
-	ErrInvalidQuantity    = errors.New("invalid quantity")
-	ErrInvalidChannel     = errors.New("invalid channel")
-)
+var ErrWarehouseForbidden = errors.New("not permitted to change stock in this warehouse")
 
 var inventoryService *services.InventoryService
 
@@ -33,27 +32,20 @@ func SetInventoryService(service *services.InventoryService) {
 // @Router /inventory/add_or_update [post]
 func AddOrUpdateStock(c *gin.Context) {
 	var update models.StockUpdate
-	if err := c.ShouldBindJSON(&update); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &update); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// Validate input
-	if update.SKU == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidSKU.Error()})
-		return
-	}
-	if update.WarehouseID <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWarehouseID.Error()})
-		return
-	}
-	if update.Quantity == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidQuantity.Error()})
+	// Warehouse operators may only adjust their own warehouses
+	if p := auth.FromContext(c.Request.Context()); p == nil || !p.CanAccessWarehouse(update.WarehouseID) {
+		problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeForbidden, ErrWarehouseForbidden.Error()))
 		return
 	}
 
+	// The service validates the update and reports every invalid field
 	if err := inventoryService.AddOrUpdateStock(c.Request.Context(), update); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -61,30 +53,85 @@ func AddOrUpdateStock(c *gin.Context) {
 }
 
 // @Summary Get consolidated stock for a product
-// @Description Get consolidated stock for a product across all warehouses
+// @Description Get consolidated stock for a product across all warehouses. The stock of a kit is derived from its components. Stock still outstanding on open purchase orders is reported as incoming.
 // @Tags inventory
 // @Produce json
 // @Param sku path string true "Product SKU"
-// @Success 200 {object} []models.StockLevel
+// @Param as_of query string false "RFC 3339 timestamp to reconstruct stock at"
+// @Param unit query string false "Unit of measure to report quantities in"
+// @Success 200 {object} models.StockSummary
 // @Router /inventory/stock/{sku} [get]
 func GetConsolidatedStock(c *gin.Context) {
 	sku := c.Param("sku")
 	if sku == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidSKU.Error()})
+		respondError(c, services.Invalid("sku", "is required"))
 		return
 	}
 
-	levels, err := inventoryService.GetConsolidatedStock(c.Request.Context(), sku)
+	var summary models.StockSummary
+	var err error
+	if asOfParam := c.Query("as_of"); asOfParam != "" {
+		asOf, parseErr := time.Parse(time.RFC3339, asOfParam)
+		if parseErr != nil {
+			respondError(c, services.Invalid("as_of", "must be an RFC 3339 timestamp"))
+			return
+		}
+		summary, err = inventoryService.GetStockSummaryAsOf(c.Request.Context(), sku, asOf)
+	} else {
+		summary, err = inventoryService.GetConsolidatedStock(c.Request.Context(), sku)
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if unit := c.Query("unit"); unit != "" {
+		converted, err := inventoryService.StockSummariesInUnit(c.Request.Context(), []models.StockSummary{summary}, unit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, converted[0])
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetStockSummaries returns consolidated stock for up to 100 comma-separated
+// SKUs, in the order given. It serves GET /api/stock when skus is present;
+// see ListStock.
+func GetStockSummaries(c *gin.Context) {
+	var skus []string
+	seen := map[string]bool{}
+	for _, sku := range strings.Split(c.Query("skus"), ",") {
+		if sku = strings.TrimSpace(sku); sku != "" && !seen[sku] {
+			seen[sku] = true
+			skus = append(skus, sku)
+		}
+	}
+
+	summaries, err := inventoryService.GetStockSummaries(c.Request.Context(), skus)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, levels)
+	if unit := c.Query("unit"); unit != "" {
+		converted, err := inventoryService.StockSummariesInUnit(c.Request.Context(), summaries, unit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, converted)
+		return
+	}
+
+	c.JSON(http.StatusOK, summaries)
 }
 
 // @Summary Simulate an order event
-// @Description Simulate an order event from a sales channel
+// @Description Simulate an order event from a sales channel. The response lists the warehouses, lots and serials the order was taken from; orders for a kit list the components taken.
 // @Tags inventory
 // @Accept json
 // @Produce json
@@ -93,35 +140,18 @@ func GetConsolidatedStock(c *gin.Context) {
 // @Router /inventory/order [post]
 func SimulateOrder(c *gin.Context) {
 	var order models.Order
-	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &order); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// Validate input
-	if order.SKU == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidSKU.Error()})
-		return
-	}
-	if order.Channel == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidChannel.Error()})
-		return
-	}
-	if order.Quantity <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidQuantity.Error()})
-		return
-	}
-
-	if err := inventoryService.SimulateOrder(c.Request.Context(), order); err != nil {
-		if err.Error() == "insufficient stock" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+	allocations, err := inventoryService.SimulateOrder(c.Request.Context(), order)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "order processed successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "order processed successfully", "allocations": allocations})
 }
 
 // @Summary Get inventory history for a product
@@ -134,15 +164,15 @@ func SimulateOrder(c *gin.Context) {
 func GetInventoryHistory(c *gin.Context) {
 	sku := c.Param("sku")
 	if sku == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidSKU.Error()})
+		respondError(c, services.Invalid("sku", "is required"))
 		return
 	}
 
 	transactions, err := inventoryService.GetInventoryHistory(c.Request.Context(), sku)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, transactions)
-} 
\ No newline at end of file
+}
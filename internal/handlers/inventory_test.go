@@ -3,38 +3,161 @@ package handlers
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/problem"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
+// newJSONContext builds a request context authenticated as an admin.
+func newJSONContext(w *httptest.ResponseRecorder, method, target, body string) *gin.Context {
+	return newContextAs(w, method, target, body, &auth.Principal{Subject: "tester", Role: auth.RoleAdmin})
+}
+
+func newContextAs(w *httptest.ResponseRecorder, method, target, body string, p *auth.Principal) *gin.Context {
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+	return c
+}
+
 func TestAddOrUpdateStock(t *testing.T) {
+	useFakeService(nil)
+
 	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	AddOrUpdateStock(c)
-	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	AddOrUpdateStock(newJSONContext(w, http.MethodPost, "/api/stock", `{"sku":"test","warehouse_id":0,"quantity":5}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	AddOrUpdateStock(newJSONContext(w, http.MethodPost, "/api/stock", `{"sku":"test","warehouse_id":1,"quantity":5}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	AddOrUpdateStock(newJSONContext(w, http.MethodPost, "/api/stock", `{"sku":"test","warehouse_id":1,"quantity":5,"reason_code":"bogus"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAddOrUpdateStockWarehouseScope(t *testing.T) {
+	useFakeService(nil)
+	operator := &auth.Principal{Subject: "op", Role: auth.RoleWarehouseOperator, Warehouses: []int{2}}
+
+	w := httptest.NewRecorder()
+	AddOrUpdateStock(newContextAs(w, http.MethodPost, "/api/stock", `{"sku":"test","warehouse_id":1,"quantity":5}`, operator))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	AddOrUpdateStock(newContextAs(w, http.MethodPost, "/api/stock", `{"sku":"test","warehouse_id":2,"quantity":5}`, operator))
+	assert.Equal(t, http.StatusOK, w.Code)
 }
 
 func TestGetConsolidatedStock(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"FROM stock_levels":   {{1, "Main", "Berlin", 5}},
+		"stock_snapshot_runs": {{"test", 1, 3}},
+		"FROM warehouses":     {{1, "Main", "Berlin"}},
+	})
+
 	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
+	c := newJSONContext(w, http.MethodGet, "/api/stock/test", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
+	GetConsolidatedStock(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"sku": "test",
+		"on_hand": 5,
+		"available": 5,
+		"warehouses": [{"warehouse_id": 1, "name": "Main", "location": "Berlin", "on_hand": 5, "available": 5}]
+	}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	c = newJSONContext(w, http.MethodGet, "/api/stock/test?as_of=2024-01-31T23:59:59Z", "")
 	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
 	GetConsolidatedStock(c)
-	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"sku": "test",
+		"on_hand": 3,
+		"available": 3,
+		"warehouses": [{"warehouse_id": 1, "name": "Main", "location": "Berlin", "on_hand": 3, "available": 3}]
+	}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	c = newJSONContext(w, http.MethodGet, "/api/stock/test?as_of=yesterday", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
+	GetConsolidatedStock(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	c = newJSONContext(w, http.MethodGet, "/api/stock/unknown", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "unknown"}}
+	useFakeService(nil)
+	GetConsolidatedStock(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"not_found"`)
+}
+
+func TestGetStockSummaries(t *testing.T) {
+	useFakeService(map[string][][]interface{}{"FROM stock_levels": {{1, "Main", "Berlin", 5}}})
+
+	w := httptest.NewRecorder()
+	GetStockSummaries(newJSONContext(w, http.MethodGet, "/api/stock?skus=a,%20b,a", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sku":"a"`)
+	assert.Contains(t, w.Body.String(), `"sku":"b"`)
+	assert.Equal(t, 2, strings.Count(w.Body.String(), `"on_hand":5,"available":5,"warehouses"`), "duplicates are dropped")
+
+	w = httptest.NewRecorder()
+	GetStockSummaries(newJSONContext(w, http.MethodGet, "/api/stock?skus=", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 func TestSimulateOrder(t *testing.T) {
+	useFakeService(nil)
+
 	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	SimulateOrder(c)
-	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	SimulateOrder(newJSONContext(w, http.MethodPost, "/api/orders/simulate", `{"sku":"test","channel":"amazon","quantity":1}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:omnichannel-inventory:problem:insufficient_stock",
+		"title": "Insufficient stock",
+		"status": 409,
+		"detail": "insufficient stock for SKU test: requested 1, available 0",
+		"instance": "/api/orders/simulate",
+		"code": "insufficient_stock",
+		"sku": "test",
+		"requested": 1,
+		"available": 0,
+		"shortfall": 1
+	}`, w.Body.String())
+}
+
+func TestSimulateOrderValidation(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	SimulateOrder(newJSONContext(w, http.MethodPost, "/api/orders/simulate", `{"sku":"","channel":"amazon","quantity":0}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"validation_failed"`)
+	assert.Contains(t, w.Body.String(), `"errors":[{"field":"sku","message":"is required"},{"field":"quantity","message":"must be a positive integer"}]`)
+
+	w = httptest.NewRecorder()
+	SimulateOrder(newJSONContext(w, http.MethodPost, "/api/orders/simulate", `{"sku":"test","channel":"amazon","quantity":"two"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"quantity","message":"must be of type int"}`)
 }
 
 func TestGetInventoryHistory(t *testing.T) {
+	useFakeService(nil)
+
 	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
+	c := newJSONContext(w, http.MethodGet, "/api/history/test", "")
 	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
 	GetInventoryHistory(c)
-	assert.Equal(t, http.StatusNotImplemented, w.Code)
-} 
\ No newline at end of file
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Check ledger consistency
+// @Description Compare transaction ledger totals with current stock levels and report drift
+// @Tags ledger
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ledger/consistency [get]
+func CheckLedgerConsistency(c *gin.Context) {
+	drifts, err := inventoryService.CheckLedgerConsistency(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"consistent": len(drifts) == 0,
+		"drift":      drifts,
+	})
+}
+
+// @Summary Create a stock snapshot
+// @Description Materialise ledger totals for all SKUs as of now
+// @Tags ledger
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ledger/snapshots [post]
+func CreateStockSnapshot(c *gin.Context) {
+	at := time.Now().Add(-services.SnapshotLag)
+	if err := inventoryService.CreateStockSnapshot(c.Request.Context(), at); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "snapshot created successfully",
+		"snapshot_at": at.Format(time.RFC3339),
+	})
+}
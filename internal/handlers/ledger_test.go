@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLedgerConsistency(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"FULL OUTER JOIN stock_levels": {{"test", 1, 8, 10}},
+	})
+
+	w := httptest.NewRecorder()
+	CheckLedgerConsistency(newJSONContext(w, http.MethodGet, "/api/ledger/consistency", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"consistent":false,"drift":[{"sku":"test","warehouse_id":1,"ledger_quantity":8,"stock_quantity":10,"drift":2}]}`, w.Body.String())
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStockListLimit is the page size of JSON stock listings. CSV
+// exports default to the largest page, services.MaxStockListLimit, and are
+// paged with offset like JSON listings.
+const defaultStockListLimit = 50
+
+// @Summary List stock
+// @Description List stock per SKU and warehouse with filters, sorting and pagination, as JSON or CSV. With skus, returns stock summaries instead.
+// @Tags inventory
+// @Produce json
+// @Produce text/csv
+// @Param skus query string false "Comma-separated product SKUs; returns summaries"
+// @Param warehouse_id query string false "Comma-separated warehouse IDs; defaults to the caller's assigned warehouses"
+// @Param sku_prefix query string false "SKU prefix"
+// @Param q query string false "Product name contains, case-insensitive"
+// @Param min_quantity query int false "Minimum quantity"
+// @Param max_quantity query int false "Maximum quantity"
+// @Param below_threshold query bool false "Only stock below the low stock threshold"
+// @Param zero_stock query bool false "Only stock of exactly zero"
+// @Param sort query string false "sku, quantity, warehouse_id or product_name; prefix with - to sort descending"
+// @Param limit query int false "Page size, at most 500; defaults to 50, or 500 for CSV"
+// @Param offset query int false "Rows to skip"
+// @Param unit query string false "Also report quantities in this unit of measure, for SKUs that define it"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} models.StockPage
+// @Router /api/stock [get]
+func ListStock(c *gin.Context) {
+	if _, ok := c.GetQuery("skus"); ok {
+		GetStockSummaries(c)
+		return
+	}
+
+	asCSV := c.Query("format") == "csv" || (c.Query("format") == "" && strings.Contains(c.GetHeader("Accept"), "text/csv"))
+	filter, err := parseStockFilter(c, asCSV)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	// Staff assigned to warehouses see their own stock unless they ask for others
+	if p := auth.FromContext(c.Request.Context()); p != nil && len(filter.WarehouseIDs) == 0 {
+		filter.WarehouseIDs = p.Warehouses
+	}
+
+	page, err := inventoryService.ListStock(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if asCSV {
+		// Exports are paged, so tell the caller how many rows match
+		c.Header("X-Total-Count", strconv.Itoa(page.Total))
+		writeStockCSV(c, page.Items, filter.Unit != "")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func parseStockFilter(c *gin.Context, asCSV bool) (models.StockFilter, error) {
+	filter := models.StockFilter{
+		SKUPrefix:   c.Query("sku_prefix"),
+		ProductName: c.Query("q"),
+		Sort:        c.Query("sort"),
+		Unit:        c.Query("unit"),
+	}
+	filter.Limit = defaultStockListLimit
+	if asCSV {
+		filter.Limit = services.MaxStockListLimit
+	}
+
+	invalid := &services.ValidationError{}
+	reject := func(field, message string) {
+		invalid.Fields = append(invalid.Fields, services.FieldError{Field: field, Message: message})
+	}
+	integer := func(field string) *int {
+		v, ok := c.GetQuery(field)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			reject(field, "must be an integer")
+			return nil
+		}
+		return &n
+	}
+	boolean := func(field string) bool {
+		v, ok := c.GetQuery(field)
+		if !ok {
+			return false
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			reject(field, "must be true or false")
+		}
+		return b
+	}
+
+	if v := c.Query("warehouse_id"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				reject("warehouse_id", "must be a comma-separated list of warehouse IDs")
+				break
+			}
+			filter.WarehouseIDs = append(filter.WarehouseIDs, id)
+		}
+	}
+	filter.MinQuantity = integer("min_quantity")
+	filter.MaxQuantity = integer("max_quantity")
+	filter.BelowThreshold = boolean("below_threshold")
+	filter.ZeroStock = boolean("zero_stock")
+	if limit := integer("limit"); limit != nil {
+		if *limit <= 0 {
+			reject("limit", "must be a positive integer")
+		}
+		filter.Limit = *limit
+	}
+	if offset := integer("offset"); offset != nil {
+		filter.Offset = *offset
+	}
+	if format := c.Query("format"); format != "" && format != "json" && format != "csv" {
+		reject("format", "must be json or csv")
+	}
+
+	if len(invalid.Fields) > 0 {
+		return filter, invalid
+	}
+	return filter, nil
+}
+
+// csvSafe stops spreadsheet applications from evaluating text cells that
+// look like formulas.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeStockCSV writes items as CSV, with unit and unit_quantity columns
+// when a unit was requested. unit_quantity is empty for SKUs that do not
+// define the unit.
+func writeStockCSV(c *gin.Context, items []models.StockListItem, withUnit bool) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="stock.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	header := []string{"sku", "product_name", "warehouse_id", "warehouse_name", "warehouse_location", "quantity"}
+	if withUnit {
+		header = append(header, "unit", "unit_quantity")
+	}
+	w.Write(header)
+	for _, item := range items {
+		record := []string{
+			csvSafe(item.SKU),
+			csvSafe(item.ProductName),
+			strconv.Itoa(item.WarehouseID),
+			csvSafe(item.WarehouseName),
+			csvSafe(item.WarehouseLocation),
+			strconv.Itoa(item.Quantity),
+		}
+		if withUnit {
+			var quantity string
+			if item.UnitQuantity != nil {
+				quantity = strconv.FormatFloat(*item.UnitQuantity, 'f', -1, 64)
+			}
+			record = append(record, item.Unit, quantity)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+}
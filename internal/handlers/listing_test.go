@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListStock(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"COUNT(*)":        {{1}},
+		"COALESCE(p.name": {{"test", "=HYPERLINK(1)", 1, "Main", "Berlin", 5}},
+	})
+
+	w := httptest.NewRecorder()
+	ListStock(newJSONContext(w, http.MethodGet, "/api/stock?warehouse_id=1&sort=-quantity", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"items": [{"sku":"test","product_name":"=HYPERLINK(1)","warehouse_id":1,"warehouse_name":"Main","warehouse_location":"Berlin","quantity":5}],
+		"total": 1,
+		"limit": 50,
+		"offset": 0
+	}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	ListStock(newJSONContext(w, http.MethodGet, "/api/stock?format=csv", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "sku,product_name,warehouse_id,warehouse_name,warehouse_location,quantity\n"+
+		"test,'=HYPERLINK(1),1,Main,Berlin,5\n", w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+}
+
+func TestListStockCSVIsPaged(t *testing.T) {
+	fdb := &fakeDB{}
+	SetInventoryService(services.NewInventoryService(fdb, fakeRedis{}))
+
+	w := httptest.NewRecorder()
+	ListStock(newJSONContext(w, http.MethodGet, "/api/stock?format=csv", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, fdb.queryArgs, 2)
+	assert.Equal(t, []interface{}{services.MaxStockListLimit}, fdb.queryArgs[1], "exports default to the largest page")
+
+	w = httptest.NewRecorder()
+	ListStock(newJSONContext(w, http.MethodGet, "/api/stock?format=csv&limit=501", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListStockCSVInUnit(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"COALESCE(p.name": {{"a", "Soda", 1, "Main", "", 30, 24}, {"b", "Chips", 1, "Main", "", 5, 0}},
+	})
+
+	w := httptest.NewRecorder()
+	ListStock(newJSONContext(w, http.MethodGet, "/api/stock?format=csv&unit=case", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sku,product_name,warehouse_id,warehouse_name,warehouse_location,quantity,unit,unit_quantity\n"+
+		"a,Soda,1,Main,,30,case,1.25\n"+
+		"b,Chips,1,Main,,5,,\n", w.Body.String())
+}
+
+func TestListStockDefaultsToAssignedWarehouses(t *testing.T) {
+	fdb := &fakeDB{}
+	SetInventoryService(services.NewInventoryService(fdb, fakeRedis{}))
+	operator := &auth.Principal{Subject: "op", Role: auth.RoleWarehouseOperator, Warehouses: []int{2}}
+
+	w := httptest.NewRecorder()
+	ListStock(newContextAs(w, http.MethodGet, "/api/stock", "", operator))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int{2}, fdb.queryArgs[0][0])
+
+	w = httptest.NewRecorder()
+	ListStock(newContextAs(w, http.MethodGet, "/api/stock?warehouse_id=3", "", operator))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int{3}, fdb.queryArgs[2][0])
+}
+
+func TestListStockValidation(t *testing.T) {
+	useFakeService(nil)
+
+	for _, query := range []string{"warehouse_id=main", "min_quantity=x", "zero_stock=maybe", "limit=0", "sort=price", "format=xml"} {
+		w := httptest.NewRecorder()
+		ListStock(newJSONContext(w, http.MethodGet, "/api/stock?"+query, ""))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/problem"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// warehouseParam parses the warehouse ID in the request path.
+func warehouseParam(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, services.Invalid("id", "must be a positive integer")
+	}
+	return id, nil
+}
+
+// @Summary Create a warehouse location
+// @Description Add a zone, aisle or bin to a warehouse, optionally under the location at the parent path
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param id path int true "Warehouse ID"
+// @Param request body models.NewLocation true "Location"
+// @Success 200 {object} models.Location
+// @Router /api/warehouses/{id}/locations [post]
+func CreateLocation(c *gin.Context) {
+	warehouseID, err := warehouseParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var loc models.NewLocation
+	if err := bindJSON(c, &loc); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	created, err := inventoryService.CreateLocation(c.Request.Context(), warehouseID, loc)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+// @Summary List warehouse locations
+// @Description List the locations of a warehouse in path order with the stock held in each, including the bins beneath it
+// @Tags locations
+// @Produce json
+// @Param id path int true "Warehouse ID"
+// @Param sku query string false "Count the stock of one product SKU only"
+// @Success 200 {object} []models.Location
+// @Router /api/warehouses/{id}/locations [get]
+func ListLocations(c *gin.Context) {
+	warehouseID, err := warehouseParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	locations, err := inventoryService.ListLocations(c.Request.Context(), warehouseID, c.Query("sku"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, locations)
+}
+
+// @Summary Get the bin stock of a product
+// @Description Get the stock of a product in each warehouse broken down by bin, with the stock not yet put away
+// @Tags locations
+// @Produce json
+// @Param sku path string true "Product SKU"
+// @Success 200 {object} []models.WarehouseBins
+// @Router /api/stock/{sku}/bins [get]
+func GetBinStock(c *gin.Context) {
+	sku := c.Param("sku")
+	if sku == "" {
+		respondError(c, services.Invalid("sku", "is required"))
+		return
+	}
+
+	warehouses, err := inventoryService.GetBinStock(c.Request.Context(), sku)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, warehouses)
+}
+
+// @Summary Put stock away
+// @Description Move stock that has not been put away into a bin
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param request body models.BinMove true "Put-away"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/stock/put-away [post]
+func PutAway(c *gin.Context) {
+	moveBinStock(c, inventoryService.PutAway, "stock put away successfully")
+}
+
+// @Summary Move stock between bins
+// @Description Move stock from one bin of a warehouse to another
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param request body models.BinMove true "Bin move"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/stock/bin-moves [post]
+func MoveBinStock(c *gin.Context) {
+	moveBinStock(c, inventoryService.MoveBinStock, "stock moved successfully")
+}
+
+func moveBinStock(c *gin.Context, move func(ctx context.Context, move models.BinMove) error, message string) {
+	var m models.BinMove
+	if err := bindJSON(c, &m); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// Warehouse operators may only move stock in their own warehouses
+	if p := auth.FromContext(c.Request.Context()); p == nil || !p.CanAccessWarehouse(m.WarehouseID) {
+		problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeForbidden, ErrWarehouseForbidden.Error()))
+		return
+	}
+
+	if err := move(c.Request.Context(), m); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
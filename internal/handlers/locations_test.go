@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"omnichannel_inventory/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateLocationRejectsBadWarehouseID(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodPost, "/api/warehouses/main/locations", `{"kind": "bin", "code": "B1"}`)
+	c.Params = []gin.Param{{Key: "id", Value: "main"}}
+	CreateLocation(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPutAwayChecksWarehouseAccess(t *testing.T) {
+	useFakeService(nil)
+	operator := &auth.Principal{Subject: "op", Role: auth.RoleWarehouseOperator, Warehouses: []int{2}}
+
+	w := httptest.NewRecorder()
+	c := newContextAs(w, http.MethodPost, "/api/stock/put-away", `{"sku": "test", "warehouse_id": 1, "to_bin": "A/01", "quantity": 1}`, operator)
+	PutAway(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGetBinStockNotFound(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/stock/test/bins", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
+	GetBinStock(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get the lots of a product
+// @Description Get the stocked lots of a product with their expiry dates and warehouses, soonest expiry first
+// @Tags lots
+// @Produce json
+// @Param sku path string true "Product SKU"
+// @Success 200 {object} []models.Lot
+// @Router /api/stock/{sku}/lots [get]
+func GetLots(c *gin.Context) {
+	sku := c.Param("sku")
+	if sku == "" {
+		respondError(c, services.Invalid("sku", "is required"))
+		return
+	}
+
+	lots, err := inventoryService.GetLots(c.Request.Context(), sku)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lots)
+}
+
+// @Summary Trace a lot
+// @Description Locate a lot across warehouses and list every stock movement recorded against it
+// @Tags lots
+// @Produce json
+// @Param lot_number path string true "Lot number"
+// @Param sku query string false "Limit the trace to one product SKU"
+// @Success 200 {object} []models.LotTrace
+// @Router /api/lots/{lot_number} [get]
+func TraceLot(c *gin.Context) {
+	lotNumber := c.Param("lot_number")
+	if lotNumber == "" {
+		respondError(c, services.Invalid("lot_number", "is required"))
+		return
+	}
+
+	traces, err := inventoryService.TraceLot(c.Request.Context(), lotNumber, c.Query("sku"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, traces)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLots(t *testing.T) {
+	useFakeService(map[string][][]interface{}{"JOIN lot_stock": {{7, "test", "L1", "", "2025-01-31", 1, "Main", 3}}})
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/stock/test/lots", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
+	GetLots(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{
+		"id": 7, "sku": "test", "lot_number": "L1", "expires_on": "2025-01-31", "quantity": 3,
+		"warehouses": [{"warehouse_id": 1, "name": "Main", "quantity": 3}]
+	}]`, w.Body.String())
+}
+
+func TestTraceLotNotFound(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/lots/L1", "")
+	c.Params = []gin.Param{{Key: "lot_number", Value: "L1"}}
+	TraceLot(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
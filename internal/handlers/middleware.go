@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits caller-supplied request IDs to a character set safe
+// for logs and to a length the audit trail can store; anything else is
+// replaced with a generated ID.
+var validRequestID = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9._-]{1,%d}$`, audit.MaxRequestIDLength))
+
+// RequestMetadata attaches a request ID and the client address to the
+// request context so that services can record them in the audit trail and
+// every log record for the request carries the ID.
+func RequestMetadata() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := audit.WithMetadata(c.Request.Context(), audit.Metadata{
+			RequestID: requestID,
+			SourceIP:  c.ClientIP(),
+		})
+		ctx = logging.WithRequestID(ctx, requestID)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestMetadata(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestMetadata())
+
+	var meta audit.Metadata
+	var logID string
+	router.GET("/", func(c *gin.Context) {
+		meta = audit.FromContext(c.Request.Context())
+		logID = logging.RequestID(c.Request.Context())
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "req-1", meta.RequestID)
+	assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, "192.0.2.1", meta.SourceIP)
+	assert.Equal(t, audit.AnonymousActor, meta.Actor)
+	assert.Equal(t, "req-1", logID)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, meta.RequestID, 32)
+	assert.Equal(t, meta.RequestID, w.Header().Get(RequestIDHeader))
+
+	// IDs that could corrupt logs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nforged")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, meta.RequestID, 32)
+}
+
+func TestRequestMetadataReplacesIDsTooLongToAudit(t *testing.T) {
+	fdb := &fakeDB{}
+	SetInventoryService(services.NewInventoryService(fdb, fakeRedis{}))
+	router := gin.New()
+	router.Use(RequestMetadata(), func(c *gin.Context) {
+		admin := &auth.Principal{Subject: "tester", Role: auth.RoleAdmin}
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), admin))
+	})
+	router.POST("/api/stock", AddOrUpdateStock)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/stock", strings.NewReader(`{"sku":"test","warehouse_id":1,"quantity":5}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RequestIDHeader, strings.Repeat("a", 128))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	requestID := w.Header().Get(RequestIDHeader)
+	assert.Len(t, requestID, 32)
+
+	var audited []interface{}
+	for _, e := range fdb.execs {
+		if strings.Contains(e.sql, "INSERT INTO audit_log") {
+			audited = append(audited, e.args[2])
+		}
+	}
+	assert.Equal(t, []interface{}{requestID}, audited)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get a product
+// @Description Get the catalog entry of a product
+// @Tags products
+// @Produce json
+// @Param sku path string true "Product SKU"
+// @Success 200 {object} models.Product
+// @Router /api/products/{sku} [get]
+func GetProduct(c *gin.Context) {
+	sku := c.Param("sku")
+	if sku == "" {
+		respondError(c, services.Invalid("sku", "is required"))
+		return
+	}
+
+	product, err := inventoryService.GetProduct(c.Request.Context(), sku)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// @Summary Create or replace a product
+// @Description Create or replace the catalog entry of a product. Serial tracking can only be switched, and kit components or variant attributes defined, while the product holds no stock. Variants name their parent product and give a value of each of its attributes.
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param sku path string true "Product SKU"
+// @Param request body models.Product true "Product"
+// @Success 200 {object} models.Product
+// @Router /api/products/{sku} [put]
+func SaveProduct(c *gin.Context) {
+	var product models.Product
+	if err := bindJSON(c, &product); err != nil {
+		respondError(c, err)
+		return
+	}
+	product.SKU = c.Param("sku")
+
+	saved, err := inventoryService.SaveProduct(c.Request.Context(), product)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// @Summary Get the variant availability matrix of a product
+// @Description Get the stock of each variant of a parent product in each warehouse, ordered along its variant attributes, with the totals of the parent
+// @Tags products
+// @Produce json
+// @Param sku path string true "Parent product SKU"
+// @Success 200 {object} models.VariantMatrix
+// @Router /api/products/{sku}/variants [get]
+func GetVariantMatrix(c *gin.Context) {
+	sku := c.Param("sku")
+	if sku == "" {
+		respondError(c, services.Invalid("sku", "is required"))
+		return
+	}
+
+	matrix, err := inventoryService.GetVariantMatrix(c.Request.Context(), sku)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, matrix)
+}
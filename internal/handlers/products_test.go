@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProduct(t *testing.T) {
+	useFakeService(map[string][][]interface{}{"FROM products WHERE sku": {{"test", "Phone", true, ""}}})
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/products/test", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
+	GetProduct(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sku": "test", "name": "Phone", "serialized": true, "units": [{"unit": "each", "factor": 1}]}`, w.Body.String())
+}
+
+func TestSaveProductTakesSKUFromPath(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodPut, "/api/products/test", `{"sku": "other", "name": "Phone", "serialized": true, "units": [{"unit": "case", "factor": 24}]}`)
+	c.Params = []gin.Param{{Key: "sku", Value: "test"}}
+	SaveProduct(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sku": "test", "name": "Phone", "serialized": true, "units": [{"unit": "each", "factor": 1}, {"unit": "case", "factor": 24}]}`, w.Body.String())
+}
+
+func TestGetVariantMatrix(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"FROM variant_attributes": {{"size", []string{"S", "M"}}},
+		"WHERE p.parent_sku = $1": {{"tee-m", "Tee M", "size", "M"}, {"tee-s", "Tee S", "size", "S"}},
+		"FROM stock_levels":       {{1, "Main", "", 4}},
+	})
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/products/tee/variants", "")
+	c.Params = []gin.Param{{Key: "sku", Value: "tee"}}
+	GetVariantMatrix(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"sku": "tee",
+		"attributes": [{"name": "size", "values": ["S", "M"]}],
+		"on_hand": 8,
+		"available": 8,
+		"warehouses": [{"warehouse_id": 1, "name": "Main", "on_hand": 8, "available": 8}],
+		"variants": [
+			{"sku": "tee-s", "name": "Tee S", "attributes": {"size": "S"}, "on_hand": 4, "available": 4, "warehouses": [{"warehouse_id": 1, "name": "Main", "on_hand": 4, "available": 4}]},
+			{"sku": "tee-m", "name": "Tee M", "attributes": {"size": "M"}, "on_hand": 4, "available": 4, "warehouses": [{"warehouse_id": 1, "name": "Main", "on_hand": 4, "available": 4}]}
+		]
+	}`, w.Body.String())
+}
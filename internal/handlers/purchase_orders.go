@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/problem"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// purchaseOrderParam parses the purchase order ID in the request path.
+func purchaseOrderParam(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, services.Invalid("id", "must be a positive integer")
+	}
+	return id, nil
+}
+
+// @Summary Create a purchase order
+// @Description Record stock ordered from a supplier, with the quantity and expected arrival date of each SKU per warehouse
+// @Tags purchase-orders
+// @Accept json
+// @Produce json
+// @Param request body models.PurchaseOrder true "Purchase order"
+// @Success 200 {object} models.PurchaseOrder
+// @Router /api/purchase-orders [post]
+func CreatePurchaseOrder(c *gin.Context) {
+	var po models.PurchaseOrder
+	if err := bindJSON(c, &po); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	created, err := inventoryService.CreatePurchaseOrder(c.Request.Context(), po)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+// @Summary List purchase orders
+// @Description List purchase orders, newest first
+// @Tags purchase-orders
+// @Produce json
+// @Param status query string false "open, received or closed"
+// @Param sku query string false "Only orders with a line for this product SKU"
+// @Param limit query int false "Maximum number of orders"
+// @Success 200 {object} []models.PurchaseOrder
+// @Router /api/purchase-orders [get]
+func ListPurchaseOrders(c *gin.Context) {
+	filter := models.PurchaseOrderFilter{Status: c.Query("status"), SKU: c.Query("sku")}
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			respondError(c, services.Invalid("limit", "must be a positive integer"))
+			return
+		}
+	}
+
+	orders, err := inventoryService.ListPurchaseOrders(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// @Summary Get a purchase order
+// @Description Get a purchase order with the quantity ordered and received on each line
+// @Tags purchase-orders
+// @Produce json
+// @Param id path int true "Purchase order ID"
+// @Success 200 {object} models.PurchaseOrder
+// @Router /api/purchase-orders/{id} [get]
+func GetPurchaseOrder(c *gin.Context) {
+	id, err := purchaseOrderParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	po, err := inventoryService.GetPurchaseOrder(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, po)
+}
+
+// @Summary Receive stock against a purchase order
+// @Description Book the stock that arrived for an open purchase order. Each line adds stock like a receipt and is linked to the order in the inventory history.
+// @Tags purchase-orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase order ID"
+// @Param request body models.Receipt true "Receipt"
+// @Success 200 {object} models.PurchaseOrder
+// @Router /api/purchase-orders/{id}/receipts [post]
+func ReceivePurchaseOrder(c *gin.Context) {
+	id, err := purchaseOrderParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var receipt models.Receipt
+	if err := bindJSON(c, &receipt); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// Warehouse operators may only receive stock into their own warehouses
+	p := auth.FromContext(c.Request.Context())
+	for _, line := range receipt.Lines {
+		if p == nil || !p.CanAccessWarehouse(line.WarehouseID) {
+			problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeForbidden, ErrWarehouseForbidden.Error()))
+			return
+		}
+	}
+
+	po, err := inventoryService.ReceivePurchaseOrder(c.Request.Context(), id, receipt)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, po)
+}
+
+// @Summary Close a purchase order
+// @Description Close an open purchase order; its outstanding quantities are no longer expected
+// @Tags purchase-orders
+// @Produce json
+// @Param id path int true "Purchase order ID"
+// @Success 200 {object} models.PurchaseOrder
+// @Router /api/purchase-orders/{id}/close [post]
+func ClosePurchaseOrder(c *gin.Context) {
+	id, err := purchaseOrderParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	po, err := inventoryService.ClosePurchaseOrder(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, po)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"omnichannel_inventory/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceivePurchaseOrderChecksWarehouseAccess(t *testing.T) {
+	useFakeService(nil)
+	operator := &auth.Principal{Subject: "op", Role: auth.RoleWarehouseOperator, Warehouses: []int{2}}
+
+	w := httptest.NewRecorder()
+	c := newContextAs(w, http.MethodPost, "/api/purchase-orders/7/receipts", `{"lines": [{"sku": "a", "warehouse_id": 2, "quantity": 1}, {"sku": "b", "warehouse_id": 1, "quantity": 1}]}`, operator)
+	c.Params = []gin.Param{{Key: "id", Value: "7"}}
+	ReceivePurchaseOrder(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGetPurchaseOrder(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/purchase-orders/PO-1", "")
+	c.Params = []gin.Param{{Key: "id", Value: "PO-1"}}
+	GetPurchaseOrder(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	c = newJSONContext(w, http.MethodGet, "/api/purchase-orders/7", "")
+	c.Params = []gin.Param{{Key: "id", Value: "7"}}
+	GetPurchaseOrder(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestListPurchaseOrdersRejectsBadStatus(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	ListPurchaseOrders(newJSONContext(w, http.MethodGet, "/api/purchase-orders?status=pending", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"status"`)
+}
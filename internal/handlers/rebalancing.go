@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/problem"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proposalParam parses the transfer proposal ID in the request path.
+func proposalParam(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, services.Invalid("id", "must be a positive integer")
+	}
+	return id, nil
+}
+
+// @Summary Analyse rebalancing
+// @Description Recommend transfers between warehouses that balance the days of cover of each product, replacing the proposals awaiting a decision
+// @Tags rebalancing
+// @Produce json
+// @Success 200 {object} []models.TransferProposal
+// @Router /api/rebalancing/analyze [post]
+func AnalyzeRebalancing(c *gin.Context) {
+	proposals, err := inventoryService.AnalyzeRebalancing(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, proposals)
+}
+
+// @Summary List transfer proposals
+// @Description List recommended transfers between warehouses, newest first
+// @Tags rebalancing
+// @Produce json
+// @Param status query string false "proposed, approved, rejected or superseded"
+// @Param sku query string false "Product SKU"
+// @Param limit query int false "Maximum number of proposals"
+// @Success 200 {object} []models.TransferProposal
+// @Router /api/rebalancing/proposals [get]
+func ListTransferProposals(c *gin.Context) {
+	filter := models.TransferProposalFilter{Status: c.Query("status"), SKU: c.Query("sku")}
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			respondError(c, services.Invalid("limit", "must be a positive integer"))
+			return
+		}
+	}
+
+	proposals, err := inventoryService.ListTransferProposals(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, proposals)
+}
+
+// @Summary Get a transfer proposal
+// @Description Get a recommended transfer and the transfer it was approved into
+// @Tags rebalancing
+// @Produce json
+// @Param id path int true "Transfer proposal ID"
+// @Success 200 {object} models.TransferProposal
+// @Router /api/rebalancing/proposals/{id} [get]
+func GetTransferProposal(c *gin.Context) {
+	id, err := proposalParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	proposal, err := inventoryService.GetTransferProposal(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, proposal)
+}
+
+// @Summary Approve a transfer proposal
+// @Description Move the proposed stock between the warehouses, recording a transfer out of one and into the other
+// @Tags rebalancing
+// @Produce json
+// @Param id path int true "Transfer proposal ID"
+// @Success 200 {object} models.Transfer
+// @Router /api/rebalancing/proposals/{id}/approve [post]
+func ApproveTransferProposal(c *gin.Context) {
+	id, ok := decidableProposal(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := inventoryService.ApproveTransferProposal(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// @Summary Reject a transfer proposal
+// @Description Decline a recommended transfer awaiting a decision
+// @Tags rebalancing
+// @Produce json
+// @Param id path int true "Transfer proposal ID"
+// @Success 200 {object} models.TransferProposal
+// @Router /api/rebalancing/proposals/{id}/reject [post]
+func RejectTransferProposal(c *gin.Context) {
+	id, ok := decidableProposal(c)
+	if !ok {
+		return
+	}
+
+	proposal, err := inventoryService.RejectTransferProposal(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, proposal)
+}
+
+// decidableProposal parses the proposal ID and checks that the caller may
+// change stock in both of its warehouses, responding if not.
+func decidableProposal(c *gin.Context) (int, bool) {
+	id, err := proposalParam(c)
+	if err != nil {
+		respondError(c, err)
+		return 0, false
+	}
+	proposal, err := inventoryService.GetTransferProposal(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return 0, false
+	}
+
+	// Warehouse operators may only move stock between their own warehouses
+	p := auth.FromContext(c.Request.Context())
+	if p == nil || !p.CanAccessWarehouse(proposal.FromWarehouseID) || !p.CanAccessWarehouse(proposal.ToWarehouseID) {
+		problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeForbidden, ErrWarehouseForbidden.Error()))
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApproveTransferProposalChecksWarehouseAccess(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"FROM transfer_proposals p": {{7, "a", 1, 2, 15, (*float64)(nil), (*float64)(nil), "proposed", time.Time{}, "", 0}},
+	})
+	operator := &auth.Principal{Subject: "op", Role: auth.RoleWarehouseOperator, Warehouses: []int{2}}
+
+	w := httptest.NewRecorder()
+	c := newContextAs(w, http.MethodPost, "/api/rebalancing/proposals/7/approve", "", operator)
+	c.Params = []gin.Param{{Key: "id", Value: "7"}}
+	ApproveTransferProposal(c)
+	assert.Equal(t, http.StatusForbidden, w.Code, "the source warehouse is not the operator's")
+}
+
+func TestRejectTransferProposalRejectsBadID(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodPost, "/api/rebalancing/proposals/x/reject", "")
+	c.Params = []gin.Param{{Key: "id", Value: "x"}}
+	RejectTransferProposal(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"id"`)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get replenishment suggestions
+// @Description Get the sales velocity, days of cover and reorder suggestion of each product and warehouse with orders in the velocity window, fewest days of cover first. Settings default to the configured ones.
+// @Tags replenishment
+// @Produce json
+// @Param sku query string false "Product SKU"
+// @Param warehouse_id query int false "Warehouse ID"
+// @Param reorder_only query bool false "Only list products that should be reordered now"
+// @Param window_days query int false "Days of orders to measure sales velocity over"
+// @Param lead_time_days query int false "Supplier lead time in days"
+// @Param safety_stock_days query int false "Days of sales to hold as safety stock"
+// @Param cover_days query int false "Days of sales a suggested order adds"
+// @Success 200 {object} models.ReplenishmentReport
+// @Router /api/replenishment [get]
+func GetReplenishment(c *gin.Context) {
+	filter := models.ReplenishmentFilter{SKU: c.Query("sku"), Settings: inventoryService.ReplenishmentSettings()}
+
+	var err error
+	if v := c.Query("warehouse_id"); v != "" {
+		if filter.WarehouseID, err = strconv.Atoi(v); err != nil || filter.WarehouseID <= 0 {
+			respondError(c, services.Invalid("warehouse_id", "must be a positive integer"))
+			return
+		}
+	}
+	if v := c.Query("reorder_only"); v != "" {
+		if filter.ReorderOnly, err = strconv.ParseBool(v); err != nil {
+			respondError(c, services.Invalid("reorder_only", "must be true or false"))
+			return
+		}
+	}
+	for _, setting := range []struct {
+		field string
+		days  *int
+	}{
+		{"window_days", &filter.Settings.WindowDays},
+		{"lead_time_days", &filter.Settings.LeadTimeDays},
+		{"safety_stock_days", &filter.Settings.SafetyStockDays},
+		{"cover_days", &filter.Settings.CoverDays},
+	} {
+		if v := c.Query(setting.field); v != "" {
+			if *setting.days, err = strconv.Atoi(v); err != nil {
+				respondError(c, services.Invalid(setting.field, "must be an integer"))
+				return
+			}
+		}
+	}
+
+	report, err := inventoryService.GetReplenishment(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
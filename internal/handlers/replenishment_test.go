@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReplenishment(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"WITH sales AS": {{"test", 1, "Main", 5, 0, 0, 56, 0}},
+	})
+
+	w := httptest.NewRecorder()
+	GetReplenishment(newJSONContext(w, http.MethodGet, "/api/replenishment?lead_time_days=3&safety_stock_days=0", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"lead_time_days":3`)
+	assert.Contains(t, w.Body.String(), `"reorder_point":6,"suggested_quantity":61`)
+}
+
+func TestGetReplenishmentRejectsBadSettings(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	GetReplenishment(newJSONContext(w, http.MethodGet, "/api/replenishment?window_days=0", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"window_days"`)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Trace a serial number
+// @Description Get the status and location of every unit with a serial number and the stock movements recorded for it
+// @Tags serials
+// @Produce json
+// @Param serial path string true "Serial number"
+// @Success 200 {object} []models.SerialUnit
+// @Router /api/serials/{serial} [get]
+func TraceSerial(c *gin.Context) {
+	serial := c.Param("serial")
+	if serial == "" {
+		respondError(c, services.Invalid("serial", "is required"))
+		return
+	}
+
+	units, err := inventoryService.TraceSerial(c.Request.Context(), serial)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, units)
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceSerialNotFound(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	c := newJSONContext(w, http.MethodGet, "/api/serials/S1", "")
+	c.Params = []gin.Param{{Key: "serial", Value: "S1"}}
+	TraceSerial(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get a stock valuation
+// @Description Value the stock held in each warehouse now or at a point in time, with the quantity, value and average unit cost of each product
+// @Tags valuation
+// @Produce json
+// @Param sku query string false "Product SKU"
+// @Param warehouse_id query int false "Warehouse ID"
+// @Param as_of query string false "RFC 3339 timestamp to value stock at"
+// @Success 200 {object} models.ValuationReport
+// @Router /api/valuation [get]
+func GetValuation(c *gin.Context) {
+	filter := models.ValuationFilter{SKU: c.Query("sku")}
+
+	var err error
+	if v := c.Query("warehouse_id"); v != "" {
+		if filter.WarehouseID, err = strconv.Atoi(v); err != nil || filter.WarehouseID <= 0 {
+			respondError(c, services.Invalid("warehouse_id", "must be a positive integer"))
+			return
+		}
+	}
+	if v := c.Query("as_of"); v != "" {
+		if filter.AsOf, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(c, services.Invalid("as_of", "must be an RFC 3339 timestamp"))
+			return
+		}
+	}
+
+	report, err := inventoryService.GetValuation(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// @Summary Get the cost layers of a product
+// @Description Get the open cost layers of a product by warehouse, oldest first
+// @Tags valuation
+// @Produce json
+// @Param sku path string true "Product SKU"
+// @Success 200 {object} []models.CostLayer
+// @Router /api/stock/{sku}/cost-layers [get]
+func GetCostLayers(c *gin.Context) {
+	sku := c.Param("sku")
+	if sku == "" {
+		respondError(c, services.Invalid("sku", "is required"))
+		return
+	}
+
+	layers, err := inventoryService.ListCostLayers(c.Request.Context(), sku)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, layers)
+}
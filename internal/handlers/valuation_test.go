@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetValuation(t *testing.T) {
+	useFakeService(map[string][][]interface{}{
+		"SUM(ledger.value)": {{1, "Main", "test", 4, 10.0}},
+	})
+
+	w := httptest.NewRecorder()
+	GetValuation(newJSONContext(w, http.MethodGet, "/api/valuation?as_of=2025-01-31T23:59:59Z", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"as_of":"2025-01-31T23:59:59Z","method":"fifo","value":10`)
+	assert.Contains(t, w.Body.String(), `{"sku":"test","quantity":4,"value":10,"unit_cost":2.5}`)
+}
+
+func TestGetValuationRejectsBadAsOf(t *testing.T) {
+	useFakeService(nil)
+
+	w := httptest.NewRecorder()
+	GetValuation(newJSONContext(w, http.MethodGet, "/api/valuation?as_of=yesterday", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"as_of"`)
+}
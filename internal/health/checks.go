@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"omnichannel_inventory/internal/events"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type PoolPinger interface {
+	Pinger
+	Stat() *pgxpool.Stat
+}
+
+// Postgres checks that a pooled connection can reach the database and
+// reports pool usage.
+func Postgres(pool PoolPinger) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		err := pool.Ping(ctx)
+		stat := pool.Stat()
+		return map[string]interface{}{
+			"total_conns":    stat.TotalConns(),
+			"idle_conns":     stat.IdleConns(),
+			"acquired_conns": stat.AcquiredConns(),
+			"max_conns":      stat.MaxConns(),
+		}, err
+	}
+}
+
+// Redis checks that Redis answers a PING.
+func Redis(client Pinger) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, client.Ping(ctx)
+	}
+}
+
+// StatusSource reports the progress of the inventory event consumer.
+type StatusSource interface {
+	Status() events.Status
+}
+
+// EventConsumer checks that the inventory stream consumer is running and
+// is no more than maxLag behind the stream.
+func EventConsumer(source StatusSource, stream events.StreamRanger, stopped <-chan struct{}, maxLag time.Duration) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		status := source.Status()
+		details := map[string]interface{}{
+			"consumer_started_at": optionalTime(status.ConsumerStartedAt),
+			"last_processed_at":   optionalTime(status.LastProcessedAt),
+		}
+		if status.LastEventID != "" {
+			details["last_event_id"] = status.LastEventID
+		}
+
+		select {
+		case <-stopped:
+			return details, errors.New("consumer is not running")
+		default:
+		}
+
+		lag, err := events.ConsumerLag(ctx, stream, status)
+		if err != nil {
+			return details, err
+		}
+		details["lag_seconds"] = lag.Seconds()
+		if lag > maxLag {
+			return details, fmt.Errorf("consumer lag %s exceeds %s", lag.Round(time.Second), maxLag)
+		}
+		return details, nil
+	}
+}
+
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
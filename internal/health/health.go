@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check and report statuses.
+const (
+	StatusUp          = "up"
+	StatusDown        = "down"
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// CheckFunc probes a dependency and may return details to include in the
+// report whether or not it succeeds.
+type CheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+type Check struct {
+	Name string
+	// Critical checks make the service unready when they fail; other
+	// checks only mark it degraded.
+	Critical bool
+	Run      CheckFunc
+}
+
+type Result struct {
+	Status    string                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	LatencyMS int64                  `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Time   time.Time         `json:"time"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs dependency checks concurrently, each bounded by timeout.
+type Checker struct {
+	timeout time.Duration
+	checks  []Check
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{timeout: timeout, checks: checks}
+}
+
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Time:   time.Now(),
+		Checks: make(map[string]Result, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status == StatusDown {
+				if check.Critical {
+					report.Status = StatusUnavailable
+				} else if report.Status == StatusOK {
+					report.Status = StatusDegraded
+				}
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check.Run(ctx)
+	result := Result{
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		LatencyMS: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Live reports that the process is running and able to serve requests. It
+// does not check dependencies, so an outage does not cause restarts.
+func Live() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": StatusOK,
+			"time":   time.Now().Format(time.RFC3339),
+		})
+	}
+}
+
+// Ready reports the status of every dependency, responding 503 when a
+// critical one is down.
+func (c *Checker) Ready() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		report := c.Run(ctx.Request.Context())
+		status := http.StatusOK
+		if report.Status == StatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		ctx.JSON(status, report)
+	}
+}
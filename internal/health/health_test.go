@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func up(ctx context.Context) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func down(ctx context.Context) (map[string]interface{}, error) {
+	return nil, errors.New("connection refused")
+}
+
+func serveReady(t *testing.T, checker *Checker) (int, Report) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	checker.Ready()(c)
+
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestReady(t *testing.T) {
+	t.Run("all up", func(t *testing.T) {
+		code, report := serveReady(t, NewChecker(time.Second,
+			Check{Name: "postgres", Critical: true, Run: up},
+			Check{Name: "event_consumer", Run: up},
+		))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, StatusOK, report.Status)
+		assert.Equal(t, StatusUp, report.Checks["postgres"].Status)
+	})
+
+	t.Run("non-critical down", func(t *testing.T) {
+		code, report := serveReady(t, NewChecker(time.Second,
+			Check{Name: "postgres", Critical: true, Run: up},
+			Check{Name: "event_consumer", Run: down},
+		))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, StatusDegraded, report.Status)
+		assert.Equal(t, "connection refused", report.Checks["event_consumer"].Error)
+	})
+
+	t.Run("critical down", func(t *testing.T) {
+		code, report := serveReady(t, NewChecker(time.Second,
+			Check{Name: "postgres", Critical: true, Run: down},
+			Check{Name: "event_consumer", Run: down},
+		))
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusUnavailable, report.Status)
+	})
+}
+
+func TestCheckTimeout(t *testing.T) {
+	hang := func(ctx context.Context) (map[string]interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	report := NewChecker(10*time.Millisecond, Check{Name: "redis", Critical: true, Run: hang}).Run(context.Background())
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["redis"].Error)
+}
+
+type fakeSource struct {
+	status events.Status
+}
+
+func (f fakeSource) Status() events.Status { return f.status }
+
+type fakeRanger struct {
+	messages []redis.XMessage
+}
+
+func (f *fakeRanger) XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
+	return redis.NewXMessageSliceCmdResult(f.messages, nil)
+}
+
+func TestEventConsumer(t *testing.T) {
+	running := make(chan struct{})
+	source := fakeSource{events.Status{ConsumerStartedAt: time.Now(), LastEventID: "1-0"}}
+
+	t.Run("caught up", func(t *testing.T) {
+		details, err := EventConsumer(source, &fakeRanger{}, running, time.Minute)(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0.0, details["lag_seconds"])
+		assert.Equal(t, "1-0", details["last_event_id"])
+		assert.Nil(t, details["last_processed_at"])
+	})
+
+	t.Run("lagging", func(t *testing.T) {
+		id := strconv.FormatInt(time.Now().Add(-5*time.Minute).UnixMilli(), 10) + "-0"
+		ranger := &fakeRanger{messages: []redis.XMessage{{ID: id}}}
+		_, err := EventConsumer(source, ranger, running, time.Minute)(context.Background())
+		assert.ErrorContains(t, err, "exceeds")
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		stopped := make(chan struct{})
+		close(stopped)
+		_, err := EventConsumer(source, &fakeRanger{}, stopped, time.Minute)(context.Background())
+		assert.ErrorContains(t, err, "not running")
+	})
+}
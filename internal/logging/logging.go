@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"omnichannel_inventory/internal/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output formats.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+const redacted = "[REDACTED]"
+
+// Setup builds a logger from cfg and installs it as the default, so the
+// standard log package and slog's package-level functions write through it.
+func Setup(cfg config.LoggingConfig, w io.Writer) (*slog.Logger, error) {
+	handler, err := NewHandler(cfg, w)
+	if err != nil {
+		return nil, err
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// NewHandler returns a handler that writes records in the configured format
+// and level, adds the request ID and trace IDs found in the record's context,
+// and redacts secrets.
+func NewHandler(cfg config.LoggingConfig, w io.Writer) (slog.Handler, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	switch cfg.Format {
+	case FormatJSON:
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	case FormatText:
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", cfg.Format)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID, which is added to every
+// record logged with that context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// sensitiveKeys are attribute key fragments whose values are never logged.
+var sensitiveKeys = []string{"password", "secret", "token", "api_key", "apikey", "authorization", "webhook_url", "cookie"}
+
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Slack incoming webhook URLs embed their credential in the path
+	{regexp.MustCompile(`https://hooks\.slack\.com/[^\s"']+`), "https://hooks.slack.com/" + redacted},
+	// Passwords in connection URLs
+	{regexp.MustCompile(`(\w+://[^:/@\s]+:)[^@\s]+@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/-]+=*`), "${1}" + redacted},
+}
+
+// Redact masks known secret formats in s.
+func Redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(Redact(err.Error()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware logs one record per request once it completes. Server errors
+// are logged at error level. It must run after the middleware that assigns
+// the request ID so the record carries it.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypeAny).String(); errs != "" {
+			attrs = append(attrs, slog.String("errors", errs))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request completed", attrs...)
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "inventory"
+
+// Collectors are registered with the default registry, which also exports
+// Go runtime and process metrics.
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database statement latency by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database statements that returned an error, by operation and table.",
+	}, []string{"operation", "table"})
+
+	StreamEventsRead = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_events_read_total",
+		Help:      "Inventory events read from the Redis stream.",
+	})
+
+	StreamConsumerLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_consumer_lag_seconds",
+		Help:      "Age of the oldest unread stream entry at the consumer's last read.",
+	})
+
+	EventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_processed_total",
+		Help:      "Inventory events processed, by result.",
+	}, []string{"result"})
+
+	EventQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_processor_queue_depth",
+		Help:      "Events waiting in the event processor buffer.",
+	})
+
+	LowStockAlerts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "low_stock_alerts_total",
+		Help:      "Low stock alerts raised by the event processor.",
+	})
+
+	NearExpiryAlerts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "near_expiry_alerts_total",
+		Help:      "Near-expiry alerts raised for stocked lots.",
+	})
+
+	ReplenishmentReports = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replenishment_reports_total",
+		Help:      "Scheduled replenishment reports sent with reorder suggestions.",
+	})
+
+	StockCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stock_cache_lookups_total",
+		Help:      "Consolidated stock cache lookups, by result (hit, miss or error).",
+	}, []string{"result"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook deliveries, by result.",
+	}, []string{"result"})
+
+	WebhookDeliveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_duration_seconds",
+		Help:      "Webhook delivery latency.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// Result returns the result label for an outcome.
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareLabelsRoutePattern(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/stock/:sku", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	before := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/api/stock/:sku", "200"))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stock/abc", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stock/xyz", nil))
+	assert.Equal(t, before+2, testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/api/stock/:sku", "200")))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	assert.Equal(t, 1.0, testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404")))
+}
+
+type fakeTotals struct {
+	totals []models.WarehouseTotals
+	err    error
+}
+
+func (f *fakeTotals) GetWarehouseTotals(ctx context.Context) ([]models.WarehouseTotals, error) {
+	return f.totals, f.err
+}
+
+func TestStockCollector(t *testing.T) {
+	collector := NewStockCollector(&fakeTotals{totals: []models.WarehouseTotals{
+		{WarehouseID: 1, SKUs: 3, Units: 120},
+		{WarehouseID: 2, SKUs: 1, Units: 5},
+	}})
+	expected := `
+		# HELP inventory_warehouse_units Total units in stock per warehouse.
+		# TYPE inventory_warehouse_units gauge
+		inventory_warehouse_units{warehouse_id="1"} 120
+		inventory_warehouse_units{warehouse_id="2"} 5
+	`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "inventory_warehouse_units"))
+
+	// A failed query drops the series instead of failing the scrape
+	failing := NewStockCollector(&fakeTotals{err: errors.New("connection refused")})
+	assert.Equal(t, 0, testutil.CollectAndCount(failing))
+}
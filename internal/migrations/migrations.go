@@ -0,0 +1,292 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"omnichannel_inventory/internal/db"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey serialises migration runs across processes.
+const lockKey = 727101
+
+type DB interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error)
+	Begin(ctx context.Context) (db.Tx, error)
+}
+
+// Migration is a numbered schema change with its rollback.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a migration and whether it has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// ErrSchemaBehind is returned by Check when migrations are pending.
+type ErrSchemaBehind struct {
+	Current int
+	Latest  int
+}
+
+func (e *ErrSchemaBehind) Error() string {
+	return fmt.Sprintf("database schema is at version %d but version %d is required; run the migrate command", e.Current, e.Latest)
+}
+
+// All returns the embedded migrations ordered by version. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+		versionPart, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionPart)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %s must start with a positive version number", name)
+		}
+
+		data, err := files.ReadFile("sql/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// lock starts a transaction holding the migration lock and makes sure the
+// schema_migrations table exists. Concurrent runs wait for the lock and
+// then see the versions applied by the run that held it.
+func lock(ctx context.Context, database DB) (db.Tx, error) {
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	sql := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`
+	if err := tx.Exec(ctx, sql); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+func appliedVersions(ctx context.Context, q interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error)
+}) (map[int]time.Time, error) {
+	rows, err := q.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in a single transaction and returns
+// the versions it applied.
+func Up(ctx context.Context, database DB) ([]int, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := lock(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	applied, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := tx.Exec(ctx, m.Up); err != nil {
+			return nil, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		if err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+			return nil, err
+		}
+		versions = append(versions, m.Version)
+	}
+	return versions, tx.Commit(ctx)
+}
+
+// Down rolls back the most recent steps applied migrations in a single
+// transaction and returns the versions it rolled back.
+func Down(ctx context.Context, database DB, steps int) ([]int, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := lock(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	applied, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for i := len(migrations) - 1; i >= 0 && len(versions) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := tx.Exec(ctx, m.Down); err != nil {
+			return nil, fmt.Errorf("rollback of migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		if err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, m.Version)
+	}
+	return versions, tx.Commit(ctx)
+}
+
+// List reports every known migration and whether it has been applied.
+func List(ctx context.Context, database DB) ([]Status, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := lock(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	applied, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// Check returns an *ErrSchemaBehind if any embedded migration has not been
+// applied. It does not take the migration lock or modify the database.
+func Check(ctx context.Context, database DB) error {
+	migrations, err := All()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	rows, err := database.Query(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	if rows.Next() {
+		if err := rows.Scan(&exists); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].Version
+	if !exists {
+		return &ErrSchemaBehind{Current: 0, Latest: latest}
+	}
+
+	applied, err := appliedVersions(ctx, database)
+	if err != nil {
+		return err
+	}
+	current := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			return &ErrSchemaBehind{Current: current, Latest: latest}
+		}
+		current = m.Version
+	}
+	return nil
+}
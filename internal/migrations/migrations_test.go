@@ -0,0 +1,168 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB records executed statements and answers queries from canned rows
+// keyed by a fragment of the SQL text.
+type fakeDB struct {
+	execs     []string
+	results   map[string][][]interface{}
+	commits   int
+	rollbacks int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{results: map[string][][]interface{}{}}
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	f.execs = append(f.execs, sql)
+	return nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error) {
+	for fragment, rows := range f.results {
+		if strings.Contains(sql, fragment) {
+			return &fakeRows{rows: rows, pos: -1}, nil
+		}
+	}
+	return &fakeRows{pos: -1}, nil
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (db.Tx, error) {
+	return &fakeTx{f}, nil
+}
+
+type fakeTx struct {
+	*fakeDB
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	t.rollbacks++
+	return nil
+}
+
+type fakeRows struct {
+	rows [][]interface{}
+	pos  int
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	row := r.rows[r.pos]
+	if len(dest) != len(row) {
+		return fmt.Errorf("scan: expected %d columns, got %d", len(row), len(dest))
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(row[i]))
+	}
+	return nil
+}
+
+func TestAllIsSequential(t *testing.T) {
+	migrations, err := All()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "migration versions must be sequential")
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestUpAppliesPendingUnderLock(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM schema_migrations"] = [][]interface{}{{1, time.Now()}}
+
+	versions, err := Up(context.Background(), fdb)
+	require.NoError(t, err)
+
+	all, _ := All()
+	assert.Len(t, versions, len(all)-1)
+	assert.Equal(t, 2, versions[0])
+	assert.Contains(t, fdb.execs[0], "pg_advisory_xact_lock")
+	assert.Equal(t, 1, fdb.commits)
+
+	for _, sql := range fdb.execs {
+		assert.NotEqual(t, all[0].Up, sql, "applied migration must not run again")
+	}
+}
+
+func TestDownRollsBackLatest(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM schema_migrations"] = [][]interface{}{{1, time.Now()}, {2, time.Now()}}
+
+	versions, err := Down(context.Background(), fdb, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, versions)
+
+	all, _ := All()
+	assert.Contains(t, fdb.execs, all[1].Down)
+	assert.Equal(t, 1, fdb.commits)
+}
+
+func TestCheck(t *testing.T) {
+	all, _ := All()
+	latest := all[len(all)-1].Version
+
+	t.Run("no migrations table", func(t *testing.T) {
+		fdb := newFakeDB()
+		fdb.results["to_regclass"] = [][]interface{}{{false}}
+
+		var behind *ErrSchemaBehind
+		require.True(t, errors.As(Check(context.Background(), fdb), &behind))
+		assert.Equal(t, 0, behind.Current)
+		assert.Equal(t, latest, behind.Latest)
+	})
+
+	t.Run("behind", func(t *testing.T) {
+		fdb := newFakeDB()
+		fdb.results["to_regclass"] = [][]interface{}{{true}}
+		fdb.results["FROM schema_migrations"] = [][]interface{}{{1, time.Now()}}
+
+		var behind *ErrSchemaBehind
+		require.True(t, errors.As(Check(context.Background(), fdb), &behind))
+		assert.Equal(t, 1, behind.Current)
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		fdb := newFakeDB()
+		fdb.results["to_regclass"] = [][]interface{}{{true}}
+		var rows [][]interface{}
+		for _, m := range all {
+			rows = append(rows, []interface{}{m.Version, time.Now()})
+		}
+		fdb.results["FROM schema_migrations"] = rows
+
+		assert.NoError(t, Check(context.Background(), fdb))
+		assert.Empty(t, fdb.execs)
+	})
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS inventory_transactions;
+DROP TABLE IF EXISTS stock_levels;
+DROP TABLE IF EXISTS inventory;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS warehouses;
@@ -34,8 +34,11 @@ CREATE TABLE IF NOT EXISTS inventory_transactions (
     id SERIAL PRIMARY KEY,
     sku VARCHAR(100) NOT NULL,
     warehouse_id INT NOT NULL,
-    quantity INT NOT NULL,
+    change INT NOT NULL,
     type VARCHAR(50) NOT NULL,
     channel VARCHAR(50),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-); 
\ No newline at end of file
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_sku_timestamp
+    ON inventory_transactions (sku, timestamp);
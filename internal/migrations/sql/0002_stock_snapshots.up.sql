@@ -0,0 +1,12 @@
+-- Stock Snapshots (ledger totals materialised for point-in-time queries)
+CREATE TABLE IF NOT EXISTS stock_snapshot_runs (
+    snapshot_at TIMESTAMP PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS stock_snapshots (
+    snapshot_at TIMESTAMP NOT NULL,
+    sku VARCHAR(100) NOT NULL,
+    warehouse_id INT NOT NULL,
+    quantity INT NOT NULL,
+    PRIMARY KEY (snapshot_at, sku, warehouse_id)
+);
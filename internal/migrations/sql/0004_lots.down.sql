@@ -0,0 +1,3 @@
+ALTER TABLE inventory_transactions DROP COLUMN IF EXISTS lot_id;
+DROP TABLE IF EXISTS lot_stock;
+DROP TABLE IF EXISTS lots;
@@ -0,0 +1,26 @@
+-- Lots (batches of a SKU with manufacture and expiry dates)
+CREATE TABLE IF NOT EXISTS lots (
+    id SERIAL PRIMARY KEY,
+    sku VARCHAR(100) NOT NULL,
+    lot_number VARCHAR(100) NOT NULL,
+    manufactured_on DATE,
+    expires_on DATE,
+    expiry_alerted_at TIMESTAMPTZ,
+    UNIQUE (sku, lot_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lots_lot_number ON lots (lot_number);
+CREATE INDEX IF NOT EXISTS idx_lots_expires_on ON lots (expires_on);
+
+-- Lot Stock (the part of stock_levels held in each lot)
+CREATE TABLE IF NOT EXISTS lot_stock (
+    lot_id INT NOT NULL REFERENCES lots(id),
+    warehouse_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity >= 0),
+    PRIMARY KEY (lot_id, warehouse_id)
+);
+
+ALTER TABLE inventory_transactions ADD COLUMN IF NOT EXISTS lot_id INT REFERENCES lots(id);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_lot_id
+    ON inventory_transactions (lot_id) WHERE lot_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS serial_movements;
+DROP TABLE IF EXISTS serials;
+ALTER TABLE products DROP COLUMN IF EXISTS serialized;
@@ -0,0 +1,23 @@
+-- Serialized products have every unit registered by serial number
+ALTER TABLE products ADD COLUMN IF NOT EXISTS serialized BOOLEAN NOT NULL DEFAULT false;
+
+-- Serials (units of serialized SKUs and where each one is)
+CREATE TABLE IF NOT EXISTS serials (
+    id SERIAL PRIMARY KEY,
+    sku VARCHAR(100) NOT NULL,
+    serial_number VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    warehouse_id INT,
+    UNIQUE (sku, serial_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_serials_serial_number ON serials (serial_number);
+CREATE INDEX IF NOT EXISTS idx_serials_in_stock
+    ON serials (sku, warehouse_id, id) WHERE status = 'in_stock';
+
+-- Serial Movements (the ledger entries that moved each serial)
+CREATE TABLE IF NOT EXISTS serial_movements (
+    serial_id INT NOT NULL REFERENCES serials(id),
+    transaction_id INT NOT NULL REFERENCES inventory_transactions(id),
+    PRIMARY KEY (serial_id, transaction_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS bin_movements;
+DROP TABLE IF EXISTS bin_stock;
+DROP TABLE IF EXISTS locations;
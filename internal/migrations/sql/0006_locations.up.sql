@@ -0,0 +1,35 @@
+-- Locations (zones, aisles and bins within a warehouse)
+CREATE TABLE IF NOT EXISTS locations (
+    id SERIAL PRIMARY KEY,
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    parent_id INT REFERENCES locations(id),
+    kind VARCHAR(20) NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    UNIQUE (warehouse_id, path)
+);
+
+-- Bin Stock (the part of stock_levels that has been put away into bins)
+CREATE TABLE IF NOT EXISTS bin_stock (
+    location_id INT NOT NULL REFERENCES locations(id),
+    sku VARCHAR(100) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity >= 0),
+    PRIMARY KEY (location_id, sku)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bin_stock_sku ON bin_stock (sku);
+
+-- Bin Movements (put-away, bin-to-bin moves and stock changes made in bins)
+CREATE TABLE IF NOT EXISTS bin_movements (
+    id SERIAL PRIMARY KEY,
+    sku VARCHAR(100) NOT NULL,
+    warehouse_id INT NOT NULL,
+    from_location_id INT REFERENCES locations(id),
+    to_location_id INT REFERENCES locations(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    transaction_id INT REFERENCES inventory_transactions(id),
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    moved_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_bin_movements_sku ON bin_movements (sku, moved_at);
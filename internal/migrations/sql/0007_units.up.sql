@@ -0,0 +1,7 @@
+-- Product Units (pack sizes of a SKU in base units; the base unit is "each")
+CREATE TABLE IF NOT EXISTS product_units (
+    sku VARCHAR(100) NOT NULL,
+    unit VARCHAR(20) NOT NULL,
+    factor INT NOT NULL CHECK (factor > 0),
+    PRIMARY KEY (sku, unit)
+);
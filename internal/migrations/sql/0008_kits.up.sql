@@ -0,0 +1,10 @@
+-- Kit Components (the SKUs and quantities a kit is assembled from; kits hold no stock of their own)
+CREATE TABLE IF NOT EXISTS kit_components (
+    kit_sku VARCHAR(100) NOT NULL,
+    component_sku VARCHAR(100) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (kit_sku, component_sku),
+    CHECK (kit_sku <> component_sku)
+);
+
+CREATE INDEX IF NOT EXISTS idx_kit_components_component_sku ON kit_components (component_sku);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS variant_values;
+DROP TABLE IF EXISTS variant_attributes;
+ALTER TABLE products DROP COLUMN IF EXISTS parent_sku;
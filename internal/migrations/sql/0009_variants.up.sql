@@ -0,0 +1,22 @@
+-- Variants are child SKUs of a parent product
+ALTER TABLE products ADD COLUMN IF NOT EXISTS parent_sku VARCHAR(100) REFERENCES products(sku);
+
+CREATE INDEX IF NOT EXISTS idx_products_parent_sku ON products (parent_sku);
+
+-- Variant Attributes (what a parent product's variants differ by, such as size or colour, and the values in display order)
+CREATE TABLE IF NOT EXISTS variant_attributes (
+    parent_sku VARCHAR(100) NOT NULL,
+    position INT NOT NULL,
+    name VARCHAR(30) NOT NULL,
+    options TEXT[] NOT NULL,
+    PRIMARY KEY (parent_sku, position),
+    UNIQUE (parent_sku, name)
+);
+
+-- Variant Values (the value of each attribute of a variant)
+CREATE TABLE IF NOT EXISTS variant_values (
+    sku VARCHAR(100) NOT NULL,
+    attribute VARCHAR(30) NOT NULL,
+    value VARCHAR(50) NOT NULL,
+    PRIMARY KEY (sku, attribute)
+);
@@ -0,0 +1,34 @@
+-- Purchase Orders (stock ordered from suppliers)
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id SERIAL PRIMARY KEY,
+    reference VARCHAR(100) UNIQUE NOT NULL,
+    supplier VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_status ON purchase_orders (status);
+
+-- Purchase Order Lines (the quantity of a SKU expected in a warehouse, and how much has arrived)
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id SERIAL PRIMARY KEY,
+    purchase_order_id INT NOT NULL REFERENCES purchase_orders(id),
+    sku VARCHAR(100) NOT NULL,
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    received INT NOT NULL DEFAULT 0 CHECK (received >= 0),
+    expected_on DATE,
+    UNIQUE (purchase_order_id, sku, warehouse_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_outstanding
+    ON purchase_order_lines (sku) WHERE received < quantity;
+
+-- Purchase Order Receipts (the receipt ledger entries of each line)
+CREATE TABLE IF NOT EXISTS purchase_order_receipts (
+    transaction_id INT PRIMARY KEY REFERENCES inventory_transactions(id),
+    line_id INT NOT NULL REFERENCES purchase_order_lines(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_order_receipts_line_id ON purchase_order_receipts (line_id);
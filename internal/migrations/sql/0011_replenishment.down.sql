@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS replenishment_report_runs;
+DROP INDEX IF EXISTS idx_inventory_transactions_orders;
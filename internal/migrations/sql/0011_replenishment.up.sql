@@ -0,0 +1,8 @@
+-- Sales velocity reads recent order transactions across every SKU
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_orders
+    ON inventory_transactions (timestamp) WHERE type = 'order';
+
+-- Replenishment Report Runs (claimed so that each report is sent once)
+CREATE TABLE IF NOT EXISTS replenishment_report_runs (
+    run_at TIMESTAMP PRIMARY KEY
+);
@@ -0,0 +1,28 @@
+-- Transfer Proposals (transfers recommended to balance days of cover)
+CREATE TABLE IF NOT EXISTS transfer_proposals (
+    id SERIAL PRIMARY KEY,
+    sku VARCHAR(100) NOT NULL,
+    from_warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    to_warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    from_days_of_cover DOUBLE PRECISION,
+    to_days_of_cover DOUBLE PRECISION,
+    status VARCHAR(20) NOT NULL DEFAULT 'proposed',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    decided_by VARCHAR(255) NOT NULL DEFAULT '',
+    decided_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_proposals_status ON transfer_proposals (status, id);
+
+-- Transfers (stock moved between warehouses on approval of a proposal)
+CREATE TABLE IF NOT EXISTS transfers (
+    id SERIAL PRIMARY KEY,
+    proposal_id INT NOT NULL UNIQUE REFERENCES transfer_proposals(id),
+    sku VARCHAR(100) NOT NULL,
+    from_warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    to_warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
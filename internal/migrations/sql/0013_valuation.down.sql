@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS cost_layers;
+ALTER TABLE stock_snapshots DROP COLUMN IF EXISTS value;
+ALTER TABLE inventory_transactions DROP COLUMN IF EXISTS cost;
@@ -0,0 +1,20 @@
+-- Value each ledger entry added to stock, negative for stock issued
+ALTER TABLE inventory_transactions ADD COLUMN IF NOT EXISTS cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+
+ALTER TABLE stock_snapshots ADD COLUMN IF NOT EXISTS value NUMERIC(18,4) NOT NULL DEFAULT 0;
+
+-- Cost Layers (stock received into a warehouse at one unit cost, and how much of it is left)
+CREATE TABLE IF NOT EXISTS cost_layers (
+    id SERIAL PRIMARY KEY,
+    sku VARCHAR(100) NOT NULL,
+    warehouse_id INT NOT NULL,
+    transaction_id INT NOT NULL REFERENCES inventory_transactions(id),
+    unit_cost NUMERIC(14,4) NOT NULL CHECK (unit_cost >= 0),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    remaining INT NOT NULL CHECK (remaining >= 0),
+    value NUMERIC(18,4) NOT NULL CHECK (value >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_layers_open
+    ON cost_layers (sku, warehouse_id, id) WHERE remaining > 0;
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Reason codes describe why stock changed.
+const (
+	ReasonReceipt    = "receipt"
+	ReasonAdjustment = "adjustment"
+	ReasonCycleCount = "cycle_count"
+	ReasonDamage     = "damage"
+	ReasonShrinkage  = "shrinkage"
+	ReasonReturn     = "return"
+	ReasonSale       = "sale"
+	ReasonCorrection = "correction"
+	ReasonTransfer   = "transfer"
+	ReasonRelocation = "relocation"
+)
+
+var reasonCodes = map[string]bool{
+	ReasonReceipt:    true,
+	ReasonAdjustment: true,
+	ReasonCycleCount: true,
+	ReasonDamage:     true,
+	ReasonShrinkage:  true,
+	ReasonReturn:     true,
+	ReasonSale:       true,
+	ReasonCorrection: true,
+	ReasonTransfer:   true,
+	ReasonRelocation: true,
+}
+
+func IsValidReasonCode(code string) bool {
+	return reasonCodes[code]
+}
+
+type AuditEntry struct {
+	ID            int       `json:"id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Actor         string    `json:"actor"`
+	RequestID     string    `json:"request_id"`
+	SourceIP      string    `json:"source_ip"`
+	Action        string    `json:"action"`
+	SKU           string    `json:"sku"`
+	WarehouseID   int       `json:"warehouse_id"`
+	Change        int       `json:"change"`
+	Channel       string    `json:"channel"`
+	Reason        string    `json:"reason"`
+	ReasonCode    string    `json:"reason_code"`
+	TransactionID int       `json:"transaction_id"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+type AuditFilter struct {
+	SKU        string
+	Actor      string
+	ReasonCode string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+type AuditVerification struct {
+	Valid          bool `json:"valid"`
+	EntriesChecked int  `json:"entries_checked"`
+	FirstInvalidID int  `json:"first_invalid_id,omitempty"`
+}
@@ -10,6 +10,28 @@ type StockUpdate struct {
 	WarehouseID int       `json:"warehouse_id"`
 	Quantity    int       `json:"quantity"`
 	Timestamp   time.Time `json:"timestamp"`
+	Reason      string    `json:"reason,omitempty"`
+	ReasonCode  string    `json:"reason_code,omitempty"`
+	// LotNumber places the stock in a lot, created on first use with the
+	// given dates. Dates are formatted as YYYY-MM-DD.
+	LotNumber      string `json:"lot_number,omitempty"`
+	ManufacturedOn string `json:"manufactured_on,omitempty"`
+	ExpiresOn      string `json:"expires_on,omitempty"`
+	// SerialNumbers lists the units added or removed, one per unit of
+	// quantity. It is required for serialized SKUs and rejected otherwise.
+	SerialNumbers []string `json:"serial_numbers,omitempty"`
+	// Bin is the path of the bin the stock is added to or taken from.
+	// Without it, added stock waits to be put away and removed stock is
+	// taken from stock not yet put away first.
+	Bin string `json:"bin,omitempty"`
+	// Unit is the unit of measure of Quantity, the base unit when empty.
+	// The service converts Quantity to base units and clears Unit.
+	Unit string `json:"unit,omitempty"`
+	// UnitCost is the cost of one base unit of stock added. Without it,
+	// added stock is costed at the average cost of the warehouse's stock.
+	// It is rejected for stock removed, which is costed by the valuation
+	// method.
+	UnitCost *float64 `json:"unit_cost,omitempty"`
 }
 
 func (s *StockUpdate) MarshalBinary() ([]byte, error) {
@@ -21,9 +43,30 @@ func (s *StockUpdate) UnmarshalBinary(data []byte) error {
 }
 
 type Order struct {
-	SKU      string `json:"sku"`
-	Channel  string `json:"channel"`
-	Quantity int    `json:"quantity"`
+	SKU        string `json:"sku"`
+	Channel    string `json:"channel"`
+	Quantity   int    `json:"quantity"`
+	Reason     string `json:"reason,omitempty"`
+	ReasonCode string `json:"reason_code,omitempty"`
+	// SerialNumbers optionally picks the units of a serialized SKU to sell,
+	// one per unit of quantity. Otherwise the longest-held units are sold.
+	SerialNumbers []string `json:"serial_numbers,omitempty"`
+	// Unit is the unit of measure of Quantity, the base unit when empty.
+	Unit string `json:"unit,omitempty"`
+}
+
+// Allocation is the stock an order took from one warehouse, and from one
+// lot when LotNumber is set. Picks lists the bins to pick it from in bin
+// path order. SKU names the component taken for orders of kits.
+type Allocation struct {
+	SKU           string   `json:"sku,omitempty"`
+	WarehouseID   int      `json:"warehouse_id"`
+	Quantity      int      `json:"quantity"`
+	LotNumber     string   `json:"lot_number,omitempty"`
+	SerialNumbers []string `json:"serial_numbers,omitempty"`
+	Picks         []Pick   `json:"picks,omitempty"`
+	// Cost is the cost of goods sold of the allocation.
+	Cost float64 `json:"cost"`
 }
 
 func (o *Order) MarshalBinary() ([]byte, error) {
@@ -34,14 +77,21 @@ func (o *Order) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, o)
 }
 
+// InventoryTransaction is a ledger entry. PurchaseOrder is the reference of
+// the purchase order a receipt was received against.
 type InventoryTransaction struct {
-	ID          int       `json:"id"`
-	SKU         string    `json:"sku"`
-	WarehouseID int       `json:"warehouse_id"`
-	Change      int       `json:"change"`
-	Type        string    `json:"type"`
-	Channel     string    `json:"channel"`
-	Timestamp   time.Time `json:"timestamp"`
+	ID            int    `json:"id"`
+	SKU           string `json:"sku"`
+	WarehouseID   int    `json:"warehouse_id"`
+	Change        int    `json:"change"`
+	Type          string `json:"type"`
+	Channel       string `json:"channel"`
+	LotNumber     string `json:"lot_number,omitempty"`
+	PurchaseOrder string `json:"purchase_order,omitempty"`
+	// Cost is the value the change added to stock. It is negative for stock
+	// issued, and for orders its negation is the cost of goods sold.
+	Cost      float64   `json:"cost"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type StockLevel struct {
@@ -50,10 +100,100 @@ type StockLevel struct {
 	Quantity    int    `json:"quantity"`
 }
 
+// StockSummary is the consolidated stock of a SKU. OnHand is the sum of all
+// warehouse balances; Available counts only the stock orders can be
+// allocated from. The stock of a kit is the number of kits its components
+// make up in each warehouse. Incoming is the quantity still expected on
+// open purchase orders, the first of it by NextArrival when dated.
+type StockSummary struct {
+	SKU         string           `json:"sku"`
+	Kit         bool             `json:"kit,omitempty"`
+	OnHand      int              `json:"on_hand"`
+	Available   int              `json:"available"`
+	Incoming    int              `json:"incoming,omitempty"`
+	NextArrival string           `json:"next_arrival,omitempty"`
+	Warehouses  []WarehouseStock `json:"warehouses"`
+}
+
+// WarehouseStock is the stock of a SKU in one warehouse. Name and location
+// are empty for warehouses missing from the warehouses table.
+type WarehouseStock struct {
+	WarehouseID int    `json:"warehouse_id"`
+	Name        string `json:"name,omitempty"`
+	Location    string `json:"location,omitempty"`
+	OnHand      int    `json:"on_hand"`
+	Available   int    `json:"available"`
+	Incoming    int    `json:"incoming,omitempty"`
+	NextArrival string `json:"next_arrival,omitempty"`
+}
+
+// StockListItem is the stock of a SKU in one warehouse, as listed by the
+// stock search.
+type StockListItem struct {
+	SKU               string `json:"sku"`
+	ProductName       string `json:"product_name,omitempty"`
+	WarehouseID       int    `json:"warehouse_id"`
+	WarehouseName     string `json:"warehouse_name,omitempty"`
+	WarehouseLocation string `json:"warehouse_location,omitempty"`
+	Quantity          int    `json:"quantity"`
+	// UnitQuantity restates Quantity in the unit requested from the stock
+	// search, for SKUs that define it.
+	Unit         string   `json:"unit,omitempty"`
+	UnitQuantity *float64 `json:"unit_quantity,omitempty"`
+}
+
+// Stock list sort keys. A leading "-" sorts descending.
+const (
+	StockSortSKU       = "sku"
+	StockSortQuantity  = "quantity"
+	StockSortWarehouse = "warehouse_id"
+	StockSortProduct   = "product_name"
+)
+
+// StockFilter selects stock rows for the stock search. Nil bounds and zero
+// values are not applied; a Limit of zero returns the largest page.
+type StockFilter struct {
+	WarehouseIDs   []int
+	SKUPrefix      string
+	ProductName    string
+	MinQuantity    *int
+	MaxQuantity    *int
+	BelowThreshold bool
+	ZeroStock      bool
+	Sort           string
+	Limit          int
+	Offset         int
+	// Unit adds quantities in this unit of measure to the results.
+	Unit string
+}
+
+// StockPage is one page of stock search results.
+type StockPage struct {
+	Items  []StockListItem `json:"items"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
 func (s *StockLevel) MarshalBinary() ([]byte, error) {
 	return json.Marshal(s)
 }
 
 func (s *StockLevel) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, s)
-} 
\ No newline at end of file
+}
+
+type StockDrift struct {
+	SKU            string `json:"sku"`
+	WarehouseID    int    `json:"warehouse_id"`
+	LedgerQuantity int    `json:"ledger_quantity"`
+	StockQuantity  int    `json:"stock_quantity"`
+	Drift          int    `json:"drift"`
+}
+
+// WarehouseTotals summarises the stock held in one warehouse.
+type WarehouseTotals struct {
+	WarehouseID int `json:"warehouse_id"`
+	SKUs        int `json:"skus"`
+	Units       int `json:"units"`
+}
@@ -0,0 +1,77 @@
+package models
+
+// Location kinds, outermost first. Only bins hold stock.
+const (
+	LocationZone  = "zone"
+	LocationAisle = "aisle"
+	LocationBin   = "bin"
+)
+
+// LocationDepth orders the location kinds from the outermost; it is -1 for
+// unknown kinds.
+func LocationDepth(kind string) int {
+	switch kind {
+	case LocationZone:
+		return 0
+	case LocationAisle:
+		return 1
+	case LocationBin:
+		return 2
+	}
+	return -1
+}
+
+// Location is a zone, aisle or bin of a warehouse. Path joins the codes of
+// the location and its ancestors with "/", e.g. "A/03/B12". Quantity is the
+// stock held in the location and every bin beneath it.
+type Location struct {
+	ID          int    `json:"id"`
+	WarehouseID int    `json:"warehouse_id"`
+	ParentID    int    `json:"parent_id,omitempty"`
+	Kind        string `json:"kind"`
+	Code        string `json:"code"`
+	Path        string `json:"path"`
+	Quantity    int    `json:"quantity"`
+}
+
+// NewLocation describes a location to create under the location at path
+// Parent, or at the top of the warehouse when Parent is empty.
+type NewLocation struct {
+	Kind   string `json:"kind"`
+	Code   string `json:"code"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// BinMove moves stock of a SKU into the bin ToBin of a warehouse, from the
+// bin FromBin or, for put-away, from stock not yet put away.
+type BinMove struct {
+	SKU         string `json:"sku"`
+	WarehouseID int    `json:"warehouse_id"`
+	FromBin     string `json:"from_bin,omitempty"`
+	ToBin       string `json:"to_bin"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason,omitempty"`
+	ReasonCode  string `json:"reason_code,omitempty"`
+}
+
+// WarehouseBins breaks the stock of a SKU in a warehouse down by bin.
+// Unassigned is the stock that has not been put away.
+type WarehouseBins struct {
+	WarehouseID int           `json:"warehouse_id"`
+	Name        string        `json:"name,omitempty"`
+	Quantity    int           `json:"quantity"`
+	Unassigned  int           `json:"unassigned"`
+	Bins        []BinQuantity `json:"bins"`
+}
+
+type BinQuantity struct {
+	Bin      string `json:"bin"`
+	Quantity int    `json:"quantity"`
+}
+
+// Pick is a line of a pick list: the quantity to take from a bin, or from
+// stock not yet put away when Bin is empty.
+type Pick struct {
+	Bin      string `json:"bin,omitempty"`
+	Quantity int    `json:"quantity"`
+}
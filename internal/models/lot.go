@@ -0,0 +1,39 @@
+package models
+
+// DateLayout is the format of lot manufacture and expiry dates.
+const DateLayout = "2006-01-02"
+
+// Lot is a batch of a SKU and where its stock is held. Dates are empty when
+// unknown.
+type Lot struct {
+	ID             int            `json:"id"`
+	SKU            string         `json:"sku"`
+	LotNumber      string         `json:"lot_number"`
+	ManufacturedOn string         `json:"manufactured_on,omitempty"`
+	ExpiresOn      string         `json:"expires_on,omitempty"`
+	Quantity       int            `json:"quantity"`
+	Warehouses     []LotWarehouse `json:"warehouses"`
+}
+
+// LotWarehouse is the stock of a lot in one warehouse.
+type LotWarehouse struct {
+	WarehouseID int    `json:"warehouse_id"`
+	Name        string `json:"name,omitempty"`
+	Quantity    int    `json:"quantity"`
+}
+
+// LotTrace is a lot with every ledger entry that moved its stock, oldest
+// first, for locating recalled stock.
+type LotTrace struct {
+	Lot
+	Transactions []InventoryTransaction `json:"transactions"`
+}
+
+// ExpiringLot is a stocked lot that expires within the alert window.
+type ExpiringLot struct {
+	SKU          string `json:"sku"`
+	LotNumber    string `json:"lot_number"`
+	ExpiresOn    string `json:"expires_on"`
+	Quantity     int    `json:"quantity"`
+	WarehouseIDs []int  `json:"warehouse_ids"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// Product is a catalog entry. Stock of a serialized product is tracked
+// unit by unit, and every stock change must name the serial numbers moved.
+// Units lists the units of measure stock and orders may be given in,
+// starting with the base unit. A product with Components is a kit: it holds
+// no stock, and orders for it take its components.
+//
+// A parent product groups the variants of one item, such as the sizes and
+// colours of a shirt. It defines the VariantAttributes they differ by and
+// holds no stock; Variants lists their SKUs. A variant names its Parent and
+// gives the value of each attribute in Attributes.
+type Product struct {
+	SKU               string             `json:"sku"`
+	Name              string             `json:"name"`
+	Serialized        bool               `json:"serialized"`
+	Units             []UnitOfMeasure    `json:"units"`
+	Components        []KitComponent     `json:"components,omitempty"`
+	Parent            string             `json:"parent,omitempty"`
+	Attributes        map[string]string  `json:"attributes,omitempty"`
+	VariantAttributes []VariantAttribute `json:"variant_attributes,omitempty"`
+	Variants          []string           `json:"variants,omitempty"`
+}
+
+// KitComponent is a SKU and the quantity of it, in base units, that goes
+// into one kit.
+type KitComponent struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Purchase order statuses. An open order is received once every line has
+// arrived in full, or closed by hand when no more stock is expected.
+const (
+	PurchaseOrderOpen     = "open"
+	PurchaseOrderReceived = "received"
+	PurchaseOrderClosed   = "closed"
+)
+
+// PurchaseOrder is stock ordered from a supplier. Reference is the
+// purchase order number, unique across orders.
+type PurchaseOrder struct {
+	ID        int                 `json:"id"`
+	Reference string              `json:"reference"`
+	Supplier  string              `json:"supplier,omitempty"`
+	Status    string              `json:"status"`
+	CreatedBy string              `json:"created_by,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+	Lines     []PurchaseOrderLine `json:"lines"`
+}
+
+// PurchaseOrderLine is the quantity of a SKU expected in one warehouse,
+// in base units, with the quantity received so far. Received may exceed
+// Quantity when the supplier sends more than ordered. ExpectedOn is
+// formatted as YYYY-MM-DD.
+type PurchaseOrderLine struct {
+	SKU         string `json:"sku"`
+	WarehouseID int    `json:"warehouse_id"`
+	Quantity    int    `json:"quantity"`
+	Received    int    `json:"received"`
+	ExpectedOn  string `json:"expected_on,omitempty"`
+}
+
+// PurchaseOrderFilter selects the purchase orders to list. Zero fields
+// match every order.
+type PurchaseOrderFilter struct {
+	Status string
+	SKU    string
+	Limit  int
+}
+
+// Receipt is stock received against a purchase order. Each line is a stock
+// update for a SKU and warehouse on the order, and may place the stock in a
+// lot or bin, list its serial numbers or give its quantity in another unit.
+type Receipt struct {
+	Lines []StockUpdate `json:"lines"`
+}
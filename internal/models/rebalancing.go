@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Transfer proposal statuses.
+const (
+	TransferProposed   = "proposed"
+	TransferApproved   = "approved"
+	TransferRejected   = "rejected"
+	TransferSuperseded = "superseded"
+)
+
+// Route is a warehouse stock may be transferred from and one it may be
+// transferred to.
+type Route struct {
+	From int `json:"from_warehouse_id"`
+	To   int `json:"to_warehouse_id"`
+}
+
+// RebalancingConstraints limit the transfers recommended between
+// warehouses. No route is ruled out when Routes is empty.
+type RebalancingConstraints struct {
+	MinTransferQuantity int     `json:"min_transfer_quantity"`
+	Routes              []Route `json:"routes,omitempty"`
+}
+
+// Allows reports whether stock may be transferred from one warehouse to
+// another.
+func (c RebalancingConstraints) Allows(from, to int) bool {
+	if from == to {
+		return false
+	}
+	if len(c.Routes) == 0 {
+		return true
+	}
+	for _, r := range c.Routes {
+		if r.From == from && r.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransferProposal is a recommended transfer of stock between two
+// warehouses with the days of cover of each when it was recommended. Days
+// of cover are null for a warehouse without demand.
+type TransferProposal struct {
+	ID              int       `json:"id"`
+	SKU             string    `json:"sku"`
+	FromWarehouseID int       `json:"from_warehouse_id"`
+	ToWarehouseID   int       `json:"to_warehouse_id"`
+	Quantity        int       `json:"quantity"`
+	FromDaysOfCover *float64  `json:"from_days_of_cover"`
+	ToDaysOfCover   *float64  `json:"to_days_of_cover"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+	DecidedBy       string    `json:"decided_by,omitempty"`
+	TransferID      int       `json:"transfer_id,omitempty"`
+}
+
+// TransferProposalFilter narrows transfer proposals by status or SKU.
+type TransferProposalFilter struct {
+	Status string
+	SKU    string
+	Limit  int
+}
+
+// Transfer is stock moved from one warehouse to another on approval of a
+// proposal.
+type Transfer struct {
+	ID              int       `json:"id"`
+	ProposalID      int       `json:"proposal_id"`
+	SKU             string    `json:"sku"`
+	FromWarehouseID int       `json:"from_warehouse_id"`
+	ToWarehouseID   int       `json:"to_warehouse_id"`
+	Quantity        int       `json:"quantity"`
+	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
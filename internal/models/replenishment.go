@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// ReplenishmentSettings are the parameters reorder suggestions are computed
+// with. Sales velocity is measured over the last WindowDays; stock should
+// last through the supplier lead time plus SafetyStockDays, and an order
+// adds CoverDays of sales on top.
+type ReplenishmentSettings struct {
+	WindowDays      int `json:"window_days"`
+	LeadTimeDays    int `json:"lead_time_days"`
+	SafetyStockDays int `json:"safety_stock_days"`
+	CoverDays       int `json:"cover_days"`
+}
+
+// ReplenishmentFilter narrows replenishment suggestions to a SKU or
+// warehouse, or to those that should be reordered now.
+type ReplenishmentFilter struct {
+	SKU         string
+	WarehouseID int
+	ReorderOnly bool
+	Settings    ReplenishmentSettings
+}
+
+// ReplenishmentSuggestion is the sales velocity, days of cover and reorder
+// quantity of a SKU in one warehouse. Incoming stock on open purchase
+// orders counts towards the reorder point; days of cover counts only the
+// stock on hand. Stock in expired lots is not counted as on hand.
+type ReplenishmentSuggestion struct {
+	SKU               string  `json:"sku"`
+	WarehouseID       int     `json:"warehouse_id"`
+	Name              string  `json:"name"`
+	OnHand            int     `json:"on_hand"`
+	Incoming          int     `json:"incoming"`
+	Sold              int     `json:"sold"`
+	DailyVelocity     float64 `json:"daily_velocity"`
+	DaysOfCover       float64 `json:"days_of_cover"`
+	ReorderPoint      int     `json:"reorder_point"`
+	SuggestedQuantity int     `json:"suggested_quantity"`
+}
+
+// ReplenishmentReport lists reorder suggestions, fewest days of cover first,
+// with the settings they were computed with.
+type ReplenishmentReport struct {
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Settings    ReplenishmentSettings     `json:"settings"`
+	Suggestions []ReplenishmentSuggestion `json:"suggestions"`
+}
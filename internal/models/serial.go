@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Serial statuses.
+const (
+	SerialInStock = "in_stock"
+	SerialSold    = "sold"
+	SerialRemoved = "removed"
+)
+
+// SerialUnit is one unit of a serialized SKU. WarehouseID is set while the
+// unit is in stock.
+type SerialUnit struct {
+	SKU           string           `json:"sku"`
+	SerialNumber  string           `json:"serial_number"`
+	Status        string           `json:"status"`
+	WarehouseID   int              `json:"warehouse_id,omitempty"`
+	WarehouseName string           `json:"warehouse_name,omitempty"`
+	Movements     []SerialMovement `json:"movements"`
+}
+
+// SerialMovement is a ledger entry that moved a serial into or out of a
+// warehouse. Change is 1 for arrivals and -1 for departures.
+type SerialMovement struct {
+	TransactionID int       `json:"transaction_id"`
+	WarehouseID   int       `json:"warehouse_id"`
+	Change        int       `json:"change"`
+	Type          string    `json:"type"`
+	Channel       string    `json:"channel,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
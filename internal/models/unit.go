@@ -0,0 +1,74 @@
+package models
+
+// BaseUnit is the unit every quantity is stored in. Other units of measure
+// are defined per SKU as a whole number of base units.
+const BaseUnit = "each"
+
+// IsBaseUnit reports whether unit names the base unit; an empty unit does.
+func IsBaseUnit(unit string) bool {
+	return unit == "" || unit == BaseUnit
+}
+
+// UnitOfMeasure is a pack size of a SKU, such as an inner pack, case or
+// pallet, holding Factor base units.
+type UnitOfMeasure struct {
+	Unit   string `json:"unit"`
+	Factor int    `json:"factor"`
+}
+
+// UnitStockSummary is a StockSummary restated in a unit of measure of Factor
+// base units. Quantities that are not whole multiples of the unit are
+// fractional.
+type UnitStockSummary struct {
+	SKU         string               `json:"sku"`
+	Kit         bool                 `json:"kit,omitempty"`
+	Unit        string               `json:"unit"`
+	Factor      int                  `json:"factor"`
+	OnHand      float64              `json:"on_hand"`
+	Available   float64              `json:"available"`
+	Incoming    float64              `json:"incoming,omitempty"`
+	NextArrival string               `json:"next_arrival,omitempty"`
+	Warehouses  []UnitWarehouseStock `json:"warehouses"`
+}
+
+type UnitWarehouseStock struct {
+	WarehouseID int     `json:"warehouse_id"`
+	Name        string  `json:"name,omitempty"`
+	Location    string  `json:"location,omitempty"`
+	OnHand      float64 `json:"on_hand"`
+	Available   float64 `json:"available"`
+	Incoming    float64 `json:"incoming,omitempty"`
+	NextArrival string  `json:"next_arrival,omitempty"`
+}
+
+// InUnits converts a quantity of base units to units of factor base units.
+func InUnits(quantity, factor int) float64 {
+	return float64(quantity) / float64(factor)
+}
+
+// InUnit restates s in unit, which holds factor base units.
+func (s StockSummary) InUnit(unit string, factor int) UnitStockSummary {
+	converted := UnitStockSummary{
+		SKU:         s.SKU,
+		Kit:         s.Kit,
+		Unit:        unit,
+		Factor:      factor,
+		OnHand:      InUnits(s.OnHand, factor),
+		Available:   InUnits(s.Available, factor),
+		Incoming:    InUnits(s.Incoming, factor),
+		NextArrival: s.NextArrival,
+		Warehouses:  make([]UnitWarehouseStock, 0, len(s.Warehouses)),
+	}
+	for _, w := range s.Warehouses {
+		converted.Warehouses = append(converted.Warehouses, UnitWarehouseStock{
+			WarehouseID: w.WarehouseID,
+			Name:        w.Name,
+			Location:    w.Location,
+			OnHand:      InUnits(w.OnHand, factor),
+			Available:   InUnits(w.Available, factor),
+			Incoming:    InUnits(w.Incoming, factor),
+			NextArrival: w.NextArrival,
+		})
+	}
+	return converted
+}
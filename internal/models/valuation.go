@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Valuation methods. FIFO costs issued stock from the oldest receipts
+// first; average costs it at the weighted average cost of the stock held
+// in the warehouse.
+const (
+	ValuationFIFO    = "fifo"
+	ValuationAverage = "average"
+)
+
+// IsValidValuationMethod reports whether method is a known valuation method.
+func IsValidValuationMethod(method string) bool {
+	return method == ValuationFIFO || method == ValuationAverage
+}
+
+// CostLayer is stock of a SKU received into one warehouse at one unit cost,
+// with the quantity and value of it not yet issued.
+type CostLayer struct {
+	ID            int       `json:"id"`
+	SKU           string    `json:"sku"`
+	WarehouseID   int       `json:"warehouse_id"`
+	TransactionID int       `json:"transaction_id"`
+	UnitCost      float64   `json:"unit_cost"`
+	Quantity      int       `json:"quantity"`
+	Remaining     int       `json:"remaining"`
+	Value         float64   `json:"value"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ValuationFilter narrows a valuation report to a SKU or warehouse. A zero
+// AsOf values stock now.
+type ValuationFilter struct {
+	SKU         string
+	WarehouseID int
+	AsOf        time.Time
+}
+
+// ValuationReport is the value of the stock held at a point in time, by
+// warehouse. Method is the valuation method issues are currently costed
+// with; earlier issues keep the cost they were recorded at.
+type ValuationReport struct {
+	AsOf       time.Time            `json:"as_of"`
+	Method     string               `json:"method"`
+	Value      float64              `json:"value"`
+	Warehouses []WarehouseValuation `json:"warehouses"`
+}
+
+// WarehouseValuation is the value of the stock held in one warehouse.
+type WarehouseValuation struct {
+	WarehouseID int             `json:"warehouse_id"`
+	Name        string          `json:"name"`
+	Value       float64         `json:"value"`
+	Items       []ItemValuation `json:"items"`
+}
+
+// ItemValuation is the quantity and value of a SKU held in one warehouse,
+// in base units, and its average unit cost.
+type ItemValuation struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Value    float64 `json:"value"`
+	UnitCost float64 `json:"unit_cost"`
+}
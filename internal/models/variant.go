@@ -0,0 +1,33 @@
+package models
+
+// VariantAttribute is an attribute the variants of a parent product differ
+// by, such as size or colour, with the values it may take in display order.
+type VariantAttribute struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// VariantMatrix is the stock of a parent product's variants, ordered along
+// its attributes so they can be laid out as a grid. The parent's totals
+// and warehouses add up the stock of every variant.
+type VariantMatrix struct {
+	SKU        string             `json:"sku"`
+	Attributes []VariantAttribute `json:"attributes"`
+	OnHand     int                `json:"on_hand"`
+	Available  int                `json:"available"`
+	Incoming   int                `json:"incoming,omitempty"`
+	Warehouses []WarehouseStock   `json:"warehouses"`
+	Variants   []VariantStock     `json:"variants"`
+}
+
+// VariantStock is the stock of one variant with its attribute values.
+type VariantStock struct {
+	SKU         string            `json:"sku"`
+	Name        string            `json:"name"`
+	Attributes  map[string]string `json:"attributes"`
+	OnHand      int               `json:"on_hand"`
+	Available   int               `json:"available"`
+	Incoming    int               `json:"incoming,omitempty"`
+	NextArrival string            `json:"next_arrival,omitempty"`
+	Warehouses  []WarehouseStock  `json:"warehouses"`
+}
@@ -0,0 +1,108 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem details responses (RFC 7807).
+const ContentType = "application/problem+json"
+
+// Stable error codes carried in the code member of every problem. Clients
+// should branch on these rather than on titles or details.
+const (
+	CodeValidation        = "validation_failed"
+	CodeNotFound          = "not_found"
+	CodeInsufficientStock = "insufficient_stock"
+	CodeConflict          = "conflict"
+	CodeUnavailable       = "service_unavailable"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeRateLimited       = "rate_limited"
+	CodeInternal          = "internal_error"
+)
+
+var titles = map[string]string{
+	CodeValidation:        "Validation failed",
+	CodeNotFound:          "Resource not found",
+	CodeInsufficientStock: "Insufficient stock",
+	CodeConflict:          "Conflict",
+	CodeUnavailable:       "Service unavailable",
+	CodeUnauthorized:      "Unauthorized",
+	CodeForbidden:         "Forbidden",
+	CodeRateLimited:       "Rate limit exceeded",
+	CodeInternal:          "Internal server error",
+}
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object. Extensions are added as
+// additional top-level members.
+type Problem struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Code       string                 `json:"code"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	Errors     []FieldError           `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// New returns a problem for code with the given status and detail.
+func New(status int, code, detail string) *Problem {
+	title, ok := titles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &Problem{
+		Type:   "urn:omnichannel-inventory:problem:" + code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	data, err := json.Marshal((*plain)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+
+	members := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	// Standard members take precedence over extensions of the same name
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// Abort writes p as the response and stops the handler chain. The instance
+// and request ID are filled in from the request when not already set.
+func Abort(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = c.Writer.Header().Get("X-Request-ID")
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Abort()
+	c.Data(p.Status, ContentType, body)
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"omnichannel_inventory/internal/auth"
+	"omnichannel_inventory/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy selects the rules applied to a request. Every client is held to
+// its role's rule (or Default when the role has none) across all routes,
+// and additionally to the route's rule where one is configured. Routes are
+// keyed by method and route pattern, e.g. "POST /api/orders/simulate".
+type Policy struct {
+	Default Rule
+	Roles   map[string]Rule
+	Routes  map[string]Rule
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+type check struct {
+	key  string
+	rule Rule
+}
+
+func (l *Limiter) checks(c *gin.Context) []check {
+	client := "ip:" + c.ClientIP()
+	role := ""
+	if p := auth.FromContext(c.Request.Context()); p != nil {
+		client = "sub:" + p.Subject
+		role = p.Role
+	}
+
+	var checks []check
+	if rule, ok := l.policy.Roles[role]; ok {
+		checks = append(checks, check{key: client, rule: rule})
+	} else if l.policy.Default.Limit > 0 {
+		checks = append(checks, check{key: client, rule: l.policy.Default})
+	}
+
+	route := c.Request.Method + " " + c.FullPath()
+	if rule, ok := l.policy.Routes[route]; ok {
+		checks = append(checks, check{key: client + ":" + route, rule: rule})
+	}
+	return checks
+}
+
+// Middleware enforces the policy and reports the most restrictive limit in
+// RateLimit-* headers. It must run after authentication so that clients are
+// identified by principal rather than address.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reported *Result
+		var reportedRule Rule
+		now := l.now()
+
+		for _, chk := range l.checks(c) {
+			result, err := l.store.Allow(c.Request.Context(), chk.key, chk.rule, now)
+			if err != nil {
+				// Fail open rather than reject traffic on a limiter fault
+				slog.WarnContext(c.Request.Context(), "rate limit check failed", "key", chk.key, "error", err)
+				continue
+			}
+			if reported == nil || !result.Allowed || (reported.Allowed && result.Remaining < reported.Remaining) {
+				r := result
+				reported, reportedRule = &r, chk.rule
+			}
+			if !result.Allowed {
+				break
+			}
+		}
+		if reported == nil {
+			c.Next()
+			return
+		}
+
+		resetSeconds := strconv.Itoa(int(math.Ceil(reported.Reset.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(reported.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(reported.Remaining))
+		c.Header("RateLimit-Reset", resetSeconds)
+		c.Header("RateLimit-Policy", strconv.Itoa(reportedRule.Limit)+";w="+strconv.Itoa(int(reportedRule.Window.Seconds())))
+
+		if !reported.Allowed {
+			c.Header("Retry-After", resetSeconds)
+			problem.Abort(c, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests. Retry after "+resetSeconds+" seconds."))
+			return
+		}
+		c.Next()
+	}
+}
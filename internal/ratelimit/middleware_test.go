@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(policy Policy, role string) *gin.Engine {
+	limiter := NewLimiter(NewMemoryStore(), policy)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if subject := c.GetHeader("X-Subject"); subject != "" {
+			p := &auth.Principal{Subject: subject, Role: role}
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+		}
+	}, limiter.Middleware())
+	router.GET("/api/stock/:sku", func(c *gin.Context) {})
+	router.POST("/api/orders/simulate", func(c *gin.Context) {})
+	return router
+}
+
+func send(router *gin.Engine, method, target, subject string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	if subject != "" {
+		req.Header.Set("X-Subject", subject)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareRejectsOverLimit(t *testing.T) {
+	router := newTestRouter(Policy{Default: Rule{Limit: 2, Window: time.Minute}}, auth.RoleViewer)
+
+	w := send(router, http.MethodGet, "/api/stock/a", "dash")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	send(router, http.MethodGet, "/api/stock/b", "dash")
+	w = send(router, http.MethodGet, "/api/stock/c", "dash")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Other clients have their own window
+	assert.Equal(t, http.StatusOK, send(router, http.MethodGet, "/api/stock/a", "other").Code)
+}
+
+func TestMiddlewareRouteAndRoleRules(t *testing.T) {
+	router := newTestRouter(Policy{
+		Default: Rule{Limit: 1, Window: time.Minute},
+		Roles:   map[string]Rule{auth.RoleChannelIntegration: {Limit: 100, Window: time.Minute}},
+		Routes:  map[string]Rule{"POST /api/orders/simulate": {Limit: 1, Window: time.Minute}},
+	}, auth.RoleChannelIntegration)
+
+	// The role rule replaces the default
+	assert.Equal(t, http.StatusOK, send(router, http.MethodGet, "/api/stock/a", "shop").Code)
+	assert.Equal(t, http.StatusOK, send(router, http.MethodGet, "/api/stock/a", "shop").Code)
+
+	// The route rule applies on top of it
+	w := send(router, http.MethodPost, "/api/orders/simulate", "shop")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, http.StatusTooManyRequests, send(router, http.MethodPost, "/api/orders/simulate", "shop").Code)
+}
+
+func TestMiddlewareKeysAnonymousClientsByAddress(t *testing.T) {
+	router := newTestRouter(Policy{Default: Rule{Limit: 1, Window: time.Minute}}, "")
+
+	assert.Equal(t, http.StatusOK, send(router, http.MethodGet, "/api/stock/a", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(router, http.MethodGet, "/api/stock/a", "").Code)
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rule allows Limit requests in any sliding window of length Window.
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// ParseRule parses a rule written as "<limit>/<window>", e.g. "100/1m".
+func ParseRule(s string) (Rule, error) {
+	limit, window, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rate limit %q, expected <limit>/<window>", s)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: limit must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: window must be a positive duration", s)
+	}
+	return Rule{Limit: n, Window: d}, nil
+}
+
+// ParseRules parses "key=rule" pairs separated by semicolons, e.g.
+// "viewer=300/1m;channel-integration=120/1m".
+func ParseRules(s string) (map[string]Rule, error) {
+	rules := map[string]Rule{}
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit entry %q, expected <key>=<limit>/<window>", pair)
+		}
+		rule, err := ParseRule(value)
+		if err != nil {
+			return nil, err
+		}
+		rules[strings.TrimSpace(key)] = rule
+	}
+	return rules, nil
+}
+
+// Result describes the outcome of a rate limit check.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the oldest counted request leaves the window.
+	Reset time.Duration
+}
+
+// Store counts requests per key within a sliding window.
+type Store interface {
+	Allow(ctx context.Context, key string, rule Rule, now time.Time) (Result, error)
+}
+
+// sweepEvery is how many checks a MemoryStore performs between sweeps of
+// idle keys.
+const sweepEvery = 1000
+
+// MemoryStore is a process-local sliding window log.
+type MemoryStore struct {
+	mu      sync.Mutex
+	hits    map[string][]time.Time
+	expires map[string]time.Time
+	checks  int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{hits: map[string][]time.Time{}, expires: map[string]time.Time{}}
+}
+
+func (m *MemoryStore) Allow(ctx context.Context, key string, rule Rule, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checks++
+	if m.checks%sweepEvery == 0 {
+		for k, expiry := range m.expires {
+			if !expiry.After(now) {
+				delete(m.hits, k)
+				delete(m.expires, k)
+			}
+		}
+	}
+
+	// Drop requests that have left the window
+	cutoff := now.Add(-rule.Window)
+	hits := m.hits[key]
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	hits = hits[i:]
+
+	result := Result{Limit: rule.Limit}
+	if len(hits) < rule.Limit {
+		hits = append(hits, now)
+		result.Allowed = true
+	}
+	result.Remaining = rule.Limit - len(hits)
+	result.Reset = hits[0].Add(rule.Window).Sub(now)
+
+	m.hits[key] = hits
+	m.expires[key] = hits[len(hits)-1].Add(rule.Window)
+	return result, nil
+}
+
+// FallbackStore uses the primary store and switches to the fallback for
+// any check the primary cannot answer, e.g. while Redis is unreachable.
+type FallbackStore struct {
+	primary  Store
+	fallback Store
+	degraded atomic.Bool
+}
+
+func NewFallbackStore(primary, fallback Store) *FallbackStore {
+	return &FallbackStore{primary: primary, fallback: fallback}
+}
+
+func (f *FallbackStore) Allow(ctx context.Context, key string, rule Rule, now time.Time) (Result, error) {
+	result, err := f.primary.Allow(ctx, key, rule, now)
+	if err == nil {
+		if f.degraded.CompareAndSwap(true, false) {
+			slog.InfoContext(ctx, "rate limiter store recovered, leaving in-memory fallback")
+		}
+		return result, nil
+	}
+	if f.degraded.CompareAndSwap(false, true) {
+		slog.WarnContext(ctx, "rate limiter store unavailable, using in-memory fallback", "error", err)
+	}
+	return f.fallback.Allow(ctx, key, rule, now)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("100/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Limit: 100, Window: time.Minute}, rule)
+
+	for _, bad := range []string{"100", "0/1m", "x/1m", "10/soon", "10/-1s"} {
+		_, err := ParseRule(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("viewer=300/1m; POST /api/orders/simulate=20/10s")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Rule{
+		"viewer":                    {Limit: 300, Window: time.Minute},
+		"POST /api/orders/simulate": {Limit: 20, Window: 10 * time.Second},
+	}, rules)
+
+	_, err = ParseRules("viewer")
+	assert.Error(t, err)
+}
+
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	store := NewMemoryStore()
+	rule := Rule{Limit: 2, Window: time.Minute}
+	start := time.Now()
+	ctx := context.Background()
+
+	r, _ := store.Allow(ctx, "k", rule, start)
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 1, r.Remaining)
+
+	r, _ = store.Allow(ctx, "k", rule, start.Add(30*time.Second))
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+
+	r, _ = store.Allow(ctx, "k", rule, start.Add(45*time.Second))
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 15*time.Second, r.Reset)
+
+	// The first request has left the window
+	r, _ = store.Allow(ctx, "k", rule, start.Add(61*time.Second))
+	assert.True(t, r.Allowed)
+
+	r, _ = store.Allow(ctx, "other", rule, start.Add(45*time.Second))
+	assert.True(t, r.Allowed)
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(ctx context.Context, key string, rule Rule, now time.Time) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackStore(t *testing.T) {
+	store := NewFallbackStore(failingStore{}, NewMemoryStore())
+	rule := Rule{Limit: 1, Window: time.Minute}
+
+	r, err := store.Allow(context.Background(), "k", rule, time.Now())
+	require.NoError(t, err)
+	assert.True(t, r.Allowed)
+
+	r, err = store.Allow(context.Background(), "k", rule, time.Now())
+	require.NoError(t, err)
+	assert.False(t, r.Allowed)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// slidingWindowScript keeps one sorted-set member per request scored by its
+// timestamp in milliseconds. It trims expired members, admits the request if
+// there is room and returns {allowed, count, oldest score}.
+const slidingWindowScript = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, member)
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local oldestScore = now
+if oldest[2] then
+	oldestScore = tonumber(oldest[2])
+end
+return {allowed, count, oldestScore}
+`
+
+type Evaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+}
+
+// RedisStore shares sliding windows across all API instances.
+type RedisStore struct {
+	client Evaler
+	prefix string
+}
+
+func NewRedisStore(client Evaler) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, rule Rule, now time.Time) (Result, error) {
+	nowMs := now.UnixMilli()
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63())
+	values, err := s.client.Eval(ctx, slidingWindowScript, []string{s.prefix + key},
+		nowMs, rule.Window.Milliseconds(), rule.Limit, member).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply %v", values)
+	}
+
+	reset := time.Duration(values[2]+rule.Window.Milliseconds()-nowMs) * time.Millisecond
+	return Result{
+		Allowed:   values[0] == 1,
+		Limit:     rule.Limit,
+		Remaining: rule.Limit - int(values[1]),
+		Reset:     reset,
+	}, nil
+}
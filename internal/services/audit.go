@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+)
+
+// auditLockKey serialises appends to the audit chain across connections.
+const auditLockKey = 727100
+
+const defaultAuditLimit = 100
+
+// recordAudit appends an entry to the hash-chained audit log within tx. The
+// actor, request ID and source IP are taken from the request metadata in ctx;
+// the request ID and source IP are cut to their column widths so that an
+// over-long header cannot fail the change being audited.
+func recordAudit(ctx context.Context, tx db.Tx, entry models.AuditEntry) error {
+	meta := audit.FromContext(ctx)
+	entry.Actor = meta.Actor
+	entry.RequestID = truncate(meta.RequestID, audit.MaxRequestIDLength)
+	entry.SourceIP = truncate(meta.SourceIP, audit.MaxSourceIPLength)
+
+	// Held until the transaction ends so the chain stays linear
+	if err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, auditLockKey); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`)
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&entry.PrevHash); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Postgres stores microseconds; truncate so the hash can be re-verified
+	entry.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash = audit.Hash(entry.PrevHash, entry)
+
+	sql := `
+		INSERT INTO audit_log (
+			occurred_at, actor, request_id, source_ip, action, sku, warehouse_id,
+			change, channel, reason, reason_code, transaction_id, prev_hash, hash
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+	return tx.Exec(ctx, sql,
+		entry.OccurredAt, entry.Actor, entry.RequestID, entry.SourceIP, entry.Action,
+		entry.SKU, entry.WarehouseID, entry.Change, entry.Channel, entry.Reason,
+		entry.ReasonCode, entry.TransactionID, entry.PrevHash, entry.Hash,
+	)
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+const auditColumns = `
+	id, occurred_at, actor, request_id, source_ip, action, sku, warehouse_id,
+	change, channel, reason, reason_code, transaction_id, prev_hash, hash
+`
+
+func scanAuditEntry(rows db.Rows) (models.AuditEntry, error) {
+	var e models.AuditEntry
+	err := rows.Scan(&e.ID, &e.OccurredAt, &e.Actor, &e.RequestID, &e.SourceIP, &e.Action,
+		&e.SKU, &e.WarehouseID, &e.Change, &e.Channel, &e.Reason, &e.ReasonCode,
+		&e.TransactionID, &e.PrevHash, &e.Hash)
+	return e, err
+}
+
+// ListAuditEntries returns audit entries matching the filter, newest first.
+func (s *InventoryService) ListAuditEntries(ctx context.Context, filter models.AuditFilter) (_ []models.AuditEntry, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ListAuditEntries")
+	defer end(span, &err)
+	var conditions []string
+	var args []interface{}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.SKU != "" {
+		addCondition("sku = $%d", filter.SKU)
+	}
+	if filter.Actor != "" {
+		addCondition("actor = $%d", filter.Actor)
+	}
+	if filter.ReasonCode != "" {
+		addCondition("reason_code = $%d", filter.ReasonCode)
+	}
+	if !filter.From.IsZero() {
+		addCondition("occurred_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("occurred_at <= $%d", filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	sql := "SELECT " + auditColumns + " FROM audit_log"
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	sql += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// VerifyAuditChain walks the audit log in order and recomputes every hash,
+// reporting the first entry whose stored hash or back-link does not match.
+func (s *InventoryService) VerifyAuditChain(ctx context.Context) (_ models.AuditVerification, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.VerifyAuditChain")
+	defer end(span, &err)
+	rows, err := s.db.Query(ctx, "SELECT "+auditColumns+" FROM audit_log ORDER BY id")
+	if err != nil {
+		return models.AuditVerification{}, err
+	}
+	defer rows.Close()
+
+	result := models.AuditVerification{Valid: true}
+	prevHash := ""
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return models.AuditVerification{}, err
+		}
+		result.EntriesChecked++
+		if e.PrevHash != prevHash || audit.Hash(prevHash, e) != e.Hash {
+			result.Valid = false
+			result.FirstInvalidID = e.ID
+			break
+		}
+		prevHash = e.Hash
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAuditChainsToPreviousEntry(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT hash FROM audit_log"] = [][]interface{}{{"prevhash"}}
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{Actor: "alice", RequestID: "req-1", SourceIP: "10.0.0.1"})
+
+	tx, _ := fdb.Begin(ctx)
+	err := recordAudit(ctx, tx, models.AuditEntry{Action: "order", SKU: "test", WarehouseID: 1, Change: -2, ReasonCode: models.ReasonSale})
+	assert.Nil(t, err)
+
+	insert := fdb.statements("INSERT INTO audit_log")[0]
+	assert.Equal(t, "alice", insert.args[1])
+	assert.Equal(t, "req-1", insert.args[2])
+	assert.Equal(t, "10.0.0.1", insert.args[3])
+	assert.Equal(t, "prevhash", insert.args[12])
+	assert.Len(t, fdb.statements("pg_advisory_xact_lock"), 1)
+}
+
+func TestRecordAuditCapsRequestID(t *testing.T) {
+	fdb := newFakeDB()
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{Actor: "alice", RequestID: strings.Repeat("r", 300)})
+
+	tx, _ := fdb.Begin(ctx)
+	err := recordAudit(ctx, tx, models.AuditEntry{Action: "order", SKU: "test", WarehouseID: 1, Change: -2, ReasonCode: models.ReasonSale})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("r", audit.MaxRequestIDLength), fdb.statements("INSERT INTO audit_log")[0].args[2])
+}
+
+func auditRow(e models.AuditEntry) []interface{} {
+	return []interface{}{e.ID, e.OccurredAt, e.Actor, e.RequestID, e.SourceIP, e.Action, e.SKU,
+		e.WarehouseID, e.Change, e.Channel, e.Reason, e.ReasonCode, e.TransactionID, e.PrevHash, e.Hash}
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	first := models.AuditEntry{ID: 1, OccurredAt: time.Now(), Actor: "alice", Action: "stock_update", SKU: "test", WarehouseID: 1, Change: 5, ReasonCode: models.ReasonReceipt, TransactionID: 1}
+	first.Hash = audit.Hash("", first)
+	second := models.AuditEntry{ID: 2, OccurredAt: time.Now(), Actor: "bob", Action: "order", SKU: "test", WarehouseID: 1, Change: -1, ReasonCode: models.ReasonSale, TransactionID: 2, PrevHash: first.Hash}
+	second.Hash = audit.Hash(first.Hash, second)
+
+	fdb := newFakeDB()
+	fdb.results["FROM audit_log"] = [][]interface{}{auditRow(first), auditRow(second)}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	result, err := svc.VerifyAuditChain(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, models.AuditVerification{Valid: true, EntriesChecked: 2}, result)
+
+	second.Change = -100
+	fdb.results["FROM audit_log"] = [][]interface{}{auditRow(first), auditRow(second)}
+	result, err = svc.VerifyAuditChain(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, models.AuditVerification{Valid: false, EntriesChecked: 2, FirstInvalidID: 2}, result)
+}
+
+func TestListAuditEntriesFilters(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.ListAuditEntries(context.Background(), models.AuditFilter{SKU: "test", Actor: "alice"})
+	assert.Nil(t, err)
+	q := fdb.queries[0]
+	assert.Contains(t, q.sql, "WHERE sku = $1 AND actor = $2")
+	assert.Contains(t, q.sql, "LIMIT $3")
+	assert.Equal(t, []interface{}{"test", "alice", defaultAuditLimit}, q.args)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"omnichannel_inventory/internal/tracing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/puddle"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NotFoundError reports that a requested resource does not exist.
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found", e.Resource, e.ID)
+}
+
+// InsufficientStockError reports an order that available stock cannot cover.
+type InsufficientStockError struct {
+	SKU       string
+	Requested int
+	Available int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for SKU %s: requested %d, available %d", e.SKU, e.Requested, e.Available)
+}
+
+// Shortfall is the number of units missing to fulfil the request.
+func (e *InsufficientStockError) Shortfall() int {
+	return e.Requested - e.Available
+}
+
+// FieldError describes why a single input field was rejected.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError reports every invalid field of a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Invalid returns a validation error for a single field.
+func Invalid(field, message string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + " " + f.Message
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// add records an invalid field when ok is false.
+func (e *ValidationError) add(ok bool, field, message string) {
+	if !ok {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	}
+}
+
+// err returns e if any field was invalid and nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ConflictError reports a change that clashed with a concurrent one or with
+// existing data. Retrying may succeed.
+type ConflictError struct {
+	Err error
+}
+
+func (e *ConflictError) Error() string {
+	return "conflicting update: " + e.Err.Error()
+}
+
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+// UnavailableError reports that a dependency could not be reached in time.
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return "dependency unavailable: " + e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+// PostgreSQL error codes treated as conflicts.
+var conflictCodes = map[string]bool{
+	"23505": true, // unique_violation
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+}
+
+// classify converts database and network failures into ConflictError or
+// UnavailableError. Other errors, including the typed errors above, are
+// returned unchanged.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		conflict    *ConflictError
+		unavailable *UnavailableError
+		pgErr       *pgconn.PgError
+		netErr      net.Error
+	)
+	switch {
+	case errors.As(err, &conflict), errors.As(err, &unavailable):
+		return err
+	case errors.As(err, &pgErr) && conflictCodes[pgErr.Code]:
+		return &ConflictError{Err: err}
+	case errors.Is(err, context.DeadlineExceeded), pgconn.Timeout(err), errors.Is(err, puddle.ErrClosedPool), errors.As(err, &netErr):
+		return &UnavailableError{Err: err}
+	}
+	return err
+}
+
+// end classifies err for the caller and ends span with the result.
+func end(span trace.Span, err *error) {
+	*err = classify(*err)
+	tracing.End(span, *err)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	var conflict *ConflictError
+	assert.ErrorAs(t, classify(fmt.Errorf("insert: %w", &pgconn.PgError{Code: "40001"})), &conflict)
+
+	var unavailable *UnavailableError
+	assert.ErrorAs(t, classify(context.DeadlineExceeded), &unavailable)
+
+	plain := errors.New("boom")
+	assert.Equal(t, plain, classify(plain))
+	assert.Equal(t, conflict, classify(conflict), "classified errors are not wrapped again")
+	assert.Nil(t, classify(nil))
+}
+
+func TestValidateStockUpdate(t *testing.T) {
+	svc := NewInventoryService(newFakeDB(), &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{ReasonCode: "bogus"})
+	var validation *ValidationError
+	assert.ErrorAs(t, err, &validation)
+	assert.Equal(t, []FieldError{
+		{Field: "sku", Message: "is required"},
+		{Field: "warehouse_id", Message: "must be a positive integer"},
+		{Field: "quantity", Message: "must not be zero"},
+		{Field: "reason_code", Message: "is not a known reason code"},
+	}, validation.Fields)
+}
+
+func TestValidateOrder(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	// The channel is stored in the ledger and audit log, both 50 characters wide
+	_, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: strings.Repeat("c", 51), Quantity: 1})
+	var validation *ValidationError
+	assert.ErrorAs(t, err, &validation)
+	assert.Equal(t, []FieldError{{Field: "channel", Message: "must be at most 50 characters"}}, validation.Fields)
+	assert.Empty(t, fdb.statements("INSERT INTO audit_log"))
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type execCall struct {
+	sql  string
+	args []interface{}
+}
+
+// fakeDB records every statement and answers Query calls from a table of
+// canned results keyed by a fragment of the SQL text.
+type fakeDB struct {
+	execs   []execCall
+	queries []execCall
+	results map[string][][]interface{}
+	execErr error
+	// rowsErr is reported by every result set once it is read to the end
+	rowsErr   error
+	commits   int
+	rollbacks int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{results: map[string][][]interface{}{}}
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	f.execs = append(f.execs, execCall{sql: sql, args: args})
+	return f.execErr
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error) {
+	f.queries = append(f.queries, execCall{sql: sql, args: args})
+	for fragment, rows := range f.results {
+		if strings.Contains(sql, fragment) {
+			return &fakeRows{rows: rows, pos: -1, err: f.rowsErr}, nil
+		}
+	}
+	return &fakeRows{pos: -1, err: f.rowsErr}, nil
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (db.Tx, error) {
+	return &fakeTx{f}, nil
+}
+
+// fakeTx shares the recorded calls and canned results of its fakeDB.
+type fakeTx struct {
+	*fakeDB
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	t.rollbacks++
+	return nil
+}
+
+type fakeRows struct {
+	rows [][]interface{}
+	pos  int
+	err  error
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error { return r.err }
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	row := r.rows[r.pos]
+	if len(dest) != len(row) {
+		return fmt.Errorf("scan: expected %d columns, got %d", len(row), len(dest))
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(row[i]))
+	}
+	return nil
+}
+
+// statements returns the recorded Exec and Query calls whose SQL contains fragment.
+func (f *fakeDB) statements(fragment string) []execCall {
+	var matched []execCall
+	for _, calls := range [][]execCall{f.execs, f.queries} {
+		for _, c := range calls {
+			if strings.Contains(c.sql, fragment) {
+				matched = append(matched, c)
+			}
+		}
+	}
+	return matched
+}
+
+type fakeRedis struct {
+	published []interface{}
+	// streams and streamed hold the stream and values of each XAdd
+	streams  []string
+	streamed []map[string]interface{}
+}
+
+func (f *fakeRedis) Publish(ctx context.Context, channel string, message interface{}) error {
+	f.published = append(f.published, message)
+	return nil
+}
+
+func (f *fakeRedis) XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd {
+	f.streams = append(f.streams, args.Stream)
+	f.streamed = append(f.streamed, args.Values.(map[string]interface{}))
+	return redis.NewStringResult("1-0", nil)
+}
+
+// fakeCache serves stored summaries and records invalidated SKUs.
+type fakeCache struct {
+	summaries   map[string]models.StockSummary
+	invalidated []string
+}
+
+func (f *fakeCache) Get(ctx context.Context, sku string, load func(ctx context.Context) (models.StockSummary, error)) (models.StockSummary, error) {
+	if summary, ok := f.summaries[sku]; ok {
+		return summary, nil
+	}
+	return load(ctx)
+}
+
+func (f *fakeCache) Invalidate(ctx context.Context, skus ...string) error {
+	f.invalidated = append(f.invalidated, skus...)
+	return nil
+}
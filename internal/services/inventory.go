@@ -2,34 +2,169 @@ package services
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
 	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/events"
 	"omnichannel_inventory/internal/models"
-	"time"
+	"omnichannel_inventory/internal/tracing"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type InventoryService struct {
 	db    DB
 	redis Redis
+	cache StockCache
+
+	lowStockThreshold int
+
+	expiryNotifier  ExpiryNotifier
+	expiryAlertDays int
+
+	replenishment         models.ReplenishmentSettings
+	replenishmentNotifier ReplenishmentNotifier
+	rebalancing           models.RebalancingConstraints
+
+	valuationMethod string
 }
 
 type DB interface {
 	Exec(ctx context.Context, sql string, args ...interface{}) error
 	Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error)
+	Begin(ctx context.Context) (db.Tx, error)
 }
 
 type Redis interface {
 	Publish(ctx context.Context, channel string, message interface{}) error
+	XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd
+}
+
+// StockCache caches stock summaries per SKU. Get calls load on a miss;
+// Invalidate is called after every committed stock change.
+type StockCache interface {
+	Get(ctx context.Context, sku string, load func(ctx context.Context) (models.StockSummary, error)) (models.StockSummary, error)
+	Invalidate(ctx context.Context, skus ...string) error
 }
 
 func NewInventoryService(db DB, redis Redis) *InventoryService {
 	return &InventoryService{
-		db:    db,
-		redis: redis,
+		db:            db,
+		redis:         redis,
+		replenishment: defaultReplenishmentSettings,
+		rebalancing:   defaultRebalancingConstraints,
+
+		valuationMethod: models.ValuationFIFO,
 	}
 }
 
-func (s *InventoryService) AddOrUpdateStock(ctx context.Context, update models.StockUpdate) error {
+// SetStockCache enables read-through caching of consolidated stock.
+func (s *InventoryService) SetStockCache(cache StockCache) {
+	s.cache = cache
+}
+
+// withTx runs fn inside a transaction, committing only if fn succeeds.
+func (s *InventoryService) withTx(ctx context.Context, fn func(tx db.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// recordTransaction appends a row to the inventory ledger and returns its ID.
+// A lotID of zero records a change to stock outside any lot. cost is the
+// value the change adds to stock, negative for stock issued.
+func recordTransaction(ctx context.Context, tx db.Tx, sku string, warehouseID, change int, txType, channel string, lotID int, cost float64) (int, error) {
+	sql := `
+		INSERT INTO inventory_transactions (sku, warehouse_id, change, type, channel, timestamp, lot_id, cost)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, 0), $8)
+		RETURNING id
+	`
+	rows, err := tx.Query(ctx, sql, sku, warehouseID, change, txType, channel, ledgerTime(time.Now()), lotID, cost)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var id int
+	if rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+	return id, rows.Err()
+}
+
+func (s *InventoryService) AddOrUpdateStock(ctx context.Context, update models.StockUpdate) (err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.AddOrUpdateStock", attribute.String("sku", update.SKU), attribute.Int("warehouse_id", update.WarehouseID))
+	defer end(span, &err)
+	if err := validateStockUpdate(update); err != nil {
+		return err
+	}
+	quantity := update.Quantity
+	if update.Quantity, err = s.toBaseUnits(ctx, update.SKU, update.Unit, update.Quantity); err != nil {
+		return err
+	}
+	update.Unit = ""
+	update.UnitCost = costPerBaseUnit(update.UnitCost, quantity, update.Quantity)
+	if update.ReasonCode == "" {
+		update.ReasonCode = models.ReasonAdjustment
+	}
+
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		_, _, err := s.applyStockUpdate(ctx, tx, update, "stock_update")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Publish events
+	s.publishInventoryEvents(ctx, events.InventoryEvent{
+		SKU:         update.SKU,
+		WarehouseID: update.WarehouseID,
+		Change:      update.Quantity,
+		Reason:      update.ReasonCode,
+	})
+	return s.redis.Publish(ctx, "inventory_updates", update)
+}
+
+// applyStockUpdate writes a validated stock update in base units to the
+// stock levels, lots, serials, bins and cost layers of the SKU, and records
+// it in the ledger as txType and in the audit trail. It returns the ledger
+// entry and the value the update added to stock, negative for stock
+// removed.
+func (s *InventoryService) applyStockUpdate(ctx context.Context, tx db.Tx, update models.StockUpdate, txType string) (int, float64, error) {
+	serialized, err := isSerialized(ctx, tx, update.SKU)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := checkSerialMode(serialized, update.SerialNumbers, update.LotNumber); err != nil {
+		return 0, 0, err
+	}
+	components, err := kitComponents(ctx, tx, update.SKU)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(components) > 0 {
+		return 0, 0, Invalid("sku", "is a kit; update the stock of its components instead")
+	}
+	parent, err := isParentProduct(ctx, tx, update.SKU)
+	if err != nil {
+		return 0, 0, err
+	}
+	if parent {
+		return 0, 0, Invalid("sku", "is a parent product; update the stock of its variants instead")
+	}
+
 	// Update stock in database
 	sql := `
 		INSERT INTO stock_levels (sku, warehouse_id, quantity)
@@ -37,109 +172,422 @@ func (s *InventoryService) AddOrUpdateStock(ctx context.Context, update models.S
 		ON CONFLICT (sku, warehouse_id) DO UPDATE
 		SET quantity = stock_levels.quantity + $3
 	`
-	if err := s.db.Exec(ctx, sql, update.SKU, update.WarehouseID, update.Quantity); err != nil {
-		return err
+	if err := tx.Exec(ctx, sql, update.SKU, update.WarehouseID, update.Quantity); err != nil {
+		return 0, 0, err
+	}
+
+	// Lotted stock is also tracked per lot
+	var lotID int
+	if update.LotNumber != "" {
+		if lotID, err = adjustLotStock(ctx, tx, update); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Value the change: stock removed is costed from the cost layers, and
+	// stock added opens a layer of its own
+	var unitCost, value float64
+	if update.Quantity < 0 {
+		cost, err := s.issueCost(ctx, tx, update.SKU, update.WarehouseID, -update.Quantity)
+		if err != nil {
+			return 0, 0, err
+		}
+		value = -cost
+	} else {
+		if unitCost, err = receiptUnitCost(ctx, tx, update); err != nil {
+			return 0, 0, err
+		}
+		value = roundCost(float64(update.Quantity) * unitCost)
 	}
 
 	// Record transaction
-	sql = `
-		INSERT INTO inventory_transactions (sku, warehouse_id, change, type, timestamp)
-		VALUES ($1, $2, $3, 'stock_update', $4)
-	`
-	if err := s.db.Exec(ctx, sql, update.SKU, update.WarehouseID, update.Quantity, time.Now()); err != nil {
-		return err
+	txID, err := recordTransaction(ctx, tx, update.SKU, update.WarehouseID, update.Quantity, txType, "", lotID, value)
+	if err != nil {
+		return 0, 0, err
+	}
+	if update.Quantity > 0 {
+		if err := addCostLayer(ctx, tx, update, txID, unitCost, value); err != nil {
+			return 0, 0, err
+		}
+	}
+	if serialized {
+		if err := moveSerials(ctx, tx, update, txID); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := adjustBinStock(ctx, tx, update, txID); err != nil {
+		return 0, 0, err
 	}
 
-	// Publish event
-	return s.redis.Publish(ctx, "inventory_updates", update)
+	err = recordAudit(ctx, tx, models.AuditEntry{
+		Action:        txType,
+		SKU:           update.SKU,
+		WarehouseID:   update.WarehouseID,
+		Change:        update.Quantity,
+		Reason:        update.Reason,
+		ReasonCode:    update.ReasonCode,
+		TransactionID: txID,
+	})
+	return txID, value, err
+}
+
+// GetConsolidatedStock returns the stock summary of sku. It returns a
+// *NotFoundError if no warehouse has ever stocked the SKU or has it on
+// order, and it is not a kit.
+func (s *InventoryService) GetConsolidatedStock(ctx context.Context, sku string) (_ models.StockSummary, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetConsolidatedStock", attribute.String("sku", sku))
+	defer end(span, &err)
+
+	summary, err := s.stockSummary(ctx, sku)
+	if err != nil {
+		return models.StockSummary{}, err
+	}
+	if len(summary.Warehouses) == 0 && !summary.Kit {
+		return models.StockSummary{}, &NotFoundError{Resource: "SKU", ID: sku}
+	}
+	return summary, nil
+}
+
+// MaxStockSummarySKUs bounds the SKUs requested from GetStockSummaries.
+const MaxStockSummarySKUs = 100
+
+// GetStockSummaries returns the stock summary of each SKU in the order
+// given. SKUs that have never been stocked have zero totals and no
+// warehouses.
+func (s *InventoryService) GetStockSummaries(ctx context.Context, skus []string) (_ []models.StockSummary, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetStockSummaries", attribute.Int("sku_count", len(skus)))
+	defer end(span, &err)
+	if len(skus) == 0 {
+		return nil, Invalid("skus", "is required")
+	}
+	if len(skus) > MaxStockSummarySKUs {
+		return nil, Invalid("skus", fmt.Sprintf("must list at most %d SKUs", MaxStockSummarySKUs))
+	}
+
+	summaries := make([]models.StockSummary, 0, len(skus))
+	for _, sku := range skus {
+		summary, err := s.stockSummary(ctx, sku)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// stockSummary reads the summary of sku through the cache when one is set.
+func (s *InventoryService) stockSummary(ctx context.Context, sku string) (models.StockSummary, error) {
+	load := func(ctx context.Context) (models.StockSummary, error) {
+		return s.loadStockSummary(ctx, sku)
+	}
+	if s.cache != nil {
+		return s.cache.Get(ctx, sku, load)
+	}
+	return load(ctx)
 }
 
-func (s *InventoryService) GetConsolidatedStock(ctx context.Context, sku string) ([]models.StockLevel, error) {
+func (s *InventoryService) loadStockSummary(ctx context.Context, sku string) (models.StockSummary, error) {
+	components, err := kitComponents(ctx, s.db, sku)
+	if err != nil {
+		return models.StockSummary{}, err
+	}
+	if len(components) > 0 {
+		return s.loadKitSummary(ctx, sku, components)
+	}
+
 	sql := `
-		SELECT sku, warehouse_id, quantity
-		FROM stock_levels
-		WHERE sku = $1
+		SELECT sl.warehouse_id, COALESCE(w.name, ''), COALESCE(w.location, ''), sl.quantity
+		FROM stock_levels sl
+		LEFT JOIN warehouses w ON w.id = sl.warehouse_id
+		WHERE sl.sku = $1
+		ORDER BY sl.warehouse_id
 	`
 	rows, err := s.db.Query(ctx, sql, sku)
 	if err != nil {
-		return nil, err
+		return models.StockSummary{}, err
 	}
 	defer rows.Close()
 
-	var levels []models.StockLevel
+	var warehouses []models.WarehouseStock
 	for rows.Next() {
-		var level models.StockLevel
-		if err := rows.Scan(&level.SKU, &level.WarehouseID, &level.Quantity); err != nil {
-			return nil, err
+		var w models.WarehouseStock
+		if err := rows.Scan(&w.WarehouseID, &w.Name, &w.Location, &w.OnHand); err != nil {
+			return models.StockSummary{}, err
 		}
-		levels = append(levels, level)
+		warehouses = append(warehouses, w)
 	}
-	return levels, nil
+	if err := rows.Err(); err != nil {
+		return models.StockSummary{}, err
+	}
+	summary := newStockSummary(sku, warehouses)
+	return summary, s.addIncoming(ctx, &summary)
+}
+
+// newStockSummary totals the warehouse balances of sku. A negative balance
+// counts against on-hand stock but nothing in that warehouse is available,
+// matching how orders are allocated.
+func newStockSummary(sku string, warehouses []models.WarehouseStock) models.StockSummary {
+	summary := models.StockSummary{SKU: sku, Warehouses: []models.WarehouseStock{}}
+	for _, w := range warehouses {
+		w.Available = max(w.OnHand, 0)
+		summary.OnHand += w.OnHand
+		summary.Available += w.Available
+		summary.Warehouses = append(summary.Warehouses, w)
+	}
+	return summary
 }
 
-func (s *InventoryService) SimulateOrder(ctx context.Context, order models.Order) error {
-	// Get available stock
+// GetWarehouseTotals returns the number of SKUs and units held in each warehouse.
+func (s *InventoryService) GetWarehouseTotals(ctx context.Context) (_ []models.WarehouseTotals, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetWarehouseTotals")
+	defer end(span, &err)
 	sql := `
-		SELECT warehouse_id, quantity
+		SELECT warehouse_id, COUNT(*)::int, COALESCE(SUM(quantity), 0)::int
 		FROM stock_levels
-		WHERE sku = $1 AND quantity > 0
-		ORDER BY quantity DESC
+		GROUP BY warehouse_id
+		ORDER BY warehouse_id
 	`
-	rows, err := s.db.Query(ctx, sql, order.SKU)
+	rows, err := s.db.Query(ctx, sql)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
-	remaining := order.Quantity
+	var totals []models.WarehouseTotals
 	for rows.Next() {
-		var warehouseID, quantity int
-		if err := rows.Scan(&warehouseID, &quantity); err != nil {
+		var t models.WarehouseTotals
+		if err := rows.Scan(&t.WarehouseID, &t.SKUs, &t.Units); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// SimulateOrder deducts an order from stock and returns where it was
+// allocated from. An order for a kit deducts its components instead, all
+// or nothing.
+func (s *InventoryService) SimulateOrder(ctx context.Context, order models.Order) (_ []models.Allocation, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.SimulateOrder", attribute.String("sku", order.SKU), attribute.String("channel", order.Channel))
+	defer end(span, &err)
+	if err := validateOrder(order); err != nil {
+		return nil, err
+	}
+	if order.Quantity, err = s.toBaseUnits(ctx, order.SKU, order.Unit, order.Quantity); err != nil {
+		return nil, err
+	}
+	order.Unit = ""
+	if order.ReasonCode == "" {
+		order.ReasonCode = models.ReasonSale
+	}
+
+	var allocations []allocation
+	var kit bool
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		// Plan the allocation before writing so a shortage leaves stock untouched
+		components, err := kitComponents(ctx, tx, order.SKU)
+		if err != nil {
+			return err
+		}
+		parent, err := isParentProduct(ctx, tx, order.SKU)
+		if err != nil {
+			return err
+		}
+		if parent {
+			return Invalid("sku", "is a parent product; order one of its variants instead")
+		}
+		kit = len(components) > 0
+		if kit {
+			allocations, err = planKitOrder(ctx, tx, order, components)
+		} else {
+			allocations, err = planOrder(ctx, tx, order)
+		}
+		if err != nil {
 			return err
 		}
 
-		toDeduct := min(remaining, quantity)
-		if toDeduct > 0 {
+		for i := range allocations {
+			a := &allocations[i]
 			// Update stock
-			sql = `
+			sql := `
 				UPDATE stock_levels
 				SET quantity = quantity - $1
 				WHERE sku = $2 AND warehouse_id = $3
 			`
-			if err := s.db.Exec(ctx, sql, toDeduct, order.SKU, warehouseID); err != nil {
+			if err := tx.Exec(ctx, sql, a.quantity, a.sku, a.warehouseID); err != nil {
 				return err
 			}
+			if a.lotID != 0 {
+				sql = `
+					UPDATE lot_stock
+					SET quantity = quantity - $1
+					WHERE lot_id = $2 AND warehouse_id = $3
+				`
+				if err := tx.Exec(ctx, sql, a.quantity, a.lotID, a.warehouseID); err != nil {
+					return err
+				}
+			}
 
-			// Record transaction
-			sql = `
-				INSERT INTO inventory_transactions (sku, warehouse_id, change, type, channel, timestamp)
-				VALUES ($1, $2, $3, 'order', $4, $5)
-			`
-			if err := s.db.Exec(ctx, sql, order.SKU, warehouseID, -toDeduct, order.Channel, time.Now()); err != nil {
+			// Cost the goods sold and record the transaction
+			if a.cost, err = s.issueCost(ctx, tx, a.sku, a.warehouseID, a.quantity); err != nil {
+				return err
+			}
+			txID, err := recordTransaction(ctx, tx, a.sku, a.warehouseID, -a.quantity, "order", order.Channel, a.lotID, -a.cost)
+			if err != nil {
+				return err
+			}
+			if len(a.serials) > 0 {
+				if err := sellSerials(ctx, tx, a.serials, txID); err != nil {
+					return err
+				}
+			}
+			if err := takePicks(ctx, tx, a.sku, a.warehouseID, a.picks, txID); err != nil {
 				return err
 			}
 
-			remaining -= toDeduct
-			if remaining == 0 {
-				break
+			err = recordAudit(ctx, tx, models.AuditEntry{
+				Action:        "order",
+				SKU:           a.sku,
+				WarehouseID:   a.warehouseID,
+				Change:        -a.quantity,
+				Channel:       order.Channel,
+				Reason:        order.Reason,
+				ReasonCode:    order.ReasonCode,
+				TransactionID: txID,
+			})
+			if err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Publish events
+	changes := make([]events.InventoryEvent, 0, len(allocations))
+	result := make([]models.Allocation, 0, len(allocations))
+	for _, a := range allocations {
+		changes = append(changes, events.InventoryEvent{
+			SKU:         a.sku,
+			WarehouseID: a.warehouseID,
+			Change:      -a.quantity,
+			Channel:     order.Channel,
+			Reason:      order.ReasonCode,
+		})
+		m := a.model()
+		if kit {
+			m.SKU = a.sku
+		}
+		result = append(result, m)
+	}
+	s.publishInventoryEvents(ctx, changes...)
+	return result, s.redis.Publish(ctx, "inventory_updates", order)
+}
+
+// planOrder locks the stock of the ordered SKU and plans where the order is
+// taken from. Serialized SKUs sell the named serials, or else the
+// longest-held serials of the warehouses with the most stock; other SKUs
+// are allocated by planAllocation.
+func planOrder(ctx context.Context, tx db.Tx, order models.Order) ([]allocation, error) {
+	warehouses, err := lockStockLevels(ctx, tx, order.SKU)
+	if err != nil {
+		return nil, err
+	}
+
+	serialized, err := isSerialized(ctx, tx, order.SKU)
+	if err != nil {
+		return nil, err
+	}
+	if !serialized && len(order.SerialNumbers) > 0 {
+		return nil, Invalid("serial_numbers", "are only accepted for serialized SKUs")
 	}
 
+	var allocations []allocation
+	var remaining int
+	switch {
+	case serialized && len(order.SerialNumbers) > 0:
+		byWarehouse, err := lockSerials(ctx, tx, order.SKU, order.SerialNumbers)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range warehouses {
+			if units := byWarehouse[w.warehouseID]; len(units) > 0 {
+				allocations = append(allocations, allocation{warehouseID: w.warehouseID, quantity: len(units), serials: units})
+				delete(byWarehouse, w.warehouseID)
+			}
+		}
+		// Serials in a warehouse without positive stock cannot be sold
+		for _, units := range byWarehouse {
+			remaining += len(units)
+		}
+	case serialized:
+		allocations, remaining = planAllocation(order.Quantity, warehouses, nil)
+		for i := range allocations {
+			a := &allocations[i]
+			if a.serials, err = pickSerials(ctx, tx, order.SKU, a.warehouseID, a.quantity); err != nil {
+				return nil, err
+			}
+			remaining += a.quantity - len(a.serials)
+			a.quantity = len(a.serials)
+		}
+	default:
+		lots, err := lockLotStock(ctx, tx, order.SKU)
+		if err != nil {
+			return nil, err
+		}
+		allocations, remaining = planAllocation(order.Quantity, warehouses, lots)
+	}
 	if remaining > 0 {
-		return errors.New("insufficient stock")
+		return nil, &InsufficientStockError{SKU: order.SKU, Requested: order.Quantity, Available: order.Quantity - remaining}
+	}
+	for i := range allocations {
+		allocations[i].sku = order.SKU
+	}
+	return allocations, planOrderPicks(ctx, tx, order.SKU, warehouses, allocations)
+}
+
+// lockStockLevels returns the warehouses with positive stock of sku, most
+// stock first, locking the rows an order may deduct from.
+func lockStockLevels(ctx context.Context, tx db.Tx, sku string) ([]warehouseQuantity, error) {
+	sql := `
+		SELECT warehouse_id, quantity
+		FROM stock_levels
+		WHERE sku = $1 AND quantity > 0
+		ORDER BY quantity DESC
+		FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Publish event
-	return s.redis.Publish(ctx, "inventory_updates", order)
+	var warehouses []warehouseQuantity
+	for rows.Next() {
+		var w warehouseQuantity
+		if err := rows.Scan(&w.warehouseID, &w.quantity); err != nil {
+			return nil, err
+		}
+		warehouses = append(warehouses, w)
+	}
+	return warehouses, rows.Err()
 }
 
-func (s *InventoryService) GetInventoryHistory(ctx context.Context, sku string) ([]models.InventoryTransaction, error) {
+func (s *InventoryService) GetInventoryHistory(ctx context.Context, sku string) (_ []models.InventoryTransaction, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetInventoryHistory", attribute.String("sku", sku))
+	defer end(span, &err)
 	sql := `
-		SELECT id, sku, warehouse_id, change, type, channel, timestamp
-		FROM inventory_transactions
-		WHERE sku = $1
-		ORDER BY timestamp DESC
+		SELECT t.id, t.sku, t.warehouse_id, t.change, t.type, COALESCE(t.channel, ''), COALESCE(l.lot_number, ''),
+			COALESCE(po.reference, ''), t.cost::float8, t.timestamp
+		FROM inventory_transactions t
+		LEFT JOIN lots l ON l.id = t.lot_id
+		LEFT JOIN purchase_order_receipts r ON r.transaction_id = t.id
+		LEFT JOIN purchase_order_lines pl ON pl.id = r.line_id
+		LEFT JOIN purchase_orders po ON po.id = pl.purchase_order_id
+		WHERE t.sku = $1
+		ORDER BY t.timestamp DESC
 	`
 	rows, err := s.db.Query(ctx, sql, sku)
 	if err != nil {
@@ -150,12 +598,77 @@ func (s *InventoryService) GetInventoryHistory(ctx context.Context, sku string)
 	var transactions []models.InventoryTransaction
 	for rows.Next() {
 		var t models.InventoryTransaction
-		if err := rows.Scan(&t.ID, &t.SKU, &t.WarehouseID, &t.Change, &t.Type, &t.Channel, &t.Timestamp); err != nil {
+		if err := rows.Scan(&t.ID, &t.SKU, &t.WarehouseID, &t.Change, &t.Type, &t.Channel, &t.LotNumber, &t.PurchaseOrder, &t.Cost, &t.Timestamp); err != nil {
 			return nil, err
 		}
 		transactions = append(transactions, t)
 	}
-	return transactions, nil
+	return transactions, rows.Err()
+}
+
+// validateStockUpdate reports every invalid field of update.
+func validateStockUpdate(update models.StockUpdate) error {
+	v := &ValidationError{}
+	v.add(update.SKU != "", "sku", "is required")
+	v.add(update.WarehouseID > 0, "warehouse_id", "must be a positive integer")
+	v.add(update.Quantity != 0, "quantity", "must not be zero")
+	v.add(update.ReasonCode == "" || models.IsValidReasonCode(update.ReasonCode), "reason_code", "is not a known reason code")
+	v.add(len(update.LotNumber) <= 100, "lot_number", "must be at most 100 characters")
+	manufactured, okManufactured := parseDate(update.ManufacturedOn)
+	expires, okExpires := parseDate(update.ExpiresOn)
+	v.add(okManufactured, "manufactured_on", "must be a date formatted as YYYY-MM-DD")
+	v.add(okExpires, "expires_on", "must be a date formatted as YYYY-MM-DD")
+	v.add(manufactured.IsZero() || expires.IsZero() || !expires.Before(manufactured), "expires_on", "must not be before manufactured_on")
+	hasDates := update.ManufacturedOn != "" || update.ExpiresOn != ""
+	v.add(update.LotNumber != "" || !hasDates, "lot_number", "is required when lot dates are given")
+	validateSerialNumbers(v, update.SerialNumbers, abs(update.Quantity))
+	v.add(len(update.Bin) <= 255, "bin", "must be at most 255 characters")
+	v.add(len(update.SerialNumbers) == 0 || models.IsBaseUnit(update.Unit), "unit", "must be each when serial numbers are given")
+	v.add(update.UnitCost == nil || *update.UnitCost >= 0, "unit_cost", "must not be negative")
+	v.add(update.UnitCost == nil || update.Quantity > 0, "unit_cost", "is only accepted for stock added")
+	return v.err()
+}
+
+// validateOrder reports every invalid field of order.
+func validateOrder(order models.Order) error {
+	v := &ValidationError{}
+	v.add(order.SKU != "", "sku", "is required")
+	v.add(order.Channel != "", "channel", "is required")
+	v.add(len(order.Channel) <= 50, "channel", "must be at most 50 characters")
+	v.add(order.Quantity > 0, "quantity", "must be a positive integer")
+	v.add(order.ReasonCode == "" || models.IsValidReasonCode(order.ReasonCode), "reason_code", "is not a known reason code")
+	validateSerialNumbers(v, order.SerialNumbers, order.Quantity)
+	v.add(len(order.SerialNumbers) == 0 || models.IsBaseUnit(order.Unit), "unit", "must be each when serial numbers are given")
+	return v.err()
+}
+
+// publishInventoryEvents invalidates the cached stock of the changed SKUs
+// and adds the committed changes to the inventory stream. It runs before the
+// change is acknowledged, so later reads never see the cached stock from
+// before it. The changes are already durable, so failures are logged rather
+// than reported to the caller.
+func (s *InventoryService) publishInventoryEvents(ctx context.Context, changes ...events.InventoryEvent) {
+	if s.cache != nil {
+		var skus []string
+		seen := map[string]bool{}
+		for _, event := range changes {
+			if !seen[event.SKU] {
+				seen[event.SKU] = true
+				skus = append(skus, event.SKU)
+			}
+		}
+		if err := s.cache.Invalidate(ctx, skus...); err != nil {
+			slog.ErrorContext(ctx, "error invalidating stock cache", "skus", skus, "error", err)
+		}
+		// Kits derive their stock from their components
+		s.invalidateKits(ctx, skus)
+	}
+	for _, event := range changes {
+		if err := events.PublishInventoryEvent(ctx, s.redis, event); err != nil {
+			slog.ErrorContext(ctx, "error adding inventory event to stream",
+				"sku", event.SKU, "warehouse_id", event.WarehouseID, "error", err)
+		}
+	}
 }
 
 func min(a, b int) int {
@@ -163,4 +676,18 @@ func min(a, b int) int {
 		return a
 	}
 	return b
-} 
\ No newline at end of file
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -4,27 +4,178 @@ import (
 	"context"
 	"testing"
 
+	"omnichannel_inventory/internal/events"
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/models"
+
 	"github.com/stretchr/testify/assert"
 )
 
 func TestAddOrUpdateStock(t *testing.T) {
-	err := AddOrUpdateStock(context.Background(), "test", 1, 10)
+	fdb, fredis := newFakeDB(), &fakeRedis{}
+	fdb.results["RETURNING id"] = [][]interface{}{{42}}
+	svc := NewInventoryService(fdb, fredis)
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 10})
 	assert.Nil(t, err)
+	assert.Len(t, fdb.statements("INSERT INTO stock_levels"), 1)
+	assert.Len(t, fdb.statements("INSERT INTO inventory_transactions"), 1)
+
+	audits := fdb.statements("INSERT INTO audit_log")
+	assert.Len(t, audits, 1)
+	assert.Equal(t, models.ReasonAdjustment, audits[0].args[10])
+	assert.Equal(t, 42, audits[0].args[11])
+	assert.Equal(t, 1, fdb.commits)
+	assert.Len(t, fredis.published, 1)
+	assert.Len(t, fredis.streamed, 1)
+	assert.Equal(t, 10, fredis.streamed[0]["change"])
 }
 
 func TestGetConsolidatedStock(t *testing.T) {
-	stock, err := GetConsolidatedStock(context.Background(), "test")
+	fdb := newFakeDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, "Main", "Berlin", 5}, {2, "", "", -2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	stock, err := svc.GetConsolidatedStock(context.Background(), "test")
+	assert.Nil(t, err)
+	assert.Equal(t, models.StockSummary{
+		SKU:       "test",
+		OnHand:    3,
+		Available: 5,
+		Warehouses: []models.WarehouseStock{
+			{WarehouseID: 1, Name: "Main", Location: "Berlin", OnHand: 5, Available: 5},
+			{WarehouseID: 2, OnHand: -2, Available: 0},
+		},
+	}, stock)
+}
+
+func TestGetStockSummaries(t *testing.T) {
+	svc := NewInventoryService(newFakeDB(), &fakeRedis{})
+	svc.SetStockCache(&fakeCache{summaries: map[string]models.StockSummary{
+		"a": {SKU: "a", OnHand: 5, Available: 5, Warehouses: []models.WarehouseStock{{WarehouseID: 1, OnHand: 5, Available: 5}}},
+	}})
+
+	summaries, err := svc.GetStockSummaries(context.Background(), []string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, 5, summaries[0].Available)
+	assert.Equal(t, models.StockSummary{SKU: "b", Warehouses: []models.WarehouseStock{}}, summaries[1])
+
+	_, err = svc.GetStockSummaries(context.Background(), nil)
+	var validation *ValidationError
+	assert.ErrorAs(t, err, &validation)
+}
+
+func TestGetConsolidatedStockCached(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	cached := models.StockSummary{SKU: "test", OnHand: 5, Available: 5, Warehouses: []models.WarehouseStock{{WarehouseID: 1, OnHand: 5, Available: 5}}}
+	svc.SetStockCache(&fakeCache{summaries: map[string]models.StockSummary{"test": cached}})
+
+	stock, err := svc.GetConsolidatedStock(context.Background(), "test")
 	assert.Nil(t, err)
-	assert.Equal(t, 0, stock)
+	assert.Equal(t, cached, stock)
+	assert.Empty(t, fdb.queries)
+
+	_, err = svc.GetConsolidatedStock(context.Background(), "unknown")
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestStockChangesInvalidateCache(t *testing.T) {
+	fdb, cache := newFakeDB(), &fakeCache{}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 3}, {2, 2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetStockCache(cache)
+
+	_, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 4})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test"}, cache.invalidated, "one invalidation per SKU, however many warehouses changed")
+
+	_, err = svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 10})
+	assert.Error(t, err)
+	assert.Len(t, cache.invalidated, 1, "rolled back changes leave the cache alone")
 }
 
 func TestSimulateOrder(t *testing.T) {
-	err := SimulateOrder(context.Background(), "test", "amazon", 1)
+	fdb, fredis := newFakeDB(), &fakeRedis{}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 3}, {2, 2}}
+	svc := NewInventoryService(fdb, fredis)
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 4})
 	assert.Nil(t, err)
+	assert.Equal(t, []models.Allocation{{WarehouseID: 1, Quantity: 3}, {WarehouseID: 2, Quantity: 1}}, allocations)
+	ledger := fdb.statements("INSERT INTO inventory_transactions")
+	assert.Len(t, ledger, 2)
+	assert.Equal(t, -3, ledger[0].args[2])
+	assert.Equal(t, -1, ledger[1].args[2])
+	assert.Len(t, fdb.statements("INSERT INTO audit_log"), 2)
+	assert.Len(t, fredis.published, 1)
+
+	// One stream event per warehouse the order was allocated from
+	assert.Len(t, fredis.streamed, 2)
+	assert.Equal(t, 1, fredis.streamed[0]["warehouse_id"])
+	assert.Equal(t, -3, fredis.streamed[0]["change"])
+	assert.Equal(t, "amazon", fredis.streamed[0]["channel"])
+}
+
+// Committed stock changes are added to the inventory stream, whose consumer
+// raises low stock alerts and webhooks.
+func TestStockChangesAreStreamed(t *testing.T) {
+	fdb, fredis := newFakeDB(), &fakeRedis{}
+	fdb.results["RETURNING id"] = [][]interface{}{{42}}
+	svc := NewInventoryService(fdb, fredis)
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+
+	err := svc.AddOrUpdateStock(ctx, models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -4, ReasonCode: models.ReasonDamage})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{events.InventoryStream}, fredis.streams)
+	assert.Equal(t, map[string]interface{}{
+		"sku":          "test",
+		"warehouse_id": 1,
+		"change":       -4,
+		"channel":      "",
+		"reason":       models.ReasonDamage,
+		"request_id":   "req-1",
+	}, fredis.streamed[0])
+
+	// Nothing is streamed when the change is not committed
+	fdb.execErr = assert.AnError
+	err = svc.AddOrUpdateStock(ctx, models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 5})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Len(t, fredis.streamed, 1)
+}
+
+func TestSimulateOrderInsufficientStock(t *testing.T) {
+	fdb, fredis := newFakeDB(), &fakeRedis{}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 3}, {2, 2}}
+	svc := NewInventoryService(fdb, fredis)
+
+	_, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 10})
+	var shortage *InsufficientStockError
+	assert.ErrorAs(t, err, &shortage)
+	assert.Equal(t, &InsufficientStockError{SKU: "test", Requested: 10, Available: 5}, shortage)
+	assert.Equal(t, 5, shortage.Shortfall())
+	assert.Empty(t, fdb.statements("UPDATE stock_levels"))
+	assert.Equal(t, 1, fdb.rollbacks)
+	assert.Empty(t, fredis.published)
+	assert.Empty(t, fredis.streamed)
 }
 
 func TestGetInventoryHistory(t *testing.T) {
-	history, err := GetInventoryHistory(context.Background(), "test")
+	svc := NewInventoryService(newFakeDB(), &fakeRedis{})
+
+	history, err := svc.GetInventoryHistory(context.Background(), "test")
 	assert.Nil(t, err)
 	assert.Nil(t, history)
-} 
\ No newline at end of file
+}
+
+func TestGetWarehouseTotals(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["GROUP BY warehouse_id"] = [][]interface{}{{1, 3, 120}, {2, 1, 5}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	totals, err := svc.GetWarehouseTotals(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []models.WarehouseTotals{{WarehouseID: 1, SKUs: 3, Units: 120}, {WarehouseID: 2, SKUs: 1, Units: 5}}, totals)
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+)
+
+// maxKitComponents bounds the components of one kit.
+const maxKitComponents = 50
+
+// querier runs queries on the database or inside a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (db.Rows, error)
+}
+
+// validateKitComponents reports components that are missing a SKU, repeat
+// one, name the kit itself or have no quantity.
+func validateKitComponents(v *ValidationError, sku string, components []models.KitComponent) {
+	v.add(len(components) <= maxKitComponents, "components", fmt.Sprintf("must list at most %d components", maxKitComponents))
+	seen := map[string]bool{}
+	for _, c := range components {
+		switch {
+		case c.SKU == "" || len(c.SKU) > 100:
+			v.add(false, "components", "must each have a SKU of at most 100 characters")
+		case c.SKU == sku:
+			v.add(false, "components", "must not include the kit itself")
+		case seen[c.SKU]:
+			v.add(false, "components", fmt.Sprintf("%s is listed more than once", c.SKU))
+		default:
+			v.add(c.Quantity > 0, "components", fmt.Sprintf("%s must have a positive quantity", c.SKU))
+		}
+		seen[c.SKU] = true
+	}
+}
+
+// kitComponents returns the components of sku in SKU order, or none if sku
+// is not a kit.
+func kitComponents(ctx context.Context, q querier, sku string) ([]models.KitComponent, error) {
+	sql := `
+		SELECT component_sku, quantity
+		FROM kit_components
+		WHERE kit_sku = $1
+		ORDER BY component_sku
+	`
+	rows, err := q.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var components []models.KitComponent
+	for rows.Next() {
+		var c models.KitComponent
+		if err := rows.Scan(&c.SKU, &c.Quantity); err != nil {
+			return nil, err
+		}
+		components = append(components, c)
+	}
+	return components, rows.Err()
+}
+
+// saveKitComponents replaces the components of sku. A kit's components
+// must not be kits or parent products, and a component of another kit
+// cannot become a kit.
+func saveKitComponents(ctx context.Context, tx db.Tx, sku string, components []models.KitComponent) error {
+	if len(components) > 0 {
+		skus := make([]string, len(components))
+		for i, c := range components {
+			skus[i] = c.SKU
+		}
+		sql := `
+			SELECT EXISTS (SELECT 1 FROM kit_components WHERE kit_sku = ANY($1)),
+				EXISTS (SELECT 1 FROM kit_components WHERE component_sku = $2),
+				EXISTS (SELECT 1 FROM variant_attributes WHERE parent_sku = ANY($1))
+		`
+		var nested, isComponent, parent bool
+		if err := queryRow(ctx, tx, sql, []interface{}{skus, sku}, &nested, &isComponent, &parent); err != nil {
+			return err
+		}
+		v := &ValidationError{}
+		v.add(!nested, "components", "must not be kits themselves")
+		v.add(!parent, "components", "must not be parent products; list their variants instead")
+		v.add(!isComponent, "components", "cannot be defined for a component of another kit")
+		if err := v.err(); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec(ctx, `DELETE FROM kit_components WHERE kit_sku = $1`, sku); err != nil {
+		return err
+	}
+	if len(components) == 0 {
+		return nil
+	}
+	skus := make([]string, len(components))
+	quantities := make([]int, len(components))
+	for i, c := range components {
+		skus[i], quantities[i] = c.SKU, c.Quantity
+	}
+	sql := `
+		INSERT INTO kit_components (kit_sku, component_sku, quantity)
+		SELECT $1, unnest($2::text[]), unnest($3::int[])
+	`
+	return tx.Exec(ctx, sql, sku, skus, quantities)
+}
+
+// loadKitSummary derives the stock of a kit from its components: each
+// warehouse stocking every component holds as many kits as its scarcest
+// component makes up.
+func (s *InventoryService) loadKitSummary(ctx context.Context, sku string, components []models.KitComponent) (models.StockSummary, error) {
+	skus := make([]string, len(components))
+	for i, c := range components {
+		skus[i] = c.SKU
+	}
+	sql := `
+		SELECT sl.sku, sl.warehouse_id, COALESCE(w.name, ''), COALESCE(w.location, ''), sl.quantity
+		FROM stock_levels sl
+		LEFT JOIN warehouses w ON w.id = sl.warehouse_id
+		WHERE sl.sku = ANY($1)
+		ORDER BY sl.warehouse_id
+	`
+	rows, err := s.db.Query(ctx, sql, skus)
+	if err != nil {
+		return models.StockSummary{}, err
+	}
+	defer rows.Close()
+
+	var warehouses []models.WarehouseStock
+	stock := map[int]map[string]int{}
+	for rows.Next() {
+		var component string
+		var w models.WarehouseStock
+		var quantity int
+		if err := rows.Scan(&component, &w.WarehouseID, &w.Name, &w.Location, &quantity); err != nil {
+			return models.StockSummary{}, err
+		}
+		if stock[w.WarehouseID] == nil {
+			stock[w.WarehouseID] = map[string]int{}
+			warehouses = append(warehouses, w)
+		}
+		stock[w.WarehouseID][component] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return models.StockSummary{}, err
+	}
+
+	var kitWarehouses []models.WarehouseStock
+	for _, w := range warehouses {
+		kits, ok := kitsFrom(components, func(c models.KitComponent) (int, bool) {
+			quantity, ok := stock[w.WarehouseID][c.SKU]
+			return max(quantity, 0), ok
+		})
+		if ok {
+			w.OnHand = kits
+			kitWarehouses = append(kitWarehouses, w)
+		}
+	}
+	summary := newStockSummary(sku, kitWarehouses)
+	summary.Kit = true
+	return summary, nil
+}
+
+// kitsFrom returns the number of whole kits made up by the stock of each
+// component that available reports. It reports false if a component is
+// not stocked at all.
+func kitsFrom(components []models.KitComponent, available func(models.KitComponent) (int, bool)) (int, bool) {
+	kits := -1
+	for _, c := range components {
+		quantity, ok := available(c)
+		if !ok {
+			return 0, false
+		}
+		if n := quantity / c.Quantity; kits < 0 || n < kits {
+			kits = n
+		}
+	}
+	return max(kits, 0), true
+}
+
+// componentStock is the locked stock of one kit component.
+type componentStock struct {
+	component  models.KitComponent
+	serialized bool
+	warehouses []warehouseQuantity
+	lots       []lotQuantity
+}
+
+// allocatable returns the quantity of the component orders can take from a
+// warehouse, which excludes expired lots.
+func (c componentStock) allocatable(warehouseID int) (int, bool) {
+	for _, w := range c.warehouses {
+		if w.warehouseID == warehouseID {
+			_, remaining := planAllocation(w.quantity, []warehouseQuantity{w}, c.lots)
+			return w.quantity - remaining, true
+		}
+	}
+	return 0, false
+}
+
+// planKitOrder locks the stock of a kit's components and plans an order
+// for the kit. Every kit is assembled in one warehouse, taking the
+// warehouses that can make up the most kits first, so the components of a
+// warehouse are allocated together or not at all.
+func planKitOrder(ctx context.Context, tx db.Tx, order models.Order, components []models.KitComponent) ([]allocation, error) {
+	if len(order.SerialNumbers) > 0 {
+		return nil, Invalid("serial_numbers", "are not accepted for kits")
+	}
+
+	// Components are in SKU order, so concurrent kit orders lock them alike
+	stocks := make([]componentStock, len(components))
+	for i, c := range components {
+		warehouses, err := lockStockLevels(ctx, tx, c.SKU)
+		if err != nil {
+			return nil, err
+		}
+		serialized, err := isSerialized(ctx, tx, c.SKU)
+		if err != nil {
+			return nil, err
+		}
+		var lots []lotQuantity
+		if !serialized {
+			if lots, err = lockLotStock(ctx, tx, c.SKU); err != nil {
+				return nil, err
+			}
+		}
+		stocks[i] = componentStock{component: c, serialized: serialized, warehouses: warehouses, lots: lots}
+	}
+
+	type warehouseKits struct{ warehouseID, kits int }
+	var candidates []warehouseKits
+	available := 0
+	for _, w := range stocks[0].warehouses {
+		kits, ok := kitsFrom(components, func(c models.KitComponent) (int, bool) {
+			for _, stock := range stocks {
+				if stock.component.SKU == c.SKU {
+					return stock.allocatable(w.warehouseID)
+				}
+			}
+			return 0, false
+		})
+		if ok && kits > 0 {
+			candidates = append(candidates, warehouseKits{w.warehouseID, kits})
+			available += kits
+		}
+	}
+	if available < order.Quantity {
+		return nil, &InsufficientStockError{SKU: order.SKU, Requested: order.Quantity, Available: available}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].kits > candidates[j].kits })
+
+	var allocations []allocation
+	remaining := order.Quantity
+	for _, candidate := range candidates {
+		if remaining == 0 {
+			break
+		}
+		kits := min(remaining, candidate.kits)
+		remaining -= kits
+		for _, stock := range stocks {
+			quantity := kits * stock.component.Quantity
+			var warehouse []warehouseQuantity
+			for _, w := range stock.warehouses {
+				if w.warehouseID == candidate.warehouseID {
+					warehouse = append(warehouse, w)
+				}
+			}
+			planned, _ := planAllocation(quantity, warehouse, stock.lots)
+			for i := range planned {
+				a := &planned[i]
+				a.sku = stock.component.SKU
+				if !stock.serialized {
+					continue
+				}
+				units, err := pickSerials(ctx, tx, a.sku, a.warehouseID, a.quantity)
+				if err != nil {
+					return nil, err
+				}
+				if len(units) < a.quantity {
+					return nil, &InsufficientStockError{SKU: a.sku, Requested: quantity, Available: len(units)}
+				}
+				a.serials = units
+			}
+			if err := planOrderPicks(ctx, tx, stock.component.SKU, stock.warehouses, planned); err != nil {
+				return nil, err
+			}
+			allocations = append(allocations, planned...)
+		}
+	}
+	return allocations, nil
+}
+
+// kitsContaining returns the kits that have any of skus as a component.
+func (s *InventoryService) kitsContaining(ctx context.Context, skus []string) ([]string, error) {
+	rows, err := s.db.Query(ctx, `SELECT DISTINCT kit_sku FROM kit_components WHERE component_sku = ANY($1)`, skus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kits []string
+	for rows.Next() {
+		var kit string
+		if err := rows.Scan(&kit); err != nil {
+			return nil, err
+		}
+		kits = append(kits, kit)
+	}
+	return kits, rows.Err()
+}
+
+// invalidateKits drops the cached stock of the kits built from skus, whose
+// stock has changed.
+func (s *InventoryService) invalidateKits(ctx context.Context, skus []string) {
+	kits, err := s.kitsContaining(ctx, skus)
+	if err != nil {
+		slog.ErrorContext(ctx, "error finding kits to invalidate", "skus", skus, "error", err)
+		return
+	}
+	if len(kits) == 0 {
+		return
+	}
+	if err := s.cache.Invalidate(ctx, kits...); err != nil {
+		slog.ErrorContext(ctx, "error invalidating stock cache", "skus", kits, "error", err)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConsolidatedStockOfKit(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["WHERE kit_sku = $1"] = [][]interface{}{{"a", 2}, {"b", 1}}
+	fdb.results["sl.sku = ANY"] = [][]interface{}{
+		{"a", 1, "Main", "", 11},
+		{"b", 1, "Main", "", 3},
+		{"a", 2, "East", "", 8},
+		{"a", 3, "West", "", 4},
+		{"b", 3, "West", "", -1},
+	}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	stock, err := svc.GetConsolidatedStock(context.Background(), "kit")
+	require.NoError(t, err)
+	assert.Equal(t, models.StockSummary{
+		SKU:       "kit",
+		Kit:       true,
+		OnHand:    3,
+		Available: 3,
+		Warehouses: []models.WarehouseStock{
+			{WarehouseID: 1, Name: "Main", OnHand: 3, Available: 3},
+			{WarehouseID: 3, Name: "West", OnHand: 0, Available: 0},
+		},
+	}, stock, "warehouses missing a component hold no kits")
+
+	// A kit whose components were never stocked is still known
+	delete(fdb.results, "sl.sku = ANY")
+	stock, err = svc.GetConsolidatedStock(context.Background(), "kit")
+	require.NoError(t, err)
+	assert.Equal(t, models.StockSummary{SKU: "kit", Kit: true, Warehouses: []models.WarehouseStock{}}, stock)
+}
+
+func TestSimulateOrderForKit(t *testing.T) {
+	fdb, fredis := newFakeDB(), &fakeRedis{}
+	fdb.results["WHERE kit_sku = $1"] = [][]interface{}{{"a", 2}, {"b", 1}}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 10}, {2, 3}}
+	svc := NewInventoryService(fdb, fredis)
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "kit", Channel: "amazon", Quantity: 6})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Allocation{
+		{SKU: "a", WarehouseID: 1, Quantity: 10},
+		{SKU: "b", WarehouseID: 1, Quantity: 5},
+		{SKU: "a", WarehouseID: 2, Quantity: 2},
+		{SKU: "b", WarehouseID: 2, Quantity: 1},
+	}, allocations, "each kit is assembled in one warehouse")
+
+	var deducted [][]interface{}
+	for _, update := range fdb.statements("UPDATE stock_levels") {
+		deducted = append(deducted, update.args)
+	}
+	assert.Equal(t, [][]interface{}{{10, "a", 1}, {5, "b", 1}, {2, "a", 2}, {1, "b", 2}}, deducted)
+	ledger := fdb.statements("INSERT INTO inventory_transactions")
+	require.Len(t, ledger, 4)
+	assert.Equal(t, []interface{}{"a", -10}, []interface{}{ledger[0].args[0], ledger[0].args[2]})
+	assert.Equal(t, models.Order{SKU: "kit", Channel: "amazon", Quantity: 6, ReasonCode: models.ReasonSale}, fredis.published[0])
+}
+
+func TestSimulateOrderForKitShortage(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["WHERE kit_sku = $1"] = [][]interface{}{{"a", 2}, {"b", 1}}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 10}, {2, 3}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "kit", Channel: "amazon", Quantity: 7})
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, &InsufficientStockError{SKU: "kit", Requested: 7, Available: 6}, shortage)
+	assert.Empty(t, fdb.statements("UPDATE stock_levels"), "no component is deducted")
+	assert.Equal(t, 1, fdb.rollbacks)
+
+	_, err = svc.SimulateOrder(context.Background(), models.Order{SKU: "kit", Channel: "amazon", Quantity: 1, SerialNumbers: []string{"S1"}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "serial_numbers", invalid.Fields[0].Field)
+}
+
+func TestComponentChangesInvalidateKits(t *testing.T) {
+	fdb, cache := newFakeDB(), &fakeCache{}
+	fdb.results["SELECT DISTINCT kit_sku"] = [][]interface{}{{"kit"}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetStockCache(cache)
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "a", WarehouseID: 1, Quantity: 5})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "kit"}, cache.invalidated)
+}
+
+func TestAddOrUpdateStockRejectsKits(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["WHERE kit_sku = $1"] = [][]interface{}{{"a", 2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "kit", WarehouseID: 1, Quantity: 5})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "sku", Message: "is a kit; update the stock of its components instead"}}, invalid.Fields)
+	assert.Empty(t, fdb.statements("INSERT INTO stock_levels"))
+}
+
+func TestValidateProductComponents(t *testing.T) {
+	err := validateProduct(models.Product{SKU: "kit", Name: "Gift set", Serialized: true, Components: []models.KitComponent{
+		{SKU: "kit", Quantity: 1},
+		{SKU: "a", Quantity: 0},
+		{SKU: "b", Quantity: 1},
+		{SKU: "b", Quantity: 2},
+	}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{
+		{Field: "components", Message: "must not include the kit itself"},
+		{Field: "components", Message: "a must have a positive quantity"},
+		{Field: "components", Message: "b is listed more than once"},
+		{Field: "serialized", Message: "must be false for kits"},
+	}, invalid.Fields)
+}
+
+func TestSaveProductKit(t *testing.T) {
+	fdb, cache := newFakeDB(), &fakeCache{}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetStockCache(cache)
+
+	product, err := svc.SaveProduct(context.Background(), models.Product{SKU: "kit", Name: "Gift set", Components: []models.KitComponent{
+		{SKU: "b", Quantity: 1},
+		{SKU: "a", Quantity: 2},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.KitComponent{{SKU: "a", Quantity: 2}, {SKU: "b", Quantity: 1}}, product.Components)
+	inserts := fdb.statements("INSERT INTO kit_components")
+	require.Len(t, inserts, 1)
+	assert.Equal(t, []interface{}{"kit", []string{"a", "b"}, []int{2, 1}}, inserts[0].args)
+	assert.Equal(t, []string{"kit"}, cache.invalidated)
+
+	// Kits cannot be nested
+	fdb.results["kit_sku = ANY"] = [][]interface{}{{true, false, false}}
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "kit", Name: "Gift set", Components: []models.KitComponent{{SKU: "a", Quantity: 2}}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "components", Message: "must not be kits themselves"}}, invalid.Fields)
+
+	// Nor can a SKU holding stock become a kit
+	delete(fdb.results, "kit_sku = ANY")
+	fdb.results["FROM stock_levels WHERE sku = $1 AND quantity <> 0"] = [][]interface{}{{false, true}}
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "kit", Name: "Gift set", Components: []models.KitComponent{{SKU: "a", Quantity: 2}}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "components", Message: "cannot be defined while the SKU holds stock"}}, invalid.Fields)
+	assert.Len(t, fdb.statements("INSERT INTO kit_components"), 1)
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SnapshotLag keeps snapshots slightly behind wall-clock time so that
+// transactions still in flight when a snapshot is taken are not missed.
+const SnapshotLag = time.Minute
+
+// ledgerTime converts t to the time zone of ledger and snapshot timestamps.
+// Those columns have no time zone and hold the server's local time, so every
+// time written to or compared with them must be passed through ledgerTime.
+func ledgerTime(t time.Time) time.Time {
+	return t.Local()
+}
+
+// GetStockAsOf reconstructs per-warehouse stock for a SKU at a point in time
+// from the most recent snapshot plus the ledger entries recorded after it.
+func (s *InventoryService) GetStockAsOf(ctx context.Context, sku string, asOf time.Time) (_ []models.StockLevel, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetStockAsOf", attribute.String("sku", sku))
+	defer end(span, &err)
+	asOf = ledgerTime(asOf)
+
+	sql := `
+		WITH base AS (
+			SELECT snapshot_at
+			FROM stock_snapshot_runs
+			WHERE snapshot_at <= $2
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		)
+		SELECT $1::varchar, warehouse_id, SUM(quantity)::int
+		FROM (
+			SELECT s.warehouse_id, s.quantity
+			FROM stock_snapshots s
+			JOIN base ON s.snapshot_at = base.snapshot_at
+			WHERE s.sku = $1
+			UNION ALL
+			SELECT t.warehouse_id, t.change
+			FROM inventory_transactions t
+			WHERE t.sku = $1
+				AND t.timestamp <= $2
+				AND t.timestamp > COALESCE((SELECT snapshot_at FROM base), '-infinity')
+		) ledger
+		GROUP BY warehouse_id
+		ORDER BY warehouse_id
+	`
+	rows, err := s.db.Query(ctx, sql, sku, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var levels []models.StockLevel
+	for rows.Next() {
+		var level models.StockLevel
+		if err := rows.Scan(&level.SKU, &level.WarehouseID, &level.Quantity); err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, rows.Err()
+}
+
+// GetStockSummaryAsOf returns the stock summary of sku at a point in time,
+// with the current name and location of each warehouse.
+func (s *InventoryService) GetStockSummaryAsOf(ctx context.Context, sku string, asOf time.Time) (_ models.StockSummary, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetStockSummaryAsOf", attribute.String("sku", sku))
+	defer end(span, &err)
+	levels, err := s.GetStockAsOf(ctx, sku, asOf)
+	if err != nil {
+		return models.StockSummary{}, err
+	}
+	if len(levels) == 0 {
+		return newStockSummary(sku, nil), nil
+	}
+
+	ids := make([]int, len(levels))
+	for i, level := range levels {
+		ids[i] = level.WarehouseID
+	}
+	sql := `
+		SELECT id, name, COALESCE(location, '')
+		FROM warehouses
+		WHERE id = ANY($1)
+	`
+	rows, err := s.db.Query(ctx, sql, ids)
+	if err != nil {
+		return models.StockSummary{}, err
+	}
+	defer rows.Close()
+
+	type meta struct{ name, location string }
+	known := map[int]meta{}
+	for rows.Next() {
+		var id int
+		var m meta
+		if err := rows.Scan(&id, &m.name, &m.location); err != nil {
+			return models.StockSummary{}, err
+		}
+		known[id] = m
+	}
+	if err := rows.Err(); err != nil {
+		return models.StockSummary{}, err
+	}
+
+	warehouses := make([]models.WarehouseStock, len(levels))
+	for i, level := range levels {
+		m := known[level.WarehouseID]
+		warehouses[i] = models.WarehouseStock{WarehouseID: level.WarehouseID, Name: m.name, Location: m.location, OnHand: level.Quantity}
+	}
+	return newStockSummary(sku, warehouses), nil
+}
+
+// CreateStockSnapshot materialises ledger quantity and value totals for
+// every SKU and warehouse as of the given time, building on the previous
+// snapshot.
+func (s *InventoryService) CreateStockSnapshot(ctx context.Context, at time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.CreateStockSnapshot")
+	defer end(span, &err)
+	at = ledgerTime(at)
+
+	sql := `
+		WITH base AS (
+			SELECT MAX(snapshot_at) AS snapshot_at
+			FROM stock_snapshot_runs
+			WHERE snapshot_at < $1
+		)
+		INSERT INTO stock_snapshots (snapshot_at, sku, warehouse_id, quantity, value)
+		SELECT $1, sku, warehouse_id, SUM(quantity), SUM(value)
+		FROM (
+			SELECT s.sku, s.warehouse_id, s.quantity, s.value
+			FROM stock_snapshots s
+			JOIN base ON s.snapshot_at = base.snapshot_at
+			UNION ALL
+			SELECT t.sku, t.warehouse_id, t.change, t.cost
+			FROM inventory_transactions t
+			WHERE t.timestamp <= $1
+				AND t.timestamp > COALESCE((SELECT snapshot_at FROM base), '-infinity')
+		) ledger
+		GROUP BY sku, warehouse_id
+		ON CONFLICT (snapshot_at, sku, warehouse_id) DO NOTHING
+	`
+	if err := s.db.Exec(ctx, sql, at); err != nil {
+		return err
+	}
+
+	// The run is recorded last so that readers never see a partial snapshot
+	sql = `
+		INSERT INTO stock_snapshot_runs (snapshot_at)
+		VALUES ($1)
+		ON CONFLICT (snapshot_at) DO NOTHING
+	`
+	return s.db.Exec(ctx, sql, at)
+}
+
+// RunSnapshotScheduler takes a stock snapshot every interval until ctx is done.
+func (s *InventoryService) RunSnapshotScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.CreateStockSnapshot(ctx, now.Add(-SnapshotLag)); err != nil {
+				slog.ErrorContext(ctx, "error creating stock snapshot", "error", err)
+			}
+		}
+	}
+}
+
+// CheckLedgerConsistency reports every SKU and warehouse whose ledger total
+// differs from the quantity held in stock_levels.
+func (s *InventoryService) CheckLedgerConsistency(ctx context.Context) (_ []models.StockDrift, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.CheckLedgerConsistency")
+	defer end(span, &err)
+	sql := `
+		SELECT
+			COALESCE(l.sku, s.sku),
+			COALESCE(l.warehouse_id, s.warehouse_id),
+			COALESCE(l.quantity, 0)::int,
+			COALESCE(s.quantity, 0)
+		FROM (
+			SELECT sku, warehouse_id, SUM(change) AS quantity
+			FROM inventory_transactions
+			GROUP BY sku, warehouse_id
+		) l
+		FULL OUTER JOIN stock_levels s
+			ON s.sku = l.sku AND s.warehouse_id = l.warehouse_id
+		WHERE COALESCE(l.quantity, 0) <> COALESCE(s.quantity, 0)
+		ORDER BY 1, 2
+	`
+	rows, err := s.db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drifts := []models.StockDrift{}
+	for rows.Next() {
+		var d models.StockDrift
+		if err := rows.Scan(&d.SKU, &d.WarehouseID, &d.LedgerQuantity, &d.StockQuantity); err != nil {
+			return nil, err
+		}
+		d.Drift = d.StockQuantity - d.LedgerQuantity
+		drifts = append(drifts, d)
+	}
+	return drifts, rows.Err()
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStockAsOf(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["stock_snapshot_runs"] = [][]interface{}{{"test", 1, 12}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	levels, err := svc.GetStockAsOf(context.Background(), "test", time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, []models.StockLevel{{SKU: "test", WarehouseID: 1, Quantity: 12}}, levels)
+}
+
+func TestGetStockAsOfReportsReadErrors(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["stock_snapshot_runs"] = [][]interface{}{{"test", 1, 12}}
+	fdb.rowsErr = errors.New("connection reset")
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.GetStockAsOf(context.Background(), "test", time.Now())
+	assert.EqualError(t, err, "connection reset", "a partly read history is not returned as complete")
+}
+
+func TestCreateStockSnapshot(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.CreateStockSnapshot(context.Background(), time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, fdb.execs, 2)
+	assert.Contains(t, fdb.execs[0].sql, "INSERT INTO stock_snapshots")
+	assert.Contains(t, fdb.execs[1].sql, "INSERT INTO stock_snapshot_runs")
+}
+
+func TestCheckLedgerConsistency(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FULL OUTER JOIN stock_levels"] = [][]interface{}{{"test", 1, 8, 10}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	drifts, err := svc.CheckLedgerConsistency(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []models.StockDrift{{SKU: "test", WarehouseID: 1, LedgerQuantity: 8, StockQuantity: 10, Drift: 2}}, drifts)
+}
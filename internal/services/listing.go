@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+)
+
+// MaxStockListLimit bounds the page size of ListStock.
+const MaxStockListLimit = 500
+
+var stockSortColumns = map[string]string{
+	models.StockSortSKU:       "sl.sku",
+	models.StockSortQuantity:  "sl.quantity",
+	models.StockSortWarehouse: "sl.warehouse_id",
+	models.StockSortProduct:   "p.name",
+}
+
+// SetLowStockThreshold sets the quantity below which stock counts as low
+// when listing stock.
+func (s *InventoryService) SetLowStockThreshold(threshold int) {
+	s.lowStockThreshold = threshold
+}
+
+func validateStockFilter(filter models.StockFilter) error {
+	v := &ValidationError{}
+	for _, id := range filter.WarehouseIDs {
+		if id <= 0 {
+			v.add(false, "warehouse_id", "must be a positive integer")
+			break
+		}
+	}
+	_, ok := stockSortColumns[strings.TrimPrefix(filter.Sort, "-")]
+	v.add(filter.Sort == "" || ok, "sort", "must be one of sku, quantity, warehouse_id or product_name, optionally prefixed with -")
+	v.add(filter.MinQuantity == nil || filter.MaxQuantity == nil || *filter.MinQuantity <= *filter.MaxQuantity,
+		"min_quantity", "must not exceed max_quantity")
+	v.add(filter.Limit >= 0 && filter.Limit <= MaxStockListLimit, "limit", fmt.Sprintf("must not exceed %d", MaxStockListLimit))
+	v.add(filter.Offset >= 0, "offset", "must not be negative")
+	v.add(filter.Unit == "" || unitPattern.MatchString(filter.Unit), "unit", "is not a valid unit of measure")
+	return v.err()
+}
+
+// likeEscape escapes s for use in a LIKE pattern.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ListStock returns the stock rows matching filter, one per SKU and
+// warehouse, with product and warehouse names. Rows are ordered by the
+// requested sort and then by SKU and warehouse so pages are stable. Filters
+// and sorting apply to base units; with filter.Unit, rows of SKUs that
+// define the unit also give their quantity in it.
+func (s *InventoryService) ListStock(ctx context.Context, filter models.StockFilter) (_ models.StockPage, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ListStock")
+	defer end(span, &err)
+	if err := validateStockFilter(filter); err != nil {
+		return models.StockPage{}, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = MaxStockListLimit
+	}
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	from := `
+		FROM stock_levels sl
+		LEFT JOIN products p ON p.sku = sl.sku
+		LEFT JOIN warehouses w ON w.id = sl.warehouse_id
+	`
+	convert := filter.Unit != "" && !models.IsBaseUnit(filter.Unit)
+	if convert {
+		args = append(args, filter.Unit)
+		from += fmt.Sprintf(" LEFT JOIN product_units pu ON pu.sku = sl.sku AND pu.unit = $%d", len(args))
+	}
+
+	if len(filter.WarehouseIDs) > 0 {
+		addCondition("sl.warehouse_id = ANY($%d)", filter.WarehouseIDs)
+	}
+	if filter.SKUPrefix != "" {
+		addCondition(`sl.sku LIKE $%d ESCAPE '\'`, likeEscape(filter.SKUPrefix)+"%")
+	}
+	if filter.ProductName != "" {
+		addCondition(`p.name ILIKE $%d ESCAPE '\'`, "%"+likeEscape(filter.ProductName)+"%")
+	}
+	if filter.MinQuantity != nil {
+		addCondition("sl.quantity >= $%d", *filter.MinQuantity)
+	}
+	if filter.MaxQuantity != nil {
+		addCondition("sl.quantity <= $%d", *filter.MaxQuantity)
+	}
+	if filter.BelowThreshold {
+		addCondition("sl.quantity < $%d", s.lowStockThreshold)
+	}
+	if filter.ZeroStock {
+		conditions = append(conditions, "sl.quantity = 0")
+	}
+
+	if len(conditions) > 0 {
+		from += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := models.StockPage{Items: []models.StockListItem{}, Limit: filter.Limit, Offset: filter.Offset}
+	rows, err := s.db.Query(ctx, "SELECT COUNT(*)::int"+from, args...)
+	if err != nil {
+		return models.StockPage{}, err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&page.Total); err != nil {
+			rows.Close()
+			return models.StockPage{}, err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.StockPage{}, err
+	}
+
+	order := "sl.sku, sl.warehouse_id"
+	if filter.Sort != "" {
+		direction := "ASC"
+		if strings.HasPrefix(filter.Sort, "-") {
+			direction = "DESC"
+		}
+		order = stockSortColumns[strings.TrimPrefix(filter.Sort, "-")] + " " + direction + " NULLS LAST, " + order
+	}
+	columns := "sl.sku, COALESCE(p.name, ''), sl.warehouse_id, COALESCE(w.name, ''), COALESCE(w.location, ''), sl.quantity"
+	if convert {
+		columns += ", COALESCE(pu.factor, 0)"
+	}
+	args = append(args, filter.Limit)
+	sql := "SELECT " + columns + from + " ORDER BY " + order + fmt.Sprintf(" LIMIT $%d", len(args))
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		sql += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err = s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return models.StockPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.StockListItem
+		factor := 1
+		dest := []interface{}{&item.SKU, &item.ProductName, &item.WarehouseID, &item.WarehouseName, &item.WarehouseLocation, &item.Quantity}
+		if convert {
+			dest = append(dest, &factor)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return models.StockPage{}, err
+		}
+		if filter.Unit != "" && factor > 0 {
+			quantity := models.InUnits(item.Quantity, factor)
+			item.Unit, item.UnitQuantity = filter.Unit, &quantity
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, rows.Err()
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListStock(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["COUNT(*)"] = [][]interface{}{{3}}
+	fdb.results["COALESCE(p.name"] = [][]interface{}{{"sku-1", "Widget", 1, "Main", "Berlin", 2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetLowStockThreshold(10)
+
+	minQuantity := 1
+	page, err := svc.ListStock(context.Background(), models.StockFilter{
+		WarehouseIDs:   []int{1, 2},
+		SKUPrefix:      "sku_",
+		MinQuantity:    &minQuantity,
+		BelowThreshold: true,
+		Sort:           "-quantity",
+		Limit:          1,
+		Offset:         1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, []models.StockListItem{{SKU: "sku-1", ProductName: "Widget", WarehouseID: 1, WarehouseName: "Main", WarehouseLocation: "Berlin", Quantity: 2}}, page.Items)
+
+	count, list := fdb.queries[0], fdb.queries[1]
+	assert.Contains(t, count.sql, `WHERE sl.warehouse_id = ANY($1) AND sl.sku LIKE $2 ESCAPE '\' AND sl.quantity >= $3 AND sl.quantity < $4`)
+	assert.Equal(t, []interface{}{[]int{1, 2}, `sku\_%`, 1, 10}, count.args)
+	assert.Contains(t, list.sql, "ORDER BY sl.quantity DESC NULLS LAST, sl.sku, sl.warehouse_id LIMIT $5 OFFSET $6")
+	assert.Equal(t, []interface{}{[]int{1, 2}, `sku\_%`, 1, 10, 1, 1}, list.args)
+}
+
+func TestListStockValidation(t *testing.T) {
+	svc := NewInventoryService(newFakeDB(), &fakeRedis{})
+	minQuantity, maxQuantity := 5, 1
+
+	_, err := svc.ListStock(context.Background(), models.StockFilter{
+		Sort:        "price",
+		MinQuantity: &minQuantity,
+		MaxQuantity: &maxQuantity,
+		Limit:       MaxStockListLimit + 1,
+	})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	fields := map[string]bool{}
+	for _, f := range invalid.Fields {
+		fields[f.Field] = true
+	}
+	assert.Equal(t, map[string]bool{"sort": true, "min_quantity": true, "limit": true}, fields)
+}
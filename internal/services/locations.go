@@ -0,0 +1,518 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// binQuantity is the stock of a SKU held in one bin.
+type binQuantity struct {
+	locationID int
+	path       string
+	quantity   int
+}
+
+// binPick is stock taken from a bin, or from stock not yet put away when
+// locationID is zero.
+type binPick struct {
+	locationID int
+	path       string
+	quantity   int
+}
+
+// validateNewLocation reports every invalid field of loc.
+func validateNewLocation(loc models.NewLocation) error {
+	v := &ValidationError{}
+	v.add(models.LocationDepth(loc.Kind) >= 0, "kind", "must be zone, aisle or bin")
+	v.add(loc.Code != "", "code", "is required")
+	v.add(len(loc.Code) <= 50, "code", "must be at most 50 characters")
+	v.add(!strings.Contains(loc.Code, "/"), "code", "must not contain /")
+	return v.err()
+}
+
+// CreateLocation adds a zone, aisle or bin to a warehouse. Locations nest
+// outermost first: a zone may hold aisles and bins, an aisle only bins. It
+// returns a *NotFoundError if the warehouse does not exist.
+func (s *InventoryService) CreateLocation(ctx context.Context, warehouseID int, loc models.NewLocation) (_ models.Location, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.CreateLocation", attribute.Int("warehouse_id", warehouseID), attribute.String("kind", loc.Kind))
+	defer end(span, &err)
+	if err := validateNewLocation(loc); err != nil {
+		return models.Location{}, err
+	}
+
+	created := models.Location{WarehouseID: warehouseID, Kind: loc.Kind, Code: loc.Code, Path: loc.Code}
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		var exists bool
+		if err := queryRow(ctx, tx, `SELECT true FROM warehouses WHERE id = $1`, []interface{}{warehouseID}, &exists); err != nil {
+			return err
+		}
+		if !exists {
+			return &NotFoundError{Resource: "warehouse", ID: strconv.Itoa(warehouseID)}
+		}
+
+		if loc.Parent != "" {
+			var parentKind, parentPath string
+			sql := `SELECT id, kind, path FROM locations WHERE warehouse_id = $1 AND path = $2`
+			if err := queryRow(ctx, tx, sql, []interface{}{warehouseID, loc.Parent}, &created.ParentID, &parentKind, &parentPath); err != nil {
+				return err
+			}
+			if created.ParentID == 0 {
+				return Invalid("parent", fmt.Sprintf("%s is not a location of warehouse %d", loc.Parent, warehouseID))
+			}
+			if models.LocationDepth(parentKind) >= models.LocationDepth(loc.Kind) {
+				return Invalid("kind", fmt.Sprintf("a %s cannot be placed in a %s", loc.Kind, parentKind))
+			}
+			created.Path = parentPath + "/" + loc.Code
+		}
+		if len(created.Path) > 255 {
+			return Invalid("code", "makes the location path longer than 255 characters")
+		}
+
+		sql := `
+			INSERT INTO locations (warehouse_id, parent_id, kind, code, path)
+			VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+			ON CONFLICT (warehouse_id, path) DO NOTHING
+			RETURNING id
+		`
+		if err := queryRow(ctx, tx, sql, []interface{}{warehouseID, created.ParentID, loc.Kind, loc.Code, created.Path}, &created.ID); err != nil {
+			return err
+		}
+		if created.ID == 0 {
+			return Invalid("code", fmt.Sprintf("%s already exists", created.Path))
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Location{}, err
+	}
+	return created, nil
+}
+
+// ListLocations returns the locations of a warehouse in path order, each
+// with the stock held in it and the bins beneath it, of sku only when sku
+// is not empty.
+func (s *InventoryService) ListLocations(ctx context.Context, warehouseID int, sku string) (_ []models.Location, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ListLocations", attribute.Int("warehouse_id", warehouseID))
+	defer end(span, &err)
+	sql := `
+		SELECT l.id, l.warehouse_id, COALESCE(l.parent_id, 0), l.kind, l.code, l.path,
+			COALESCE((
+				SELECT SUM(bs.quantity)
+				FROM bin_stock bs
+				JOIN locations b ON b.id = bs.location_id
+				WHERE b.warehouse_id = l.warehouse_id
+					AND (b.path = l.path OR starts_with(b.path, l.path || '/'))
+					AND ($2 = '' OR bs.sku = $2)
+			), 0)
+		FROM locations l
+		WHERE l.warehouse_id = $1
+		ORDER BY l.path
+	`
+	rows, err := s.db.Query(ctx, sql, warehouseID, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []models.Location{}
+	for rows.Next() {
+		var l models.Location
+		if err := rows.Scan(&l.ID, &l.WarehouseID, &l.ParentID, &l.Kind, &l.Code, &l.Path, &l.Quantity); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+// GetBinStock returns the stock of sku in each warehouse broken down by
+// bin, in bin path order. It returns a *NotFoundError if no warehouse has
+// ever stocked the SKU.
+func (s *InventoryService) GetBinStock(ctx context.Context, sku string) (_ []models.WarehouseBins, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetBinStock", attribute.String("sku", sku))
+	defer end(span, &err)
+	sql := `
+		SELECT s.warehouse_id, COALESCE(w.name, ''), s.quantity
+		FROM stock_levels s
+		LEFT JOIN warehouses w ON w.id = s.warehouse_id
+		WHERE s.sku = $1
+		ORDER BY s.warehouse_id
+	`
+	rows, err := s.db.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
+	}
+	var warehouses []models.WarehouseBins
+	index := map[int]int{}
+	for rows.Next() {
+		w := models.WarehouseBins{Bins: []models.BinQuantity{}}
+		if err := rows.Scan(&w.WarehouseID, &w.Name, &w.Quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w.Unassigned = w.Quantity
+		index[w.WarehouseID] = len(warehouses)
+		warehouses = append(warehouses, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(warehouses) == 0 {
+		return nil, &NotFoundError{Resource: "SKU", ID: sku}
+	}
+
+	sql = `
+		SELECT l.warehouse_id, l.path, bs.quantity
+		FROM bin_stock bs
+		JOIN locations l ON l.id = bs.location_id
+		WHERE bs.sku = $1 AND bs.quantity > 0
+		ORDER BY l.warehouse_id, l.path
+	`
+	rows, err = s.db.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var warehouseID int
+		var b models.BinQuantity
+		if err := rows.Scan(&warehouseID, &b.Bin, &b.Quantity); err != nil {
+			return nil, err
+		}
+		i, ok := index[warehouseID]
+		if !ok {
+			continue
+		}
+		warehouses[i].Bins = append(warehouses[i].Bins, b)
+		warehouses[i].Unassigned -= b.Quantity
+	}
+	return warehouses, rows.Err()
+}
+
+// validateBinMove reports every invalid field of move. FromBin is required
+// unless the move is a put-away.
+func validateBinMove(move models.BinMove, putAway bool) error {
+	v := &ValidationError{}
+	v.add(move.SKU != "", "sku", "is required")
+	v.add(move.WarehouseID > 0, "warehouse_id", "must be a positive integer")
+	v.add(move.Quantity > 0, "quantity", "must be positive")
+	v.add(move.ToBin != "", "to_bin", "is required")
+	v.add(move.ReasonCode == "" || models.IsValidReasonCode(move.ReasonCode), "reason_code", "is not a known reason code")
+	if putAway {
+		v.add(move.FromBin == "", "from_bin", "is not accepted for put-away")
+	} else {
+		v.add(move.FromBin != "", "from_bin", "is required")
+		v.add(move.FromBin != move.ToBin, "to_bin", "must differ from from_bin")
+	}
+	return v.err()
+}
+
+// PutAway moves stock that has not been put away into a bin. It returns an
+// *InsufficientStockError if the warehouse has less stock waiting.
+func (s *InventoryService) PutAway(ctx context.Context, move models.BinMove) (err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.PutAway", attribute.String("sku", move.SKU), attribute.Int("warehouse_id", move.WarehouseID))
+	defer end(span, &err)
+	if err := validateBinMove(move, true); err != nil {
+		return err
+	}
+	if move.ReasonCode == "" {
+		move.ReasonCode = models.ReasonRelocation
+	}
+
+	return s.withTx(ctx, func(tx db.Tx) error {
+		toID, err := findBin(ctx, tx, move.WarehouseID, move.ToBin, "to_bin")
+		if err != nil {
+			return err
+		}
+
+		// Locks the warehouse's stock level so orders wait for the put-away
+		sql := `
+			SELECT COALESCE((SELECT quantity FROM stock_levels WHERE sku = $1 AND warehouse_id = $2 FOR UPDATE), 0)
+				- COALESCE((
+					SELECT SUM(bs.quantity)
+					FROM bin_stock bs
+					JOIN locations l ON l.id = bs.location_id
+					WHERE bs.sku = $1 AND l.warehouse_id = $2
+				), 0)
+		`
+		var unassigned int
+		if err := queryRow(ctx, tx, sql, []interface{}{move.SKU, move.WarehouseID}, &unassigned); err != nil {
+			return err
+		}
+		if unassigned < move.Quantity {
+			return &InsufficientStockError{SKU: move.SKU, Requested: move.Quantity, Available: max(unassigned, 0)}
+		}
+
+		if err := addToBin(ctx, tx, toID, move.SKU, move.Quantity); err != nil {
+			return err
+		}
+		if err := recordBinMovement(ctx, tx, move.SKU, move.WarehouseID, 0, toID, move.Quantity, 0); err != nil {
+			return err
+		}
+		return auditBinMove(ctx, tx, "put_away", move)
+	})
+}
+
+// MoveBinStock moves stock from one bin of a warehouse to another. It
+// returns an *InsufficientStockError if the source bin holds less.
+func (s *InventoryService) MoveBinStock(ctx context.Context, move models.BinMove) (err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.MoveBinStock", attribute.String("sku", move.SKU), attribute.Int("warehouse_id", move.WarehouseID))
+	defer end(span, &err)
+	if err := validateBinMove(move, false); err != nil {
+		return err
+	}
+	if move.ReasonCode == "" {
+		move.ReasonCode = models.ReasonRelocation
+	}
+
+	return s.withTx(ctx, func(tx db.Tx) error {
+		fromID, err := findBin(ctx, tx, move.WarehouseID, move.FromBin, "from_bin")
+		if err != nil {
+			return err
+		}
+		toID, err := findBin(ctx, tx, move.WarehouseID, move.ToBin, "to_bin")
+		if err != nil {
+			return err
+		}
+		if err := takeFromBin(ctx, tx, fromID, move.SKU, move.Quantity); err != nil {
+			return err
+		}
+		if err := addToBin(ctx, tx, toID, move.SKU, move.Quantity); err != nil {
+			return err
+		}
+		if err := recordBinMovement(ctx, tx, move.SKU, move.WarehouseID, fromID, toID, move.Quantity, 0); err != nil {
+			return err
+		}
+		return auditBinMove(ctx, tx, "bin_move", move)
+	})
+}
+
+// auditBinMove records a put-away or bin move in the audit log. The
+// warehouse's stock is unchanged, so the entry's change is the quantity
+// moved and it has no ledger entry.
+func auditBinMove(ctx context.Context, tx db.Tx, action string, move models.BinMove) error {
+	return recordAudit(ctx, tx, models.AuditEntry{
+		Action:      action,
+		SKU:         move.SKU,
+		WarehouseID: move.WarehouseID,
+		Change:      move.Quantity,
+		Reason:      move.Reason,
+		ReasonCode:  move.ReasonCode,
+	})
+}
+
+// findBin returns the ID of the bin at path in a warehouse, reporting field
+// as invalid if there is none.
+func findBin(ctx context.Context, tx db.Tx, warehouseID int, path, field string) (int, error) {
+	var id int
+	sql := `SELECT id FROM locations WHERE warehouse_id = $1 AND path = $2 AND kind = 'bin'`
+	if err := queryRow(ctx, tx, sql, []interface{}{warehouseID, path}, &id); err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, Invalid(field, fmt.Sprintf("%s is not a bin of warehouse %d", path, warehouseID))
+	}
+	return id, nil
+}
+
+func addToBin(ctx context.Context, tx db.Tx, locationID int, sku string, quantity int) error {
+	sql := `
+		INSERT INTO bin_stock (location_id, sku, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (location_id, sku) DO UPDATE
+		SET quantity = bin_stock.quantity + $3
+	`
+	return tx.Exec(ctx, sql, locationID, sku, quantity)
+}
+
+// takeFromBin removes quantity of sku from a bin, or returns an
+// *InsufficientStockError if the bin holds less.
+func takeFromBin(ctx context.Context, tx db.Tx, locationID int, sku string, quantity int) error {
+	var held int
+	sql := `SELECT quantity FROM bin_stock WHERE location_id = $1 AND sku = $2 FOR UPDATE`
+	if err := queryRow(ctx, tx, sql, []interface{}{locationID, sku}, &held); err != nil {
+		return err
+	}
+	if held < quantity {
+		return &InsufficientStockError{SKU: sku, Requested: quantity, Available: held}
+	}
+	sql = `UPDATE bin_stock SET quantity = quantity - $1 WHERE location_id = $2 AND sku = $3`
+	return tx.Exec(ctx, sql, quantity, locationID, sku)
+}
+
+// recordBinMovement records stock moved between bins, into a bin when
+// fromID is zero or out of one when toID is zero. A txID of zero records a
+// move that left the warehouse's stock unchanged.
+func recordBinMovement(ctx context.Context, tx db.Tx, sku string, warehouseID, fromID, toID, quantity, txID int) error {
+	sql := `
+		INSERT INTO bin_movements (sku, warehouse_id, from_location_id, to_location_id, quantity, transaction_id, actor)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5, NULLIF($6, 0), $7)
+	`
+	return tx.Exec(ctx, sql, sku, warehouseID, fromID, toID, quantity, txID, audit.FromContext(ctx).Actor)
+}
+
+// lockBins locks the bins of a warehouse holding sku, in path order.
+func lockBins(ctx context.Context, tx db.Tx, sku string, warehouseID int) ([]binQuantity, error) {
+	sql := `
+		SELECT bs.location_id, l.path, bs.quantity
+		FROM bin_stock bs
+		JOIN locations l ON l.id = bs.location_id
+		WHERE bs.sku = $1 AND l.warehouse_id = $2 AND bs.quantity > 0
+		ORDER BY l.path
+		FOR UPDATE OF bs
+	`
+	rows, err := tx.Query(ctx, sql, sku, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bins []binQuantity
+	for rows.Next() {
+		var b binQuantity
+		if err := rows.Scan(&b.locationID, &b.path, &b.quantity); err != nil {
+			return nil, err
+		}
+		bins = append(bins, b)
+	}
+	return bins, rows.Err()
+}
+
+func binTotal(bins []binQuantity) int {
+	var total int
+	for _, b := range bins {
+		total += b.quantity
+	}
+	return total
+}
+
+// planPicks takes quantity from the bins in path order and from the stock
+// not yet put away, which goes first when unassignedFirst is set. It reduces
+// the bins and *unassigned by what it takes, and takes no more than they
+// hold.
+func planPicks(quantity int, unassigned *int, bins []binQuantity, unassignedFirst bool) []binPick {
+	var picks []binPick
+	takeUnassigned := func() {
+		if take := min(quantity, *unassigned); take > 0 {
+			picks = append(picks, binPick{quantity: take})
+			*unassigned -= take
+			quantity -= take
+		}
+	}
+
+	if unassignedFirst {
+		takeUnassigned()
+	}
+	for i := range bins {
+		if take := min(quantity, bins[i].quantity); take > 0 {
+			picks = append(picks, binPick{locationID: bins[i].locationID, path: bins[i].path, quantity: take})
+			bins[i].quantity -= take
+			quantity -= take
+		}
+	}
+	if !unassignedFirst {
+		takeUnassigned()
+	}
+	return picks
+}
+
+// takePicks removes the picked stock from its bins and records the
+// movements against the ledger entry txID.
+func takePicks(ctx context.Context, tx db.Tx, sku string, warehouseID int, picks []binPick, txID int) error {
+	for _, p := range picks {
+		if p.locationID == 0 {
+			continue
+		}
+		sql := `UPDATE bin_stock SET quantity = quantity - $1 WHERE location_id = $2 AND sku = $3`
+		if err := tx.Exec(ctx, sql, p.quantity, p.locationID, sku); err != nil {
+			return err
+		}
+		if err := recordBinMovement(ctx, tx, sku, warehouseID, p.locationID, 0, p.quantity, txID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adjustBinStock applies a stock update recorded as txID to the bins of its
+// warehouse. Updates naming a bin add to or take from it. Other removals
+// take stock not yet put away first and then empty bins in path order, so
+// the bins never hold more than the warehouse.
+func adjustBinStock(ctx context.Context, tx db.Tx, update models.StockUpdate, txID int) error {
+	if update.Bin != "" {
+		binID, err := findBin(ctx, tx, update.WarehouseID, update.Bin, "bin")
+		if err != nil {
+			return err
+		}
+		if update.Quantity > 0 {
+			if err := addToBin(ctx, tx, binID, update.SKU, update.Quantity); err != nil {
+				return err
+			}
+			return recordBinMovement(ctx, tx, update.SKU, update.WarehouseID, 0, binID, update.Quantity, txID)
+		}
+		if err := takeFromBin(ctx, tx, binID, update.SKU, -update.Quantity); err != nil {
+			return err
+		}
+		return recordBinMovement(ctx, tx, update.SKU, update.WarehouseID, binID, 0, -update.Quantity, txID)
+	}
+	if update.Quantity > 0 {
+		return nil
+	}
+
+	bins, err := lockBins(ctx, tx, update.SKU, update.WarehouseID)
+	if err != nil || len(bins) == 0 {
+		return err
+	}
+	// The stock level already includes the update
+	var onHand int
+	sql := `SELECT quantity FROM stock_levels WHERE sku = $1 AND warehouse_id = $2`
+	if err := queryRow(ctx, tx, sql, []interface{}{update.SKU, update.WarehouseID}, &onHand); err != nil {
+		return err
+	}
+	unassigned := max(onHand-update.Quantity-binTotal(bins), 0)
+	picks := planPicks(-update.Quantity, &unassigned, bins, true)
+	return takePicks(ctx, tx, update.SKU, update.WarehouseID, picks, txID)
+}
+
+// planOrderPicks fills in the bins each allocation is picked from, walking
+// the bins of its warehouse in path order before taking stock not yet put
+// away. Allocations from warehouses with no stock in bins get no picks.
+func planOrderPicks(ctx context.Context, tx db.Tx, sku string, warehouses []warehouseQuantity, allocations []allocation) error {
+	type binState struct {
+		bins       []binQuantity
+		unassigned int
+	}
+	states := map[int]*binState{}
+	for i := range allocations {
+		a := &allocations[i]
+		state, ok := states[a.warehouseID]
+		if !ok {
+			bins, err := lockBins(ctx, tx, sku, a.warehouseID)
+			if err != nil {
+				return err
+			}
+			state = &binState{bins: bins}
+			for _, w := range warehouses {
+				if w.warehouseID == a.warehouseID {
+					state.unassigned = max(w.quantity-binTotal(bins), 0)
+				}
+			}
+			states[a.warehouseID] = state
+		}
+		if len(state.bins) > 0 {
+			a.picks = planPicks(a.quantity, &state.unassigned, state.bins, false)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLocation(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM warehouses WHERE id"] = [][]interface{}{{true}}
+	fdb.results["SELECT id, kind, path"] = [][]interface{}{{3, models.LocationZone, "A"}}
+	fdb.results["INSERT INTO locations"] = [][]interface{}{{9}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	loc, err := svc.CreateLocation(context.Background(), 1, models.NewLocation{Kind: models.LocationAisle, Code: "03", Parent: "A"})
+	require.NoError(t, err)
+	assert.Equal(t, models.Location{ID: 9, WarehouseID: 1, ParentID: 3, Kind: models.LocationAisle, Code: "03", Path: "A/03"}, loc)
+
+	// Locations nest outermost first
+	_, err = svc.CreateLocation(context.Background(), 1, models.NewLocation{Kind: models.LocationZone, Code: "B", Parent: "A"})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "kind", Message: "a zone cannot be placed in a zone"}}, invalid.Fields)
+
+	// The path is taken
+	delete(fdb.results, "INSERT INTO locations")
+	_, err = svc.CreateLocation(context.Background(), 1, models.NewLocation{Kind: models.LocationBin, Code: "B1", Parent: "A"})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "code", Message: "A/B1 already exists"}}, invalid.Fields)
+}
+
+func TestCreateLocationUnknownWarehouse(t *testing.T) {
+	svc := NewInventoryService(newFakeDB(), &fakeRedis{})
+
+	_, err := svc.CreateLocation(context.Background(), 1, models.NewLocation{Kind: models.LocationBin, Code: "B1"})
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestPutAway(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT id FROM locations"] = [][]interface{}{{5}}
+	fdb.results["COALESCE((SELECT quantity FROM stock_levels"] = [][]interface{}{{4}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.PutAway(context.Background(), models.BinMove{SKU: "test", WarehouseID: 1, ToBin: "A/01", Quantity: 3})
+	require.NoError(t, err)
+	added := fdb.statements("INSERT INTO bin_stock")
+	require.Len(t, added, 1)
+	assert.Equal(t, []interface{}{5, "test", 3}, added[0].args)
+	assert.Len(t, fdb.statements("INSERT INTO bin_movements"), 1)
+	assert.Empty(t, fdb.statements("INSERT INTO inventory_transactions"), "put-away leaves the warehouse's stock unchanged")
+	audits := fdb.statements("INSERT INTO audit_log")
+	require.Len(t, audits, 1)
+	assert.Equal(t, []interface{}{"put_away", "test", 1, 3, "", "", models.ReasonRelocation, 0}, audits[0].args[4:12])
+
+	err = svc.PutAway(context.Background(), models.BinMove{SKU: "test", WarehouseID: 1, ToBin: "A/01", Quantity: 5})
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, 4, shortage.Available)
+}
+
+func TestMoveBinStock(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT id FROM locations"] = [][]interface{}{{5}}
+	fdb.results["FROM bin_stock WHERE location_id"] = [][]interface{}{{2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.MoveBinStock(context.Background(), models.BinMove{SKU: "test", WarehouseID: 1, FromBin: "A/01", ToBin: "A/02", Quantity: 2, Reason: "slotting", ReasonCode: models.ReasonCorrection})
+	require.NoError(t, err)
+	assert.Len(t, fdb.statements("UPDATE bin_stock"), 1)
+	assert.Len(t, fdb.statements("INSERT INTO bin_stock"), 1)
+	audits := fdb.statements("INSERT INTO audit_log")
+	require.Len(t, audits, 1, "the move is audited in its transaction")
+	assert.Equal(t, []interface{}{"bin_move", "test", 1, 2, "", "slotting", models.ReasonCorrection, 0}, audits[0].args[4:12])
+	assert.Equal(t, 1, fdb.commits)
+
+	err = svc.MoveBinStock(context.Background(), models.BinMove{SKU: "test", WarehouseID: 1, FromBin: "A/01", ToBin: "A/02", Quantity: 3})
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, 2, shortage.Available)
+	assert.Equal(t, 1, fdb.rollbacks)
+
+	err = svc.MoveBinStock(context.Background(), models.BinMove{SKU: "test", WarehouseID: 1, ToBin: "A/02", Quantity: 1, ReasonCode: "tidy"})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []string{"reason_code", "from_bin"}, []string{invalid.Fields[0].Field, invalid.Fields[1].Field})
+}
+
+func TestSimulateOrderPicksBinsInPathOrder(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 5}}
+	fdb.results["FROM bin_stock bs"] = [][]interface{}{{10, "A/01/B1", 2}, {11, "A/02/B1", 1}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Allocation{{WarehouseID: 1, Quantity: 4, Picks: []models.Pick{
+		{Bin: "A/01/B1", Quantity: 2},
+		{Bin: "A/02/B1", Quantity: 1},
+		{Quantity: 1},
+	}}}, allocations)
+	taken := fdb.statements("UPDATE bin_stock")
+	require.Len(t, taken, 2)
+	assert.Equal(t, []interface{}{2, 10, "test"}, taken[0].args)
+	assert.Len(t, fdb.statements("INSERT INTO bin_movements"), 2)
+}
+
+func TestAddOrUpdateStockTakesUnassignedStockFirst(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM bin_stock bs"] = [][]interface{}{{10, "A/01", 5}}
+	// 6 on hand before the update, 1 of them not put away
+	fdb.results["SELECT quantity FROM stock_levels WHERE sku"] = [][]interface{}{{3}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -3})
+	require.NoError(t, err)
+	taken := fdb.statements("UPDATE bin_stock")
+	require.Len(t, taken, 1)
+	assert.Equal(t, []interface{}{2, 10, "test"}, taken[0].args)
+}
+
+func TestAddOrUpdateStockInBin(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 2, Bin: "A/01"})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "bin", Message: "A/01 is not a bin of warehouse 1"}}, invalid.Fields)
+
+	fdb.results["SELECT id FROM locations"] = [][]interface{}{{5}}
+	err = svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 2, Bin: "A/01"})
+	require.NoError(t, err)
+	added := fdb.statements("INSERT INTO bin_stock")
+	require.Len(t, added, 1)
+	assert.Equal(t, []interface{}{5, "test", 2}, added[0].args)
+}
+
+func TestGetBinStock(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM stock_levels s"] = [][]interface{}{{1, "Main", 5}}
+	fdb.results["FROM bin_stock bs"] = [][]interface{}{{1, "A/01", 3}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	warehouses, err := svc.GetBinStock(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, []models.WarehouseBins{{
+		WarehouseID: 1, Name: "Main", Quantity: 5, Unassigned: 2,
+		Bins: []models.BinQuantity{{Bin: "A/01", Quantity: 3}},
+	}}, warehouses)
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ExpiryNotifier delivers near-expiry alerts.
+type ExpiryNotifier interface {
+	NotifyNearExpiry(ctx context.Context, lot models.ExpiringLot) error
+}
+
+// SetExpiryNotifier enables near-expiry alerts for stocked lots expiring
+// within days, sent by RunExpiryAlerts.
+func (s *InventoryService) SetExpiryNotifier(notifier ExpiryNotifier, days int) {
+	s.expiryNotifier = notifier
+	s.expiryAlertDays = days
+}
+
+// parseDate parses a lot date. An empty string is valid and yields the zero
+// time.
+func parseDate(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(models.DateLayout, s)
+	return t, err == nil
+}
+
+// adjustLotStock applies a stock update to its lot, creating the lot on
+// first use, and returns the lot ID. Dates that contradict those already
+// recorded for the lot are rejected, as is taking a lot below zero.
+func adjustLotStock(ctx context.Context, tx db.Tx, update models.StockUpdate) (int, error) {
+	sql := `
+		INSERT INTO lots (sku, lot_number, manufactured_on, expires_on)
+		VALUES ($1, $2, NULLIF($3, '')::date, NULLIF($4, '')::date)
+		ON CONFLICT (sku, lot_number) DO UPDATE
+		SET manufactured_on = COALESCE(lots.manufactured_on, EXCLUDED.manufactured_on),
+			expires_on = COALESCE(lots.expires_on, EXCLUDED.expires_on)
+		RETURNING id, COALESCE(to_char(manufactured_on, 'YYYY-MM-DD'), ''), COALESCE(to_char(expires_on, 'YYYY-MM-DD'), '')
+	`
+	var lot models.Lot
+	if err := queryRow(ctx, tx, sql, []interface{}{update.SKU, update.LotNumber, update.ManufacturedOn, update.ExpiresOn},
+		&lot.ID, &lot.ManufacturedOn, &lot.ExpiresOn); err != nil {
+		return 0, err
+	}
+
+	v := &ValidationError{}
+	v.add(update.ManufacturedOn == "" || update.ManufacturedOn == lot.ManufacturedOn,
+		"manufactured_on", fmt.Sprintf("does not match lot %s, manufactured on %s", update.LotNumber, lot.ManufacturedOn))
+	v.add(update.ExpiresOn == "" || update.ExpiresOn == lot.ExpiresOn,
+		"expires_on", fmt.Sprintf("does not match lot %s, which expires on %s", update.LotNumber, lot.ExpiresOn))
+	if err := v.err(); err != nil {
+		return 0, err
+	}
+
+	// The balance is checked here rather than left to the table constraint so
+	// the caller learns how much the lot holds
+	sql = `
+		SELECT quantity
+		FROM lot_stock
+		WHERE lot_id = $1 AND warehouse_id = $2
+		FOR UPDATE
+	`
+	var held int
+	if err := queryRow(ctx, tx, sql, []interface{}{lot.ID, update.WarehouseID}, &held); err != nil {
+		return 0, err
+	}
+	if held+update.Quantity < 0 {
+		return 0, &InsufficientStockError{SKU: update.SKU, Requested: -update.Quantity, Available: held}
+	}
+
+	sql = `
+		INSERT INTO lot_stock (lot_id, warehouse_id, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (lot_id, warehouse_id) DO UPDATE
+		SET quantity = lot_stock.quantity + $3
+	`
+	if err := tx.Exec(ctx, sql, lot.ID, update.WarehouseID, update.Quantity); err != nil {
+		return 0, err
+	}
+	return lot.ID, nil
+}
+
+// queryRow scans the first row returned by sql, if any, into dest.
+func queryRow(ctx context.Context, tx db.Tx, sql string, args []interface{}, dest ...interface{}) error {
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+type warehouseQuantity struct{ warehouseID, quantity int }
+
+type lotQuantity struct {
+	lotID       int
+	lotNumber   string
+	warehouseID int
+	quantity    int
+	expired     bool
+}
+
+// allocation is the stock of sku an order takes from one warehouse, and from one
+// lot when lotID is set. Orders for serialized SKUs take the listed serials.
+// picks lists the bins the stock is taken from.
+type allocation struct {
+	sku         string
+	warehouseID int
+	lotID       int
+	lotNumber   string
+	quantity    int
+	serials     []serialUnit
+	picks       []binPick
+	cost        float64
+}
+
+func (a allocation) model() models.Allocation {
+	m := models.Allocation{WarehouseID: a.warehouseID, Quantity: a.quantity, LotNumber: a.lotNumber, Cost: a.cost}
+	for _, unit := range a.serials {
+		m.SerialNumbers = append(m.SerialNumbers, unit.number)
+	}
+	for _, p := range a.picks {
+		m.Picks = append(m.Picks, models.Pick{Bin: p.path, Quantity: p.quantity})
+	}
+	return m
+}
+
+// lockLotStock returns the stocked lots of sku, soonest expiry first, locking
+// them for the rest of the transaction.
+func lockLotStock(ctx context.Context, tx db.Tx, sku string) ([]lotQuantity, error) {
+	sql := `
+		SELECT ls.lot_id, l.lot_number, ls.warehouse_id, ls.quantity, COALESCE(l.expires_on < CURRENT_DATE, false)
+		FROM lot_stock ls
+		JOIN lots l ON l.id = ls.lot_id
+		WHERE l.sku = $1 AND ls.quantity > 0
+		ORDER BY l.expires_on ASC NULLS LAST, l.id, ls.warehouse_id
+		FOR UPDATE OF ls
+	`
+	rows, err := tx.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []lotQuantity
+	for rows.Next() {
+		var l lotQuantity
+		if err := rows.Scan(&l.lotID, &l.lotNumber, &l.warehouseID, &l.quantity, &l.expired); err != nil {
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	return lots, rows.Err()
+}
+
+// planAllocation allocates quantity first-expired-first-out: from unexpired
+// lots in expiry order, then from stock outside any lot, taking the
+// warehouses with the most stock first. Expired lots are never allocated.
+// It returns the allocations and the quantity left unallocated.
+func planAllocation(quantity int, warehouses []warehouseQuantity, lots []lotQuantity) ([]allocation, int) {
+	// A lot can only be allocated as far as its warehouse balance allows
+	balance := map[int]int{}
+	inLots := map[int]int{}
+	for _, w := range warehouses {
+		balance[w.warehouseID] = w.quantity
+	}
+	for _, l := range lots {
+		inLots[l.warehouseID] += l.quantity
+	}
+
+	var allocations []allocation
+	remaining := quantity
+	for _, l := range lots {
+		if remaining == 0 {
+			break
+		}
+		if l.expired {
+			continue
+		}
+		take := min(remaining, min(l.quantity, balance[l.warehouseID]))
+		if take > 0 {
+			allocations = append(allocations, allocation{warehouseID: l.warehouseID, lotID: l.lotID, lotNumber: l.lotNumber, quantity: take})
+			balance[l.warehouseID] -= take
+			remaining -= take
+		}
+	}
+	for _, w := range warehouses {
+		if remaining == 0 {
+			break
+		}
+		unlotted := min(balance[w.warehouseID], w.quantity-inLots[w.warehouseID])
+		take := min(remaining, unlotted)
+		if take > 0 {
+			allocations = append(allocations, allocation{warehouseID: w.warehouseID, quantity: take})
+			remaining -= take
+		}
+	}
+	return allocations, remaining
+}
+
+// allocatableStock returns how much of a warehouse balance of quantity
+// planAllocation can allocate, when inLots of it is held in lots and
+// expired of those in expired lots.
+func allocatableStock(quantity, inLots, expired int) int {
+	fromLots := min(inLots-expired, max(quantity, 0))
+	return fromLots + max(min(quantity-fromLots, quantity-inLots), 0)
+}
+
+// GetLots returns the stocked lots of sku, soonest expiry first.
+func (s *InventoryService) GetLots(ctx context.Context, sku string) (_ []models.Lot, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetLots", attribute.String("sku", sku))
+	defer end(span, &err)
+	sql := `
+		SELECT l.id, l.sku, l.lot_number, COALESCE(to_char(l.manufactured_on, 'YYYY-MM-DD'), ''),
+			COALESCE(to_char(l.expires_on, 'YYYY-MM-DD'), ''), ls.warehouse_id, COALESCE(w.name, ''), ls.quantity
+		FROM lots l
+		JOIN lot_stock ls ON ls.lot_id = l.id
+		LEFT JOIN warehouses w ON w.id = ls.warehouse_id
+		WHERE l.sku = $1 AND ls.quantity > 0
+		ORDER BY l.expires_on ASC NULLS LAST, l.id, ls.warehouse_id
+	`
+	rows, err := s.db.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
+	}
+	return scanLots(rows)
+}
+
+// TraceLot returns every lot numbered lotNumber, optionally limited to one
+// SKU, with the warehouses holding it and the ledger entries that moved it.
+// It returns a *NotFoundError if there is no such lot.
+func (s *InventoryService) TraceLot(ctx context.Context, lotNumber, sku string) (_ []models.LotTrace, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.TraceLot", attribute.String("lot_number", lotNumber))
+	defer end(span, &err)
+	sql := `
+		SELECT l.id, l.sku, l.lot_number, COALESCE(to_char(l.manufactured_on, 'YYYY-MM-DD'), ''),
+			COALESCE(to_char(l.expires_on, 'YYYY-MM-DD'), ''), COALESCE(ls.warehouse_id, 0), COALESCE(w.name, ''), COALESCE(ls.quantity, 0)
+		FROM lots l
+		LEFT JOIN lot_stock ls ON ls.lot_id = l.id AND ls.quantity > 0
+		LEFT JOIN warehouses w ON w.id = ls.warehouse_id
+		WHERE l.lot_number = $1 AND ($2 = '' OR l.sku = $2)
+		ORDER BY l.sku, l.id, ls.warehouse_id
+	`
+	rows, err := s.db.Query(ctx, sql, lotNumber, sku)
+	if err != nil {
+		return nil, err
+	}
+	lots, err := scanLots(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(lots) == 0 {
+		return nil, &NotFoundError{Resource: "lot", ID: lotNumber}
+	}
+
+	traces := make([]models.LotTrace, len(lots))
+	index := map[int]int{}
+	ids := make([]int, len(lots))
+	for i, lot := range lots {
+		traces[i] = models.LotTrace{Lot: lot, Transactions: []models.InventoryTransaction{}}
+		index[lot.ID] = i
+		ids[i] = lot.ID
+	}
+
+	sql = `
+		SELECT lot_id, id, sku, warehouse_id, change, type, COALESCE(channel, ''), timestamp
+		FROM inventory_transactions
+		WHERE lot_id = ANY($1)
+		ORDER BY timestamp, id
+	`
+	rows, err = s.db.Query(ctx, sql, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var lotID int
+		var t models.InventoryTransaction
+		if err := rows.Scan(&lotID, &t.ID, &t.SKU, &t.WarehouseID, &t.Change, &t.Type, &t.Channel, &t.Timestamp); err != nil {
+			return nil, err
+		}
+		i := index[lotID]
+		t.LotNumber = traces[i].LotNumber
+		traces[i].Transactions = append(traces[i].Transactions, t)
+	}
+	return traces, rows.Err()
+}
+
+// scanLots reads lot rows with one row per lot and warehouse, ordered by
+// lot. A warehouse ID of zero marks a lot with no stock.
+func scanLots(rows db.Rows) ([]models.Lot, error) {
+	defer rows.Close()
+
+	lots := []models.Lot{}
+	for rows.Next() {
+		var lot models.Lot
+		var w models.LotWarehouse
+		if err := rows.Scan(&lot.ID, &lot.SKU, &lot.LotNumber, &lot.ManufacturedOn, &lot.ExpiresOn, &w.WarehouseID, &w.Name, &w.Quantity); err != nil {
+			return nil, err
+		}
+		if n := len(lots); n == 0 || lots[n-1].ID != lot.ID {
+			lot.Warehouses = []models.LotWarehouse{}
+			lots = append(lots, lot)
+		}
+		if w.WarehouseID != 0 {
+			last := &lots[len(lots)-1]
+			last.Warehouses = append(last.Warehouses, w)
+			last.Quantity += w.Quantity
+		}
+	}
+	return lots, rows.Err()
+}
+
+// AlertExpiringLots sends a near-expiry alert for each stocked lot expiring
+// within the alert window that has not been alerted yet, and returns how
+// many were sent. Lots are claimed before alerting so that each is alerted
+// once across instances; a lot whose alert cannot be queued is released
+// for the next run.
+func (s *InventoryService) AlertExpiringLots(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.AlertExpiringLots")
+	defer end(span, &err)
+	if s.expiryNotifier == nil {
+		return 0, nil
+	}
+
+	sql := `
+		UPDATE lots l
+		SET expiry_alerted_at = now()
+		WHERE l.expiry_alerted_at IS NULL
+			AND l.expires_on <= CURRENT_DATE + $1::int
+			AND EXISTS (SELECT 1 FROM lot_stock ls WHERE ls.lot_id = l.id AND ls.quantity > 0)
+		RETURNING l.id, l.sku, l.lot_number, to_char(l.expires_on, 'YYYY-MM-DD'),
+			(SELECT SUM(quantity) FROM lot_stock WHERE lot_id = l.id)::int,
+			ARRAY(SELECT warehouse_id FROM lot_stock WHERE lot_id = l.id AND quantity > 0 ORDER BY warehouse_id)
+	`
+	rows, err := s.db.Query(ctx, sql, s.expiryAlertDays)
+	if err != nil {
+		return 0, err
+	}
+	type claimed struct {
+		id  int
+		lot models.ExpiringLot
+	}
+	var lots []claimed
+	for rows.Next() {
+		var c claimed
+		if err := rows.Scan(&c.id, &c.lot.SKU, &c.lot.LotNumber, &c.lot.ExpiresOn, &c.lot.Quantity, &c.lot.WarehouseIDs); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		lots = append(lots, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, c := range lots {
+		log := slog.With("sku", c.lot.SKU, "lot_number", c.lot.LotNumber)
+		if err := s.expiryNotifier.NotifyNearExpiry(ctx, c.lot); err != nil {
+			log.ErrorContext(ctx, "failed to queue near expiry alert", "error", err)
+			if err := s.db.Exec(ctx, `UPDATE lots SET expiry_alerted_at = NULL WHERE id = $1`, c.id); err != nil {
+				log.ErrorContext(ctx, "error releasing near expiry alert", "error", err)
+			}
+			continue
+		}
+		log.InfoContext(ctx, "near expiry detected", "expires_on", c.lot.ExpiresOn, "quantity", c.lot.Quantity)
+		metrics.NearExpiryAlerts.Inc()
+		sent++
+	}
+	return sent, nil
+}
+
+// RunExpiryAlerts checks for lots nearing expiry every interval until ctx
+// is done.
+func (s *InventoryService) RunExpiryAlerts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.AlertExpiringLots(ctx); err != nil {
+				slog.ErrorContext(ctx, "error checking lots nearing expiry", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanAllocationFirstExpiredFirstOut(t *testing.T) {
+	warehouses := []warehouseQuantity{{warehouseID: 1, quantity: 10}, {warehouseID: 2, quantity: 5}}
+	lots := []lotQuantity{
+		{lotID: 8, warehouseID: 1, quantity: 4, expired: true},
+		{lotID: 7, warehouseID: 2, quantity: 3},
+		{lotID: 9, warehouseID: 1, quantity: 2},
+	}
+
+	allocations, remaining := planAllocation(9, warehouses, lots)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, []allocation{
+		{warehouseID: 2, lotID: 7, quantity: 3},
+		{warehouseID: 1, lotID: 9, quantity: 2},
+		{warehouseID: 1, quantity: 4},
+	}, allocations, "lots in expiry order, then stock outside lots; never the expired lot")
+
+	_, remaining = planAllocation(20, warehouses, lots)
+	assert.Equal(t, 9, remaining, "the 4 expired units are not sellable")
+}
+
+func TestPlanAllocationCapsLotsAtWarehouseBalance(t *testing.T) {
+	// Unlotted adjustments can leave the warehouse holding less than its lots
+	allocations, remaining := planAllocation(5, []warehouseQuantity{{warehouseID: 1, quantity: 2}}, []lotQuantity{{lotID: 7, warehouseID: 1, quantity: 4}})
+	assert.Equal(t, []allocation{{warehouseID: 1, lotID: 7, quantity: 2}}, allocations)
+	assert.Equal(t, 3, remaining)
+}
+
+func TestAllocatableStockMatchesPlanAllocation(t *testing.T) {
+	for _, c := range []struct{ quantity, inLots, expired int }{
+		{100, 0, 0}, {100, 90, 80}, {100, 90, 0}, {2, 4, 0}, {2, 4, 3}, {-5, 4, 4}, {0, 0, 0},
+	} {
+		lots := []lotQuantity{{lotID: 1, warehouseID: 1, quantity: c.expired, expired: true}, {lotID: 2, warehouseID: 1, quantity: c.inLots - c.expired}}
+		_, remaining := planAllocation(1000, []warehouseQuantity{{warehouseID: 1, quantity: c.quantity}}, lots)
+		assert.Equal(t, 1000-remaining, allocatableStock(c.quantity, c.inLots, c.expired), "%+v", c)
+	}
+}
+
+func TestSimulateOrderAllocatesLots(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 5}}
+	fdb.results["FROM lot_stock ls"] = [][]interface{}{{7, "L7", 1, 3, false}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Allocation{{WarehouseID: 1, Quantity: 3, LotNumber: "L7"}, {WarehouseID: 1, Quantity: 1}}, allocations)
+	ledger := fdb.statements("INSERT INTO inventory_transactions")
+	require.Len(t, ledger, 2)
+	assert.Equal(t, []interface{}{-3, 7}, []interface{}{ledger[0].args[2], ledger[0].args[6]})
+	assert.Equal(t, []interface{}{-1, 0}, []interface{}{ledger[1].args[2], ledger[1].args[6]})
+	lotUpdates := fdb.statements("UPDATE lot_stock")
+	require.Len(t, lotUpdates, 1)
+	assert.Equal(t, []interface{}{3, 7, 1}, lotUpdates[0].args)
+}
+
+func TestAddOrUpdateStockWithLot(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["INSERT INTO lots"] = [][]interface{}{{7, "2024-01-01", "2025-01-31"}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{
+		SKU: "test", WarehouseID: 1, Quantity: 5, LotNumber: "L1", ExpiresOn: "2025-01-31",
+	})
+	require.NoError(t, err)
+	assert.Len(t, fdb.statements("INSERT INTO lot_stock"), 1)
+	assert.Equal(t, 7, fdb.statements("INSERT INTO inventory_transactions")[0].args[6])
+
+	// A lot keeps the dates it was created with
+	err = svc.AddOrUpdateStock(context.Background(), models.StockUpdate{
+		SKU: "test", WarehouseID: 1, Quantity: 5, LotNumber: "L1", ExpiresOn: "2025-02-28",
+	})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "expires_on", invalid.Fields[0].Field)
+	assert.Equal(t, 1, fdb.rollbacks)
+}
+
+func TestAddOrUpdateStockLotShortage(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["INSERT INTO lots"] = [][]interface{}{{7, "", ""}}
+	fdb.results["WHERE lot_id = $1 AND warehouse_id = $2"] = [][]interface{}{{2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -3, LotNumber: "L1"})
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, &InsufficientStockError{SKU: "test", Requested: 3, Available: 2}, shortage)
+	assert.Empty(t, fdb.statements("INSERT INTO lot_stock"))
+}
+
+func TestValidateStockUpdateLotDates(t *testing.T) {
+	err := validateStockUpdate(models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1, ManufacturedOn: "2025-02-01", ExpiresOn: "2025-01-31"})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{
+		{Field: "expires_on", Message: "must not be before manufactured_on"},
+		{Field: "lot_number", Message: "is required when lot dates are given"},
+	}, invalid.Fields)
+
+	err = validateStockUpdate(models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1, LotNumber: "L1", ExpiresOn: "31/01/2025"})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "expires_on", invalid.Fields[0].Field)
+}
+
+func TestTraceLot(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fdb := newFakeDB()
+	fdb.results["WHERE l.lot_number"] = [][]interface{}{
+		{7, "a", "L1", "", "2025-01-31", 1, "Main", 3},
+		{7, "a", "L1", "", "2025-01-31", 2, "", 2},
+		{9, "b", "L1", "", "", 0, "", 0},
+	}
+	fdb.results["WHERE lot_id = ANY"] = [][]interface{}{{7, 100, "a", 1, 5, "stock_update", "", at}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	traces, err := svc.TraceLot(context.Background(), "L1", "")
+	require.NoError(t, err)
+	require.Len(t, traces, 2)
+	assert.Equal(t, 5, traces[0].Quantity)
+	assert.Equal(t, []models.LotWarehouse{{WarehouseID: 1, Name: "Main", Quantity: 3}, {WarehouseID: 2, Quantity: 2}}, traces[0].Warehouses)
+	assert.Equal(t, []models.InventoryTransaction{{ID: 100, SKU: "a", WarehouseID: 1, Change: 5, Type: "stock_update", LotNumber: "L1", Timestamp: at}}, traces[0].Transactions)
+	assert.Equal(t, 0, traces[1].Quantity)
+	assert.Empty(t, traces[1].Warehouses)
+	assert.Empty(t, traces[1].Transactions)
+
+	delete(fdb.results, "WHERE l.lot_number")
+	_, err = svc.TraceLot(context.Background(), "L2", "")
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
+
+type fakeExpiryNotifier struct {
+	alerted []models.ExpiringLot
+	err     error
+}
+
+func (f *fakeExpiryNotifier) NotifyNearExpiry(ctx context.Context, lot models.ExpiringLot) error {
+	f.alerted = append(f.alerted, lot)
+	return f.err
+}
+
+func TestAlertExpiringLots(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["UPDATE lots l"] = [][]interface{}{{7, "test", "L1", "2025-01-31", 12, []int{1, 3}}}
+	notifier := &fakeExpiryNotifier{}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetExpiryNotifier(notifier, 30)
+
+	sent, err := svc.AlertExpiringLots(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []interface{}{30}, fdb.queries[0].args)
+	assert.Equal(t, []models.ExpiringLot{{SKU: "test", LotNumber: "L1", ExpiresOn: "2025-01-31", Quantity: 12, WarehouseIDs: []int{1, 3}}}, notifier.alerted)
+	assert.Empty(t, fdb.statements("expiry_alerted_at = NULL"))
+
+	// A lot whose alert cannot be queued is released for the next run
+	notifier.err = errors.New("webhook queue is full")
+	sent, err = svc.AlertExpiringLots(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	released := fdb.statements("expiry_alerted_at = NULL")
+	require.Len(t, released, 1)
+	assert.Equal(t, []interface{}{7}, released[0].args)
+}
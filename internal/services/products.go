@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetProduct returns the catalog entry of sku, or a *NotFoundError.
+func (s *InventoryService) GetProduct(ctx context.Context, sku string) (_ models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetProduct", attribute.String("sku", sku))
+	defer end(span, &err)
+	rows, err := s.db.Query(ctx, `SELECT sku, name, serialized, COALESCE(parent_sku, '') FROM products WHERE sku = $1`, sku)
+	if err != nil {
+		return models.Product{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return models.Product{}, err
+		}
+		return models.Product{}, &NotFoundError{Resource: "product", ID: sku}
+	}
+	var p models.Product
+	if err := rows.Scan(&p.SKU, &p.Name, &p.Serialized, &p.Parent); err != nil {
+		return models.Product{}, err
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(ctx, `SELECT unit, factor FROM product_units WHERE sku = $1 ORDER BY factor, unit`, sku)
+	if err != nil {
+		return models.Product{}, err
+	}
+	p.Units = []models.UnitOfMeasure{{Unit: models.BaseUnit, Factor: 1}}
+	for rows.Next() {
+		var u models.UnitOfMeasure
+		if err := rows.Scan(&u.Unit, &u.Factor); err != nil {
+			return models.Product{}, err
+		}
+		p.Units = append(p.Units, u)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Product{}, err
+	}
+	rows.Close()
+
+	if p.Components, err = kitComponents(ctx, s.db, sku); err != nil {
+		return models.Product{}, err
+	}
+	if p.Parent != "" {
+		if p.Attributes, err = s.variantValues(ctx, sku); err != nil {
+			return models.Product{}, err
+		}
+	}
+	if p.VariantAttributes, err = variantAttributes(ctx, s.db, sku); err != nil {
+		return models.Product{}, err
+	}
+	variants, err := loadVariants(ctx, s.db, sku)
+	for _, v := range variants {
+		p.Variants = append(p.Variants, v.sku)
+	}
+	return p, err
+}
+
+// variantValues returns the attribute values of the variant sku.
+func (s *InventoryService) variantValues(ctx context.Context, sku string) (map[string]string, error) {
+	rows, err := s.db.Query(ctx, `SELECT attribute, value FROM variant_values WHERE sku = $1`, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[string]string{}
+	for rows.Next() {
+		var attribute, value string
+		if err := rows.Scan(&attribute, &value); err != nil {
+			return nil, err
+		}
+		values[attribute] = value
+	}
+	return values, rows.Err()
+}
+
+// validateProduct reports every invalid field of product.
+func validateProduct(product models.Product) error {
+	v := &ValidationError{}
+	v.add(product.SKU != "", "sku", "is required")
+	v.add(len(product.SKU) <= 100, "sku", "must be at most 100 characters")
+	v.add(product.Name != "", "name", "is required")
+	v.add(len(product.Name) <= 255, "name", "must be at most 255 characters")
+	validateUnits(v, product.Units)
+	validateKitComponents(v, product.SKU, product.Components)
+	v.add(!product.Serialized || len(product.Components) == 0, "serialized", "must be false for kits")
+	validateVariants(v, product)
+	return v.err()
+}
+
+// SaveProduct creates or replaces the catalog entry of product.SKU and its
+// units of measure. Serial tracking can only be switched while the SKU holds
+// no stock, so that the registered serials always account for every unit.
+// Stock is held in base units, so units can change at any time. Components
+// make the product a kit, whose stock is derived from theirs; they can only
+// be defined while the SKU itself holds no stock, and the same goes for the
+// attributes that make it a parent product. It returns the product as
+// GetProduct would, apart from its list of variants.
+func (s *InventoryService) SaveProduct(ctx context.Context, product models.Product) (_ models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.SaveProduct", attribute.String("sku", product.SKU))
+	defer end(span, &err)
+	if err := validateProduct(product); err != nil {
+		return models.Product{}, err
+	}
+
+	// Base unit first, then by size as GetProduct lists them
+	units := []models.UnitOfMeasure{{Unit: models.BaseUnit, Factor: 1}}
+	for _, u := range product.Units {
+		if u.Unit != models.BaseUnit {
+			units = append(units, u)
+		}
+	}
+	sort.SliceStable(units[1:], func(i, j int) bool {
+		a, b := units[1+i], units[1+j]
+		return a.Factor < b.Factor || (a.Factor == b.Factor && a.Unit < b.Unit)
+	})
+	product.Units = units
+	sort.Slice(product.Components, func(i, j int) bool { return product.Components[i].SKU < product.Components[j].SKU })
+
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		// Lock the SKU's stock so none arrives while the mode changes
+		sql := `
+			SELECT COALESCE((SELECT serialized FROM products WHERE sku = $1 FOR UPDATE), false),
+				EXISTS (SELECT 1 FROM stock_levels WHERE sku = $1 AND quantity <> 0 FOR UPDATE)
+		`
+		var serialized, stocked bool
+		if err := queryRow(ctx, tx, sql, []interface{}{product.SKU}, &serialized, &stocked); err != nil {
+			return err
+		}
+		if serialized != product.Serialized && stocked {
+			return Invalid("serialized", "cannot be changed while the SKU holds stock")
+		}
+		if len(product.Components) > 0 && stocked {
+			return Invalid("components", "cannot be defined while the SKU holds stock")
+		}
+		if err := checkVariants(ctx, tx, product, stocked); err != nil {
+			return err
+		}
+
+		sql = `
+			INSERT INTO products (sku, name, serialized, parent_sku)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			ON CONFLICT (sku) DO UPDATE
+			SET name = EXCLUDED.name, serialized = EXCLUDED.serialized, parent_sku = EXCLUDED.parent_sku
+		`
+		if err := tx.Exec(ctx, sql, product.SKU, product.Name, product.Serialized, product.Parent); err != nil {
+			return err
+		}
+
+		if err := tx.Exec(ctx, `DELETE FROM product_units WHERE sku = $1`, product.SKU); err != nil {
+			return err
+		}
+		if len(units) > 1 {
+			var names []string
+			var factors []int
+			for _, u := range units[1:] {
+				names = append(names, u.Unit)
+				factors = append(factors, u.Factor)
+			}
+			sql = `
+				INSERT INTO product_units (sku, unit, factor)
+				SELECT $1, unnest($2::text[]), unnest($3::int[])
+			`
+			if err := tx.Exec(ctx, sql, product.SKU, names, factors); err != nil {
+				return err
+			}
+		}
+		if err := saveKitComponents(ctx, tx, product.SKU, product.Components); err != nil {
+			return err
+		}
+		return saveVariants(ctx, tx, product)
+	})
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	// A kit's cached stock no longer matches its components
+	if s.cache != nil {
+		if err := s.cache.Invalidate(ctx, product.SKU); err != nil {
+			slog.ErrorContext(ctx, "error invalidating stock cache", "skus", []string{product.SKU}, "error", err)
+		}
+	}
+	return product, nil
+}
+
+// isSerialized reports whether sku is tracked by serial number. The product
+// is locked against SaveProduct switching the mode until tx ends.
+func isSerialized(ctx context.Context, tx db.Tx, sku string) (bool, error) {
+	var serialized bool
+	err := queryRow(ctx, tx, `SELECT serialized FROM products WHERE sku = $1 FOR SHARE`, []interface{}{sku}, &serialized)
+	return serialized, err
+}
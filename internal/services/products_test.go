@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProductNotFound(t *testing.T) {
+	svc := NewInventoryService(newFakeDB(), &fakeRedis{})
+
+	_, err := svc.GetProduct(context.Background(), "test")
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestSaveProduct(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.SaveProduct(context.Background(), models.Product{SKU: "test", Name: "Phone", Serialized: true})
+	require.NoError(t, err)
+	upserts := fdb.statements("INSERT INTO products")
+	require.Len(t, upserts, 1)
+	assert.Equal(t, []interface{}{"test", "Phone", true, ""}, upserts[0].args)
+}
+
+func TestSaveProductRejectsModeChangeWhileStocked(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["EXISTS ("] = [][]interface{}{{false, true}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.SaveProduct(context.Background(), models.Product{SKU: "test", Name: "Phone", Serialized: true})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "serialized", invalid.Fields[0].Field)
+	assert.Empty(t, fdb.statements("INSERT INTO products"))
+
+	// Renaming keeps the mode and is always allowed
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "test", Name: "Phone 2"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/events"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// maxPurchaseOrderLines bounds the lines of one purchase order or receipt.
+	maxPurchaseOrderLines = 500
+	// MaxPurchaseOrderListLimit bounds the page size of ListPurchaseOrders.
+	MaxPurchaseOrderListLimit = 500
+	// defaultPurchaseOrderListLimit is the page size of ListPurchaseOrders
+	// when none is given.
+	defaultPurchaseOrderListLimit = 100
+)
+
+// validatePurchaseOrder reports every invalid field of po.
+func validatePurchaseOrder(po models.PurchaseOrder) error {
+	v := &ValidationError{}
+	v.add(po.Reference != "", "reference", "is required")
+	v.add(len(po.Reference) <= 100, "reference", "must be at most 100 characters")
+	v.add(len(po.Supplier) <= 255, "supplier", "must be at most 255 characters")
+	v.add(len(po.Lines) > 0, "lines", "must list at least one line")
+	v.add(len(po.Lines) <= maxPurchaseOrderLines, "lines", fmt.Sprintf("must list at most %d lines", maxPurchaseOrderLines))
+	type key struct {
+		sku         string
+		warehouseID int
+	}
+	seen := map[key]bool{}
+	for _, l := range po.Lines {
+		_, ok := parseDate(l.ExpectedOn)
+		switch {
+		case l.SKU == "" || len(l.SKU) > 100:
+			v.add(false, "lines", "must each have a SKU of at most 100 characters")
+		case l.WarehouseID <= 0:
+			v.add(false, "lines", fmt.Sprintf("%s must have a positive warehouse_id", l.SKU))
+		case seen[key{l.SKU, l.WarehouseID}]:
+			v.add(false, "lines", fmt.Sprintf("%s is listed more than once for warehouse %d", l.SKU, l.WarehouseID))
+		case l.Quantity <= 0:
+			v.add(false, "lines", fmt.Sprintf("%s must have a positive quantity", l.SKU))
+		default:
+			v.add(ok, "lines", fmt.Sprintf("%s must have an expected_on date formatted as YYYY-MM-DD", l.SKU))
+		}
+		seen[key{l.SKU, l.WarehouseID}] = true
+	}
+	return v.err()
+}
+
+// CreatePurchaseOrder records stock ordered from a supplier, which counts
+// as incoming in the stock of its SKUs until it is received or the order
+// is closed.
+func (s *InventoryService) CreatePurchaseOrder(ctx context.Context, po models.PurchaseOrder) (_ models.PurchaseOrder, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.CreatePurchaseOrder", attribute.String("reference", po.Reference))
+	defer end(span, &err)
+	if err := validatePurchaseOrder(po); err != nil {
+		return models.PurchaseOrder{}, err
+	}
+
+	var skus, expected []string
+	var warehouseIDs, quantities []int
+	for _, l := range po.Lines {
+		skus = append(skus, l.SKU)
+		warehouseIDs = append(warehouseIDs, l.WarehouseID)
+		quantities = append(quantities, l.Quantity)
+		expected = append(expected, l.ExpectedOn)
+	}
+
+	var id int
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		rows, err := tx.Query(ctx, `SELECT id FROM warehouses WHERE id = ANY($1)`, warehouseIDs)
+		if err != nil {
+			return err
+		}
+		known := map[int]bool{}
+		for rows.Next() {
+			var warehouseID int
+			if err := rows.Scan(&warehouseID); err != nil {
+				rows.Close()
+				return err
+			}
+			known[warehouseID] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, warehouseID := range warehouseIDs {
+			if !known[warehouseID] {
+				return &NotFoundError{Resource: "warehouse", ID: strconv.Itoa(warehouseID)}
+			}
+		}
+
+		// Kits and parent products hold no stock of their own
+		sql := `
+			SELECT EXISTS (SELECT 1 FROM kit_components WHERE kit_sku = ANY($1)),
+				EXISTS (SELECT 1 FROM variant_attributes WHERE parent_sku = ANY($1))
+		`
+		var kit, parent bool
+		if err := queryRow(ctx, tx, sql, []interface{}{skus}, &kit, &parent); err != nil {
+			return err
+		}
+		v := &ValidationError{}
+		v.add(!kit, "lines", "must not order kits; order their components instead")
+		v.add(!parent, "lines", "must not order parent products; order their variants instead")
+		if err := v.err(); err != nil {
+			return err
+		}
+
+		sql = `
+			INSERT INTO purchase_orders (reference, supplier, status, created_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (reference) DO NOTHING
+			RETURNING id
+		`
+		args := []interface{}{po.Reference, po.Supplier, models.PurchaseOrderOpen, audit.FromContext(ctx).Actor}
+		if err := queryRow(ctx, tx, sql, args, &id); err != nil {
+			return err
+		}
+		if id == 0 {
+			return Invalid("reference", fmt.Sprintf("%s already exists", po.Reference))
+		}
+
+		sql = `
+			INSERT INTO purchase_order_lines (purchase_order_id, sku, warehouse_id, quantity, expected_on)
+			SELECT $1, unnest($2::text[]), unnest($3::int[]), unnest($4::int[]), NULLIF(unnest($5::text[]), '')::date
+		`
+		return tx.Exec(ctx, sql, id, skus, warehouseIDs, quantities, expected)
+	})
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+
+	s.invalidateStock(ctx, skus)
+	return s.GetPurchaseOrder(ctx, id)
+}
+
+// GetPurchaseOrder returns a purchase order with its lines, or a
+// *NotFoundError.
+func (s *InventoryService) GetPurchaseOrder(ctx context.Context, id int) (_ models.PurchaseOrder, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetPurchaseOrder", attribute.Int("id", id))
+	defer end(span, &err)
+	orders, err := s.loadPurchaseOrders(ctx, `WHERE po.id = $1`, []interface{}{id})
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+	if len(orders) == 0 {
+		return models.PurchaseOrder{}, &NotFoundError{Resource: "purchase order", ID: strconv.Itoa(id)}
+	}
+	return orders[0], nil
+}
+
+// ListPurchaseOrders returns the purchase orders matching filter, newest
+// first.
+func (s *InventoryService) ListPurchaseOrders(ctx context.Context, filter models.PurchaseOrderFilter) (_ []models.PurchaseOrder, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ListPurchaseOrders")
+	defer end(span, &err)
+	v := &ValidationError{}
+	v.add(filter.Status == "" || filter.Status == models.PurchaseOrderOpen || filter.Status == models.PurchaseOrderReceived || filter.Status == models.PurchaseOrderClosed,
+		"status", "must be one of open, received or closed")
+	v.add(filter.Limit >= 0 && filter.Limit <= MaxPurchaseOrderListLimit, "limit", fmt.Sprintf("must not exceed %d", MaxPurchaseOrderListLimit))
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultPurchaseOrderListLimit
+	}
+
+	where := `
+		WHERE ($1 = '' OR po.status = $1)
+			AND ($2 = '' OR EXISTS (SELECT 1 FROM purchase_order_lines WHERE purchase_order_id = po.id AND sku = $2))
+		ORDER BY po.id DESC
+		LIMIT $3
+	`
+	return s.loadPurchaseOrders(ctx, where, []interface{}{filter.Status, filter.SKU, filter.Limit})
+}
+
+// loadPurchaseOrders returns the purchase orders selected by where, which
+// may also order and limit them, with their lines.
+func (s *InventoryService) loadPurchaseOrders(ctx context.Context, where string, args []interface{}) ([]models.PurchaseOrder, error) {
+	sql := `
+		SELECT po.id, po.reference, po.supplier, po.status, po.created_by, po.created_at
+		FROM purchase_orders po
+	` + where
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	orders := []models.PurchaseOrder{}
+	var ids []int
+	for rows.Next() {
+		po := models.PurchaseOrder{Lines: []models.PurchaseOrderLine{}}
+		if err := rows.Scan(&po.ID, &po.Reference, &po.Supplier, &po.Status, &po.CreatedBy, &po.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, po)
+		ids = append(ids, po.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	sql = `
+		SELECT purchase_order_id, sku, warehouse_id, quantity, received, COALESCE(to_char(expected_on, 'YYYY-MM-DD'), '')
+		FROM purchase_order_lines
+		WHERE purchase_order_id = ANY($1)
+		ORDER BY id
+	`
+	rows, err = s.db.Query(ctx, sql, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int, len(orders))
+	for i, po := range orders {
+		index[po.ID] = i
+	}
+	for rows.Next() {
+		var id int
+		var l models.PurchaseOrderLine
+		if err := rows.Scan(&id, &l.SKU, &l.WarehouseID, &l.Quantity, &l.Received, &l.ExpectedOn); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			orders[i].Lines = append(orders[i].Lines, l)
+		}
+	}
+	return orders, rows.Err()
+}
+
+// ReceivePurchaseOrder adds stock received against an open purchase order.
+// Each receipt line must match a line of the order; lines may arrive in
+// parts and in excess of the quantity ordered. Every line is recorded in
+// the ledger as a receipt linked to the order, and the order is marked
+// received once every line has arrived in full. The receipt is applied
+// all or nothing.
+func (s *InventoryService) ReceivePurchaseOrder(ctx context.Context, id int, receipt models.Receipt) (_ models.PurchaseOrder, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ReceivePurchaseOrder", attribute.Int("id", id), attribute.Int("line_count", len(receipt.Lines)))
+	defer end(span, &err)
+	if len(receipt.Lines) == 0 {
+		return models.PurchaseOrder{}, Invalid("lines", "must list at least one line")
+	}
+	if len(receipt.Lines) > maxPurchaseOrderLines {
+		return models.PurchaseOrder{}, Invalid("lines", fmt.Sprintf("must list at most %d lines", maxPurchaseOrderLines))
+	}
+	updates := make([]models.StockUpdate, len(receipt.Lines))
+	for i, update := range receipt.Lines {
+		if err := validateStockUpdate(update); err != nil {
+			return models.PurchaseOrder{}, err
+		}
+		if update.Quantity < 0 {
+			return models.PurchaseOrder{}, Invalid("quantity", "must be positive for receipts")
+		}
+		quantity := update.Quantity
+		if update.Quantity, err = s.toBaseUnits(ctx, update.SKU, update.Unit, update.Quantity); err != nil {
+			return models.PurchaseOrder{}, err
+		}
+		update.Unit = ""
+		update.UnitCost = costPerBaseUnit(update.UnitCost, quantity, update.Quantity)
+		update.ReasonCode = models.ReasonReceipt
+		updates[i] = update
+	}
+
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		var status string
+		if err := queryRow(ctx, tx, `SELECT status FROM purchase_orders WHERE id = $1 FOR UPDATE`, []interface{}{id}, &status); err != nil {
+			return err
+		}
+		if status == "" {
+			return &NotFoundError{Resource: "purchase order", ID: strconv.Itoa(id)}
+		}
+		if status != models.PurchaseOrderOpen {
+			return Invalid("status", fmt.Sprintf("purchase order is %s and cannot be received against", status))
+		}
+
+		for _, update := range updates {
+			var lineID int
+			sql := `SELECT id FROM purchase_order_lines WHERE purchase_order_id = $1 AND sku = $2 AND warehouse_id = $3`
+			if err := queryRow(ctx, tx, sql, []interface{}{id, update.SKU, update.WarehouseID}, &lineID); err != nil {
+				return err
+			}
+			if lineID == 0 {
+				return Invalid("lines", fmt.Sprintf("%s is not ordered for warehouse %d", update.SKU, update.WarehouseID))
+			}
+
+			txID, _, err := s.applyStockUpdate(ctx, tx, update, "receipt")
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec(ctx, `UPDATE purchase_order_lines SET received = received + $1 WHERE id = $2`, update.Quantity, lineID); err != nil {
+				return err
+			}
+			if err := tx.Exec(ctx, `INSERT INTO purchase_order_receipts (transaction_id, line_id) VALUES ($1, $2)`, txID, lineID); err != nil {
+				return err
+			}
+		}
+
+		sql := `
+			UPDATE purchase_orders
+			SET status = $2
+			WHERE id = $1
+				AND NOT EXISTS (SELECT 1 FROM purchase_order_lines WHERE purchase_order_id = $1 AND received < quantity)
+		`
+		return tx.Exec(ctx, sql, id, models.PurchaseOrderReceived)
+	})
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+
+	// Publish events
+	changes := make([]events.InventoryEvent, 0, len(updates))
+	for _, update := range updates {
+		changes = append(changes, events.InventoryEvent{
+			SKU:         update.SKU,
+			WarehouseID: update.WarehouseID,
+			Change:      update.Quantity,
+			Reason:      update.ReasonCode,
+		})
+	}
+	s.publishInventoryEvents(ctx, changes...)
+	for _, update := range updates {
+		if err := s.redis.Publish(ctx, "inventory_updates", update); err != nil {
+			return models.PurchaseOrder{}, err
+		}
+	}
+	return s.GetPurchaseOrder(ctx, id)
+}
+
+// ClosePurchaseOrder closes an open purchase order, so that the stock
+// still outstanding on it no longer counts as incoming.
+func (s *InventoryService) ClosePurchaseOrder(ctx context.Context, id int) (_ models.PurchaseOrder, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ClosePurchaseOrder", attribute.Int("id", id))
+	defer end(span, &err)
+
+	var skus []string
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		var status string
+		if err := queryRow(ctx, tx, `SELECT status FROM purchase_orders WHERE id = $1 FOR UPDATE`, []interface{}{id}, &status); err != nil {
+			return err
+		}
+		if status == "" {
+			return &NotFoundError{Resource: "purchase order", ID: strconv.Itoa(id)}
+		}
+		if status != models.PurchaseOrderOpen {
+			return Invalid("status", fmt.Sprintf("purchase order is already %s", status))
+		}
+		if err := tx.Exec(ctx, `UPDATE purchase_orders SET status = $2 WHERE id = $1`, id, models.PurchaseOrderClosed); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `SELECT DISTINCT sku FROM purchase_order_lines WHERE purchase_order_id = $1 AND received < quantity`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sku string
+			if err := rows.Scan(&sku); err != nil {
+				return err
+			}
+			skus = append(skus, sku)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+
+	s.invalidateStock(ctx, skus)
+	return s.GetPurchaseOrder(ctx, id)
+}
+
+// invalidateStock drops the cached stock of skus after a change to their
+// incoming stock, which publishes no inventory events.
+func (s *InventoryService) invalidateStock(ctx context.Context, skus []string) {
+	if s.cache == nil || len(skus) == 0 {
+		return
+	}
+	if err := s.cache.Invalidate(ctx, skus...); err != nil {
+		slog.ErrorContext(ctx, "error invalidating stock cache", "skus", skus, "error", err)
+	}
+}
+
+// addIncoming adds the stock still expected on open purchase orders to
+// summary, listing warehouses that only have stock on order.
+func (s *InventoryService) addIncoming(ctx context.Context, summary *models.StockSummary) error {
+	sql := `
+		SELECT l.warehouse_id, COALESCE(w.name, ''), COALESCE(w.location, ''),
+			SUM(l.quantity - l.received)::int, COALESCE(to_char(MIN(l.expected_on), 'YYYY-MM-DD'), '')
+		FROM purchase_order_lines l
+		JOIN purchase_orders po ON po.id = l.purchase_order_id
+		LEFT JOIN warehouses w ON w.id = l.warehouse_id
+		WHERE l.sku = $1 AND po.status = 'open' AND l.received < l.quantity
+		GROUP BY l.warehouse_id, w.name, w.location
+	`
+	rows, err := s.db.Query(ctx, sql, summary.SKU)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var incoming models.WarehouseStock
+		if err := rows.Scan(&incoming.WarehouseID, &incoming.Name, &incoming.Location, &incoming.Incoming, &incoming.NextArrival); err != nil {
+			return err
+		}
+		i := 0
+		for i < len(summary.Warehouses) && summary.Warehouses[i].WarehouseID != incoming.WarehouseID {
+			i++
+		}
+		if i == len(summary.Warehouses) {
+			summary.Warehouses = append(summary.Warehouses, incoming)
+		} else {
+			summary.Warehouses[i].Incoming = incoming.Incoming
+			summary.Warehouses[i].NextArrival = incoming.NextArrival
+		}
+		summary.Incoming += incoming.Incoming
+		if incoming.NextArrival != "" && (summary.NextArrival == "" || incoming.NextArrival < summary.NextArrival) {
+			summary.NextArrival = incoming.NextArrival
+		}
+	}
+	sort.SliceStable(summary.Warehouses, func(i, j int) bool {
+		return summary.Warehouses[i].WarehouseID < summary.Warehouses[j].WarehouseID
+	})
+	return rows.Err()
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePurchaseOrder(t *testing.T) {
+	err := validatePurchaseOrder(models.PurchaseOrder{Lines: []models.PurchaseOrderLine{
+		{SKU: "a", WarehouseID: 1, Quantity: 10, ExpectedOn: "2025-03-01"},
+		{SKU: "a", WarehouseID: 1, Quantity: 5},
+		{SKU: "b", WarehouseID: 1},
+		{SKU: "c", WarehouseID: 2, Quantity: 5, ExpectedOn: "01/03/2025"},
+		{SKU: "d", Quantity: 5},
+	}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{
+		{Field: "reference", Message: "is required"},
+		{Field: "lines", Message: "a is listed more than once for warehouse 1"},
+		{Field: "lines", Message: "b must have a positive quantity"},
+		{Field: "lines", Message: "c must have an expected_on date formatted as YYYY-MM-DD"},
+		{Field: "lines", Message: "d must have a positive warehouse_id"},
+	}, invalid.Fields)
+}
+
+func TestCreatePurchaseOrder(t *testing.T) {
+	at := time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC)
+	fdb, cache := newFakeDB(), &fakeCache{}
+	fdb.results["SELECT id FROM warehouses"] = [][]interface{}{{1}, {2}}
+	fdb.results["INSERT INTO purchase_orders"] = [][]interface{}{{7}}
+	fdb.results["FROM purchase_orders po"] = [][]interface{}{{7, "PO-1", "Acme", "open", "admin", at}}
+	fdb.results["WHERE purchase_order_id = ANY"] = [][]interface{}{{7, "a", 1, 10, 0, "2025-03-01"}, {7, "b", 2, 5, 0, ""}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetStockCache(cache)
+
+	po, err := svc.CreatePurchaseOrder(context.Background(), models.PurchaseOrder{Reference: "PO-1", Supplier: "Acme", Lines: []models.PurchaseOrderLine{
+		{SKU: "a", WarehouseID: 1, Quantity: 10, ExpectedOn: "2025-03-01"},
+		{SKU: "b", WarehouseID: 2, Quantity: 5},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, models.PurchaseOrder{ID: 7, Reference: "PO-1", Supplier: "Acme", Status: "open", CreatedBy: "admin", CreatedAt: at, Lines: []models.PurchaseOrderLine{
+		{SKU: "a", WarehouseID: 1, Quantity: 10, ExpectedOn: "2025-03-01"},
+		{SKU: "b", WarehouseID: 2, Quantity: 5},
+	}}, po)
+	lines := fdb.statements("INSERT INTO purchase_order_lines")
+	require.Len(t, lines, 1)
+	assert.Equal(t, []interface{}{7, []string{"a", "b"}, []int{1, 2}, []int{10, 5}, []string{"2025-03-01", ""}}, lines[0].args)
+	assert.Equal(t, []string{"a", "b"}, cache.invalidated, "the SKUs now have stock incoming")
+
+	_, err = svc.CreatePurchaseOrder(context.Background(), models.PurchaseOrder{Reference: "PO-2", Lines: []models.PurchaseOrderLine{{SKU: "a", WarehouseID: 3, Quantity: 1}}})
+	var notFound *NotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "3", notFound.ID)
+
+	delete(fdb.results, "INSERT INTO purchase_orders")
+	_, err = svc.CreatePurchaseOrder(context.Background(), models.PurchaseOrder{Reference: "PO-1", Lines: []models.PurchaseOrderLine{{SKU: "a", WarehouseID: 1, Quantity: 1}}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "reference", Message: "PO-1 already exists"}}, invalid.Fields)
+	assert.Len(t, fdb.statements("INSERT INTO purchase_order_lines"), 1)
+}
+
+func TestReceivePurchaseOrder(t *testing.T) {
+	fdb, fredis := newFakeDB(), &fakeRedis{}
+	fdb.results["SELECT status FROM purchase_orders"] = [][]interface{}{{"open"}}
+	fdb.results["SELECT id FROM purchase_order_lines"] = [][]interface{}{{11}}
+	fdb.results["INSERT INTO inventory_transactions"] = [][]interface{}{{100}}
+	fdb.results["FROM purchase_orders po"] = [][]interface{}{{7, "PO-1", "", "received", "", time.Time{}}}
+	fdb.results["WHERE purchase_order_id = ANY"] = [][]interface{}{{7, "a", 1, 10, 12, ""}}
+	svc := NewInventoryService(fdb, fredis)
+
+	po, err := svc.ReceivePurchaseOrder(context.Background(), 7, models.Receipt{Lines: []models.StockUpdate{{SKU: "a", WarehouseID: 1, Quantity: 12, Reason: "two extra"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.PurchaseOrderLine{{SKU: "a", WarehouseID: 1, Quantity: 10, Received: 12}}, po.Lines, "over receipts are accepted")
+
+	assert.Equal(t, []interface{}{"a", 1, 12}, fdb.statements("INSERT INTO stock_levels")[0].args)
+	ledger := fdb.statements("INSERT INTO inventory_transactions")
+	require.Len(t, ledger, 1)
+	assert.Equal(t, "receipt", ledger[0].args[3])
+	assert.Equal(t, []interface{}{12, 11}, fdb.statements("UPDATE purchase_order_lines")[0].args)
+	assert.Equal(t, []interface{}{100, 11}, fdb.statements("INSERT INTO purchase_order_receipts")[0].args)
+	assert.Equal(t, []interface{}{7, "received"}, fdb.statements("UPDATE purchase_orders")[0].args)
+	assert.Equal(t, models.StockUpdate{SKU: "a", WarehouseID: 1, Quantity: 12, Reason: "two extra", ReasonCode: models.ReasonReceipt}, fredis.published[0])
+	assert.Equal(t, 1, fdb.commits)
+}
+
+func TestReceivePurchaseOrderRejectsUnorderedLines(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT status FROM purchase_orders"] = [][]interface{}{{"open"}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.ReceivePurchaseOrder(context.Background(), 7, models.Receipt{Lines: []models.StockUpdate{{SKU: "a", WarehouseID: 2, Quantity: 5}}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "lines", Message: "a is not ordered for warehouse 2"}}, invalid.Fields)
+	assert.Empty(t, fdb.statements("INSERT INTO stock_levels"))
+
+	fdb.results["SELECT status FROM purchase_orders"] = [][]interface{}{{"closed"}}
+	_, err = svc.ReceivePurchaseOrder(context.Background(), 7, models.Receipt{Lines: []models.StockUpdate{{SKU: "a", WarehouseID: 1, Quantity: 5}}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "status", Message: "purchase order is closed and cannot be received against"}}, invalid.Fields)
+
+	_, err = svc.ReceivePurchaseOrder(context.Background(), 7, models.Receipt{Lines: []models.StockUpdate{{SKU: "a", WarehouseID: 1, Quantity: -5}}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "quantity", invalid.Fields[0].Field)
+	assert.Equal(t, 2, fdb.rollbacks)
+}
+
+func TestClosePurchaseOrder(t *testing.T) {
+	fdb, cache := newFakeDB(), &fakeCache{}
+	fdb.results["SELECT status FROM purchase_orders"] = [][]interface{}{{"open"}}
+	fdb.results["SELECT DISTINCT sku FROM purchase_order_lines"] = [][]interface{}{{"a"}}
+	fdb.results["FROM purchase_orders po"] = [][]interface{}{{7, "PO-1", "", "closed", "", time.Time{}}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetStockCache(cache)
+
+	po, err := svc.ClosePurchaseOrder(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, "closed", po.Status)
+	assert.Equal(t, []interface{}{7, "closed"}, fdb.statements("UPDATE purchase_orders")[0].args)
+	assert.Equal(t, []string{"a"}, cache.invalidated)
+
+	fdb.results["SELECT status FROM purchase_orders"] = [][]interface{}{{"received"}}
+	_, err = svc.ClosePurchaseOrder(context.Background(), 7)
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "status", Message: "purchase order is already received"}}, invalid.Fields)
+}
+
+func TestGetConsolidatedStockIncoming(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{2, "East", "", 5}}
+	fdb.results["FROM purchase_order_lines l"] = [][]interface{}{{2, "East", "", 4, "2025-03-01"}, {1, "Main", "", 10, "2025-02-15"}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	stock, err := svc.GetConsolidatedStock(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, models.StockSummary{
+		SKU:         "test",
+		OnHand:      5,
+		Available:   5,
+		Incoming:    14,
+		NextArrival: "2025-02-15",
+		Warehouses: []models.WarehouseStock{
+			{WarehouseID: 1, Name: "Main", Incoming: 10, NextArrival: "2025-02-15"},
+			{WarehouseID: 2, Name: "East", OnHand: 5, Available: 5, Incoming: 4, NextArrival: "2025-03-01"},
+		},
+	}, stock)
+
+	// Stock on order is enough for the SKU to be known
+	delete(fdb.results, "FROM stock_levels")
+	stock, err = svc.GetConsolidatedStock(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, 14, stock.Incoming)
+	assert.Equal(t, 0, stock.OnHand)
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"omnichannel_inventory/internal/audit"
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/events"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// MaxTransferProposalListLimit bounds the proposals listed at once.
+	MaxTransferProposalListLimit     = 500
+	defaultTransferProposalListLimit = 100
+)
+
+var defaultRebalancingConstraints = models.RebalancingConstraints{MinTransferQuantity: 10}
+
+// SetRebalancingConstraints sets the constraints transfers are recommended
+// under.
+func (s *InventoryService) SetRebalancingConstraints(constraints models.RebalancingConstraints) {
+	s.rebalancing = constraints
+}
+
+// warehouseDemand is the stock of a SKU in one warehouse and the units
+// ordered from it in the velocity window. Allocatable stock excludes
+// expired lots, which can be neither sold nor transferred.
+type warehouseDemand struct {
+	warehouseID int
+	allocatable int
+	incoming    int
+	sold        int
+}
+
+// daysOfCover returns how many days stock lasts at the rate sold over
+// window days, or nil when nothing was sold.
+func daysOfCover(stock, sold, window int) *float64 {
+	if sold == 0 {
+		return nil
+	}
+	days := math.Round(float64(max(stock, 0)*window)/float64(sold)*10) / 10
+	return &days
+}
+
+// planRebalancing recommends transfers of sku that bring the days of cover
+// of its warehouses closer together. Each warehouse's share of the
+// allocatable and incoming stock follows its share of the demand;
+// warehouses holding more than their share send allocatable stock to those
+// holding less, the warehouses with the least cover first. Transfers below
+// the minimum quantity or on routes that are not allowed are left out.
+func planRebalancing(sku string, warehouses []warehouseDemand, constraints models.RebalancingConstraints, window int) []models.TransferProposal {
+	total, sold := 0, 0
+	for _, w := range warehouses {
+		total += max(w.allocatable, 0) + w.incoming
+		sold += w.sold
+	}
+	if sold == 0 {
+		return nil
+	}
+
+	type side struct {
+		warehouseDemand
+		position int
+		amount   int
+		cover    float64
+	}
+	var donors, receivers []side
+	for _, w := range warehouses {
+		position := max(w.allocatable, 0) + w.incoming
+		target := float64(total) * float64(w.sold) / float64(sold)
+		cover := math.Inf(1)
+		if w.sold > 0 {
+			cover = float64(position) / float64(w.sold)
+		}
+		if surplus := int(math.Floor(float64(position) - target)); surplus > 0 {
+			// Only allocatable stock can be sent
+			if amount := min(surplus, max(w.allocatable, 0)); amount > 0 {
+				donors = append(donors, side{w, position, amount, cover})
+			}
+		} else if deficit := int(math.Ceil(target - float64(position))); deficit > 0 {
+			receivers = append(receivers, side{w, position, deficit, cover})
+		}
+	}
+	sort.SliceStable(donors, func(i, j int) bool { return donors[i].cover > donors[j].cover })
+	sort.SliceStable(receivers, func(i, j int) bool { return receivers[i].cover < receivers[j].cover })
+
+	var proposals []models.TransferProposal
+	for i := range receivers {
+		r := &receivers[i]
+		for j := range donors {
+			d := &donors[j]
+			if r.amount == 0 {
+				break
+			}
+			if !constraints.Allows(d.warehouseID, r.warehouseID) {
+				continue
+			}
+			quantity := min(d.amount, r.amount)
+			if quantity == 0 || quantity < constraints.MinTransferQuantity {
+				continue
+			}
+			proposals = append(proposals, models.TransferProposal{
+				SKU:             sku,
+				FromWarehouseID: d.warehouseID,
+				ToWarehouseID:   r.warehouseID,
+				Quantity:        quantity,
+				FromDaysOfCover: daysOfCover(d.position, d.sold, window),
+				ToDaysOfCover:   daysOfCover(r.position, r.sold, window),
+				Status:          models.TransferProposed,
+			})
+			d.amount -= quantity
+			r.amount -= quantity
+		}
+	}
+	return proposals
+}
+
+// AnalyzeRebalancing recommends transfers between warehouses for every SKU
+// with orders in the replenishment velocity window, replacing the proposals
+// still awaiting a decision. Serialized SKUs are left out, as their units
+// are transferred by serial number.
+func (s *InventoryService) AnalyzeRebalancing(ctx context.Context) (_ []models.TransferProposal, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.AnalyzeRebalancing")
+	defer end(span, &err)
+	window := s.replenishment.WindowDays
+	since := ledgerTime(time.Now().AddDate(0, 0, -window))
+
+	sql := `
+		WITH sales AS (
+			SELECT sku, warehouse_id, -SUM(change)::int AS sold
+			FROM inventory_transactions
+			WHERE type = 'order' AND timestamp >= $1
+			GROUP BY sku, warehouse_id
+		)
+		SELECT sl.sku, sl.warehouse_id, sl.quantity, lot.in_lots, lot.expired, GREATEST(COALESCE(s.sold, 0), 0),
+			COALESCE((
+				SELECT SUM(l.quantity - l.received)
+				FROM purchase_order_lines l
+				JOIN purchase_orders po ON po.id = l.purchase_order_id
+				WHERE l.sku = sl.sku AND l.warehouse_id = sl.warehouse_id
+					AND po.status = 'open' AND l.received < l.quantity
+			), 0)::int
+		FROM stock_levels sl
+		LEFT JOIN sales s ON s.sku = sl.sku AND s.warehouse_id = sl.warehouse_id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(ls.quantity), 0)::int AS in_lots,
+				COALESCE(SUM(ls.quantity) FILTER (WHERE l.expires_on < CURRENT_DATE), 0)::int AS expired
+			FROM lot_stock ls
+			JOIN lots l ON l.id = ls.lot_id
+			WHERE l.sku = sl.sku AND ls.warehouse_id = sl.warehouse_id AND ls.quantity > 0
+		) lot
+		WHERE sl.sku IN (SELECT sku FROM sales WHERE sold > 0)
+			AND NOT EXISTS (SELECT 1 FROM products p WHERE p.sku = sl.sku AND p.serialized)
+		ORDER BY sl.sku, sl.warehouse_id
+	`
+	rows, err := s.db.Query(ctx, sql, since)
+	if err != nil {
+		return nil, err
+	}
+	var skus []string
+	demand := map[string][]warehouseDemand{}
+	for rows.Next() {
+		var sku string
+		var w warehouseDemand
+		var quantity, inLots, expired int
+		if err := rows.Scan(&sku, &w.warehouseID, &quantity, &inLots, &expired, &w.sold, &w.incoming); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w.allocatable = allocatableStock(quantity, inLots, expired)
+		if _, ok := demand[sku]; !ok {
+			skus = append(skus, sku)
+		}
+		demand[sku] = append(demand[sku], w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	proposals := []models.TransferProposal{}
+	for _, sku := range skus {
+		proposals = append(proposals, planRebalancing(sku, demand[sku], s.rebalancing, window)...)
+	}
+
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		// Concurrent analyses would each supersede the other's proposals
+		if err := tx.Exec(ctx, `LOCK TABLE transfer_proposals IN EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+		sql := `
+			UPDATE transfer_proposals
+			SET status = $1, decided_at = now()
+			WHERE status = $2
+		`
+		if err := tx.Exec(ctx, sql, models.TransferSuperseded, models.TransferProposed); err != nil {
+			return err
+		}
+		sql = `
+			INSERT INTO transfer_proposals (sku, from_warehouse_id, to_warehouse_id, quantity, from_days_of_cover, to_days_of_cover, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at
+		`
+		for i := range proposals {
+			p := &proposals[i]
+			args := []interface{}{p.SKU, p.FromWarehouseID, p.ToWarehouseID, p.Quantity, p.FromDaysOfCover, p.ToDaysOfCover, p.Status}
+			if err := queryRow(ctx, tx, sql, args, &p.ID, &p.CreatedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "rebalancing analysed", "skus", len(skus), "proposals", len(proposals))
+	return proposals, nil
+}
+
+// RunRebalancingAnalysis recommends transfers every interval until ctx is
+// done.
+func (s *InventoryService) RunRebalancingAnalysis(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.AnalyzeRebalancing(ctx); err != nil {
+				slog.ErrorContext(ctx, "error analysing rebalancing", "error", err)
+			}
+		}
+	}
+}
+
+// GetTransferProposal returns the transfer proposal with id, or a
+// *NotFoundError.
+func (s *InventoryService) GetTransferProposal(ctx context.Context, id int) (_ models.TransferProposal, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetTransferProposal", attribute.Int("id", id))
+	defer end(span, &err)
+	proposals, err := s.loadTransferProposals(ctx, `WHERE p.id = $1`, []interface{}{id})
+	if err != nil {
+		return models.TransferProposal{}, err
+	}
+	if len(proposals) == 0 {
+		return models.TransferProposal{}, &NotFoundError{Resource: "transfer proposal", ID: strconv.Itoa(id)}
+	}
+	return proposals[0], nil
+}
+
+// ListTransferProposals returns the transfer proposals matching filter,
+// newest first.
+func (s *InventoryService) ListTransferProposals(ctx context.Context, filter models.TransferProposalFilter) (_ []models.TransferProposal, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ListTransferProposals")
+	defer end(span, &err)
+	v := &ValidationError{}
+	v.add(filter.Status == "" || filter.Status == models.TransferProposed || filter.Status == models.TransferApproved ||
+		filter.Status == models.TransferRejected || filter.Status == models.TransferSuperseded,
+		"status", "must be one of proposed, approved, rejected or superseded")
+	v.add(filter.Limit >= 0 && filter.Limit <= MaxTransferProposalListLimit, "limit", fmt.Sprintf("must not exceed %d", MaxTransferProposalListLimit))
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultTransferProposalListLimit
+	}
+
+	where := `
+		WHERE ($1 = '' OR p.status = $1) AND ($2 = '' OR p.sku = $2)
+		ORDER BY p.id DESC
+		LIMIT $3
+	`
+	return s.loadTransferProposals(ctx, where, []interface{}{filter.Status, filter.SKU, filter.Limit})
+}
+
+// loadTransferProposals returns the proposals selected by where, which may
+// also order and limit them.
+func (s *InventoryService) loadTransferProposals(ctx context.Context, where string, args []interface{}) ([]models.TransferProposal, error) {
+	sql := `
+		SELECT p.id, p.sku, p.from_warehouse_id, p.to_warehouse_id, p.quantity, p.from_days_of_cover, p.to_days_of_cover,
+			p.status, p.created_at, p.decided_by, COALESCE(t.id, 0)
+		FROM transfer_proposals p
+		LEFT JOIN transfers t ON t.proposal_id = p.id
+	` + where
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	proposals := []models.TransferProposal{}
+	for rows.Next() {
+		var p models.TransferProposal
+		if err := rows.Scan(&p.ID, &p.SKU, &p.FromWarehouseID, &p.ToWarehouseID, &p.Quantity, &p.FromDaysOfCover, &p.ToDaysOfCover,
+			&p.Status, &p.CreatedAt, &p.DecidedBy, &p.TransferID); err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals, rows.Err()
+}
+
+// lockTransferProposal locks the proposal with id and checks it still
+// awaits a decision.
+func lockTransferProposal(ctx context.Context, tx db.Tx, id int, decision string) (models.TransferProposal, error) {
+	sql := `
+		SELECT sku, from_warehouse_id, to_warehouse_id, quantity, status
+		FROM transfer_proposals
+		WHERE id = $1
+		FOR UPDATE
+	`
+	p := models.TransferProposal{ID: id}
+	if err := queryRow(ctx, tx, sql, []interface{}{id}, &p.SKU, &p.FromWarehouseID, &p.ToWarehouseID, &p.Quantity, &p.Status); err != nil {
+		return p, err
+	}
+	if p.Status == "" {
+		return p, &NotFoundError{Resource: "transfer proposal", ID: strconv.Itoa(id)}
+	}
+	if p.Status != models.TransferProposed {
+		return p, Invalid("status", fmt.Sprintf("proposal is %s and cannot be %s", p.Status, decision))
+	}
+	return p, nil
+}
+
+// ApproveTransferProposal moves the proposed stock from one warehouse to
+// the other. Stock is taken first-expired-first-out and keeps its lots.
+// Each move is recorded in the ledger as a transfer out of one warehouse
+// and into the other.
+func (s *InventoryService) ApproveTransferProposal(ctx context.Context, id int) (_ models.Transfer, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ApproveTransferProposal", attribute.Int("id", id))
+	defer end(span, &err)
+	actor := audit.FromContext(ctx).Actor
+
+	var transfer models.Transfer
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		p, err := lockTransferProposal(ctx, tx, id, models.TransferApproved)
+		if err != nil {
+			return err
+		}
+
+		// Plan the moves before writing so a shortage leaves stock untouched
+		warehouses, err := lockStockLevels(ctx, tx, p.SKU)
+		if err != nil {
+			return err
+		}
+		lots, err := lockLotStock(ctx, tx, p.SKU)
+		if err != nil {
+			return err
+		}
+		var source []warehouseQuantity
+		for _, w := range warehouses {
+			if w.warehouseID == p.FromWarehouseID {
+				source = append(source, w)
+			}
+		}
+		var sourceLots []lotQuantity
+		for _, l := range lots {
+			if l.warehouseID == p.FromWarehouseID {
+				sourceLots = append(sourceLots, l)
+			}
+		}
+		allocations, remaining := planAllocation(p.Quantity, source, sourceLots)
+		if remaining > 0 {
+			return &InsufficientStockError{SKU: p.SKU, Requested: p.Quantity, Available: p.Quantity - remaining}
+		}
+
+		transfer = models.Transfer{
+			ProposalID:      id,
+			SKU:             p.SKU,
+			FromWarehouseID: p.FromWarehouseID,
+			ToWarehouseID:   p.ToWarehouseID,
+			Quantity:        p.Quantity,
+			CreatedBy:       actor,
+		}
+		sql := `
+			INSERT INTO transfers (proposal_id, sku, from_warehouse_id, to_warehouse_id, quantity, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`
+		args := []interface{}{id, p.SKU, p.FromWarehouseID, p.ToWarehouseID, p.Quantity, actor}
+		if err := queryRow(ctx, tx, sql, args, &transfer.ID, &transfer.CreatedAt); err != nil {
+			return err
+		}
+
+		reason := fmt.Sprintf("transfer %d from warehouse %d to warehouse %d", transfer.ID, p.FromWarehouseID, p.ToWarehouseID)
+		for _, a := range allocations {
+			out := models.StockUpdate{
+				SKU:         p.SKU,
+				WarehouseID: p.FromWarehouseID,
+				Quantity:    -a.quantity,
+				LotNumber:   a.lotNumber,
+				Reason:      reason,
+				ReasonCode:  models.ReasonTransfer,
+			}
+			_, value, err := s.applyStockUpdate(ctx, tx, out, "transfer")
+			if err != nil {
+				return err
+			}
+			// The stock arrives at the cost it left at
+			in := out
+			in.WarehouseID = p.ToWarehouseID
+			in.Quantity = a.quantity
+			unitCost := -value / float64(a.quantity)
+			in.UnitCost = &unitCost
+			if _, _, err := s.applyStockUpdate(ctx, tx, in, "transfer"); err != nil {
+				return err
+			}
+		}
+
+		sql = `
+			UPDATE transfer_proposals
+			SET status = $2, decided_by = $3, decided_at = now()
+			WHERE id = $1
+		`
+		return tx.Exec(ctx, sql, id, models.TransferApproved, actor)
+	})
+	if err != nil {
+		return models.Transfer{}, err
+	}
+
+	// Publish events
+	s.publishInventoryEvents(ctx,
+		events.InventoryEvent{SKU: transfer.SKU, WarehouseID: transfer.FromWarehouseID, Change: -transfer.Quantity, Reason: models.ReasonTransfer},
+		events.InventoryEvent{SKU: transfer.SKU, WarehouseID: transfer.ToWarehouseID, Change: transfer.Quantity, Reason: models.ReasonTransfer},
+	)
+	return transfer, s.redis.Publish(ctx, "inventory_updates", transfer)
+}
+
+// RejectTransferProposal declines a proposal awaiting a decision.
+func (s *InventoryService) RejectTransferProposal(ctx context.Context, id int) (_ models.TransferProposal, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.RejectTransferProposal", attribute.Int("id", id))
+	defer end(span, &err)
+
+	err = s.withTx(ctx, func(tx db.Tx) error {
+		if _, err := lockTransferProposal(ctx, tx, id, models.TransferRejected); err != nil {
+			return err
+		}
+		sql := `
+			UPDATE transfer_proposals
+			SET status = $2, decided_by = $3, decided_at = now()
+			WHERE id = $1
+		`
+		return tx.Exec(ctx, sql, id, models.TransferRejected, audit.FromContext(ctx).Actor)
+	})
+	if err != nil {
+		return models.TransferProposal{}, err
+	}
+	return s.GetTransferProposal(ctx, id)
+}
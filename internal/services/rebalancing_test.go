@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func days(d float64) *float64 { return &d }
+
+func TestPlanRebalancing(t *testing.T) {
+	constraints := models.RebalancingConstraints{MinTransferQuantity: 5}
+	warehouses := []warehouseDemand{
+		{warehouseID: 1, allocatable: 90, sold: 28},
+		{warehouseID: 2, allocatable: 5, incoming: 5, sold: 56},
+		{warehouseID: 3, allocatable: 40},
+		{warehouseID: 4, allocatable: 4, sold: 28},
+	}
+
+	// 144 units for 112 sold: a quarter, half and quarter of the stock
+	proposals := planRebalancing("a", warehouses, constraints, 28)
+	assert.Equal(t, []models.TransferProposal{
+		{SKU: "a", FromWarehouseID: 3, ToWarehouseID: 4, Quantity: 32, ToDaysOfCover: days(4), Status: "proposed"},
+		{SKU: "a", FromWarehouseID: 3, ToWarehouseID: 2, Quantity: 8, ToDaysOfCover: days(5), Status: "proposed"},
+		{SKU: "a", FromWarehouseID: 1, ToWarehouseID: 2, Quantity: 54, FromDaysOfCover: days(90), ToDaysOfCover: days(5), Status: "proposed"},
+	}, proposals, "the warehouses with the least cover are served first from the most")
+
+	// Only allowed routes are proposed, and never below the minimum
+	constraints = models.RebalancingConstraints{MinTransferQuantity: 25, Routes: []models.Route{{From: 1, To: 2}, {From: 1, To: 4}, {From: 3, To: 4}}}
+	proposals = planRebalancing("a", warehouses, constraints, 28)
+	assert.Equal(t, []models.TransferProposal{
+		{SKU: "a", FromWarehouseID: 3, ToWarehouseID: 4, Quantity: 32, ToDaysOfCover: days(4), Status: "proposed"},
+		{SKU: "a", FromWarehouseID: 1, ToWarehouseID: 2, Quantity: 54, FromDaysOfCover: days(90), ToDaysOfCover: days(5), Status: "proposed"},
+	}, proposals)
+
+	assert.Empty(t, planRebalancing("a", []warehouseDemand{{warehouseID: 1, allocatable: 50}, {warehouseID: 2}}, constraints, 28), "no demand, nothing to balance")
+}
+
+func TestAnalyzeRebalancing(t *testing.T) {
+	at := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	fdb := newFakeDB()
+	fdb.results["FROM stock_levels sl"] = [][]interface{}{
+		{"a", 1, 100, 0, 0, 28, 0},
+		{"a", 2, 0, 0, 0, 28, 0},
+		{"b", 1, 10, 0, 0, 28, 0},
+	}
+	fdb.results["INSERT INTO transfer_proposals"] = [][]interface{}{{3, at}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	proposals, err := svc.AnalyzeRebalancing(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []models.TransferProposal{
+		{ID: 3, SKU: "a", FromWarehouseID: 1, ToWarehouseID: 2, Quantity: 50, FromDaysOfCover: days(100), ToDaysOfCover: days(0), Status: "proposed", CreatedAt: at},
+	}, proposals)
+	since := fdb.statements("FROM stock_levels sl")[0].args[0].(time.Time)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -28), since, time.Minute, "demand is measured over the replenishment window")
+	assert.Equal(t, time.Local, since.Location(), "ledger timestamps are in local time")
+	assert.Equal(t, []interface{}{"superseded", "proposed"}, fdb.statements("UPDATE transfer_proposals")[0].args)
+	assert.Len(t, fdb.statements("INSERT INTO transfer_proposals"), 1)
+	assert.Equal(t, 1, fdb.commits)
+}
+
+func TestAnalyzeRebalancingExcludesExpiredLots(t *testing.T) {
+	fdb := newFakeDB()
+	// Warehouse 1 holds 100 units, 60 of them in an expired lot
+	fdb.results["FROM stock_levels sl"] = [][]interface{}{
+		{"a", 1, 100, 60, 60, 28, 0},
+		{"a", 2, 0, 0, 0, 28, 0},
+	}
+	fdb.results["INSERT INTO transfer_proposals"] = [][]interface{}{{3, time.Now()}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	proposals, err := svc.AnalyzeRebalancing(context.Background())
+	require.NoError(t, err)
+	require.Len(t, proposals, 1)
+	assert.Equal(t, 20, proposals[0].Quantity, "only the 40 unexpired units are shared")
+	assert.Equal(t, days(40), proposals[0].FromDaysOfCover)
+}
+
+func TestApproveTransferProposal(t *testing.T) {
+	at := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	fdb, fredis, cache := newFakeDB(), &fakeRedis{}, &fakeCache{}
+	fdb.results["SELECT sku, from_warehouse_id"] = [][]interface{}{{"a", 1, 2, 15, "proposed"}}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 20}, {2, 3}}
+	fdb.results["FROM lot_stock ls"] = [][]interface{}{{5, "L1", 1, 10, false}, {6, "L2", 2, 3, false}}
+	fdb.results["INSERT INTO lots"] = [][]interface{}{{5, "", ""}}
+	fdb.results["WHERE lot_id = $1 AND warehouse_id = $2"] = [][]interface{}{{10}}
+	fdb.results["INSERT INTO transfers"] = [][]interface{}{{9, at}}
+	fdb.results["FROM cost_layers"] = [][]interface{}{{3, 20, 50.0}}
+	svc := NewInventoryService(fdb, fredis)
+	svc.SetStockCache(cache)
+
+	transfer, err := svc.ApproveTransferProposal(context.Background(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, models.Transfer{ID: 9, ProposalID: 4, SKU: "a", FromWarehouseID: 1, ToWarehouseID: 2, Quantity: 15, CreatedBy: "anonymous", CreatedAt: at}, transfer)
+
+	var moves [][]interface{}
+	for _, update := range fdb.statements("INSERT INTO stock_levels") {
+		moves = append(moves, update.args)
+	}
+	assert.Equal(t, [][]interface{}{{"a", 1, -10}, {"a", 2, 10}, {"a", 1, -5}, {"a", 2, 5}}, moves, "the lot moves first, then stock outside any lot")
+	ledger := fdb.statements("INSERT INTO inventory_transactions")
+	require.Len(t, ledger, 4)
+	assert.Equal(t, []interface{}{"transfer", 5}, []interface{}{ledger[1].args[3], ledger[1].args[6]})
+	assert.Equal(t, []interface{}{-25.0, 25.0}, []interface{}{ledger[0].args[7], ledger[1].args[7]}, "stock arrives at the cost it left at")
+	assert.Equal(t, 2.5, fdb.statements("INSERT INTO cost_layers")[0].args[3])
+	assert.Equal(t, []interface{}{4, "approved", "anonymous"}, fdb.statements("UPDATE transfer_proposals")[0].args)
+	assert.Equal(t, []string{"a"}, cache.invalidated)
+	assert.Equal(t, transfer, fredis.published[0])
+}
+
+func TestApproveTransferProposalShortage(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT sku, from_warehouse_id"] = [][]interface{}{{"a", 1, 2, 15, "proposed"}}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{2, 30}, {1, 12}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.ApproveTransferProposal(context.Background(), 4)
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, &InsufficientStockError{SKU: "a", Requested: 15, Available: 12}, shortage, "only the source warehouse counts")
+	assert.Empty(t, fdb.statements("INSERT INTO stock_levels"))
+	assert.Equal(t, 1, fdb.rollbacks)
+
+	fdb.results["SELECT sku, from_warehouse_id"] = [][]interface{}{{"a", 1, 2, 15, "superseded"}}
+	_, err = svc.ApproveTransferProposal(context.Background(), 4)
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "status", Message: "proposal is superseded and cannot be approved"}}, invalid.Fields)
+}
+
+func TestRejectTransferProposal(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT sku, from_warehouse_id"] = [][]interface{}{{"a", 1, 2, 15, "proposed"}}
+	fdb.results["FROM transfer_proposals p"] = [][]interface{}{{4, "a", 1, 2, 15, days(30), (*float64)(nil), "rejected", time.Time{}, "", 0}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	proposal, err := svc.RejectTransferProposal(context.Background(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, "rejected", proposal.Status)
+	assert.Nil(t, proposal.ToDaysOfCover)
+	assert.Equal(t, []interface{}{4, "rejected", "anonymous"}, fdb.statements("UPDATE transfer_proposals")[0].args)
+
+	delete(fdb.results, "SELECT sku, from_warehouse_id")
+	_, err = svc.RejectTransferProposal(context.Background(), 4)
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
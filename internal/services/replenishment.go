@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxReplenishmentDays bounds every replenishment setting.
+const maxReplenishmentDays = 365
+
+var defaultReplenishmentSettings = models.ReplenishmentSettings{
+	WindowDays:      28,
+	LeadTimeDays:    7,
+	SafetyStockDays: 7,
+	CoverDays:       30,
+}
+
+// ReplenishmentNotifier delivers the scheduled replenishment report.
+type ReplenishmentNotifier interface {
+	NotifyReplenishment(ctx context.Context, report models.ReplenishmentReport) error
+}
+
+// SetReplenishmentSettings sets the settings reorder suggestions are
+// computed with unless a request overrides them.
+func (s *InventoryService) SetReplenishmentSettings(settings models.ReplenishmentSettings) {
+	s.replenishment = settings
+}
+
+// ReplenishmentSettings returns the default replenishment settings.
+func (s *InventoryService) ReplenishmentSettings() models.ReplenishmentSettings {
+	return s.replenishment
+}
+
+// SetReplenishmentNotifier enables the replenishment report sent by
+// RunReplenishmentReports.
+func (s *InventoryService) SetReplenishmentNotifier(notifier ReplenishmentNotifier) {
+	s.replenishmentNotifier = notifier
+}
+
+func validateReplenishmentSettings(settings models.ReplenishmentSettings) error {
+	v := &ValidationError{}
+	inRange := func(days, low int) bool { return days >= low && days <= maxReplenishmentDays }
+	v.add(inRange(settings.WindowDays, 1), "window_days", fmt.Sprintf("must be between 1 and %d", maxReplenishmentDays))
+	v.add(inRange(settings.LeadTimeDays, 0), "lead_time_days", fmt.Sprintf("must be between 0 and %d", maxReplenishmentDays))
+	v.add(inRange(settings.SafetyStockDays, 0), "safety_stock_days", fmt.Sprintf("must be between 0 and %d", maxReplenishmentDays))
+	v.add(inRange(settings.CoverDays, 0), "cover_days", fmt.Sprintf("must be between 0 and %d", maxReplenishmentDays))
+	return v.err()
+}
+
+// GetReplenishment computes the sales velocity, days of cover and reorder
+// suggestion of every SKU and warehouse with orders in the velocity window.
+func (s *InventoryService) GetReplenishment(ctx context.Context, filter models.ReplenishmentFilter) (_ models.ReplenishmentReport, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetReplenishment",
+		attribute.String("sku", filter.SKU), attribute.Int("warehouse_id", filter.WarehouseID))
+	defer end(span, &err)
+	settings := filter.Settings
+	if err := validateReplenishmentSettings(settings); err != nil {
+		return models.ReplenishmentReport{}, err
+	}
+	if filter.WarehouseID < 0 {
+		return models.ReplenishmentReport{}, Invalid("warehouse_id", "must be a positive integer")
+	}
+
+	since := ledgerTime(time.Now().AddDate(0, 0, -settings.WindowDays))
+	conditions := []string{"s.sold > 0"}
+	args := []interface{}{since}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+	if filter.SKU != "" {
+		addCondition("s.sku = $%d", filter.SKU)
+	}
+	if filter.WarehouseID > 0 {
+		addCondition("s.warehouse_id = $%d", filter.WarehouseID)
+	}
+
+	// Orders are recorded as negative changes, so sales are their negation.
+	// Expired lots cannot be sold, so they do not count as stock on hand.
+	sql := `
+		WITH sales AS (
+			SELECT sku, warehouse_id, -SUM(change)::int AS sold
+			FROM inventory_transactions
+			WHERE type = 'order' AND timestamp >= $1
+			GROUP BY sku, warehouse_id
+		)
+		SELECT s.sku, s.warehouse_id, COALESCE(w.name, ''), COALESCE(sl.quantity, 0), lot.in_lots, lot.expired, s.sold,
+			COALESCE((
+				SELECT SUM(l.quantity - l.received)
+				FROM purchase_order_lines l
+				JOIN purchase_orders po ON po.id = l.purchase_order_id
+				WHERE l.sku = s.sku AND l.warehouse_id = s.warehouse_id
+					AND po.status = 'open' AND l.received < l.quantity
+			), 0)::int
+		FROM sales s
+		LEFT JOIN warehouses w ON w.id = s.warehouse_id
+		LEFT JOIN stock_levels sl ON sl.sku = s.sku AND sl.warehouse_id = s.warehouse_id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(ls.quantity), 0)::int AS in_lots,
+				COALESCE(SUM(ls.quantity) FILTER (WHERE l.expires_on < CURRENT_DATE), 0)::int AS expired
+			FROM lot_stock ls
+			JOIN lots l ON l.id = ls.lot_id
+			WHERE l.sku = s.sku AND ls.warehouse_id = s.warehouse_id AND ls.quantity > 0
+		) lot
+		WHERE ` + strings.Join(conditions, " AND ")
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return models.ReplenishmentReport{}, err
+	}
+	defer rows.Close()
+
+	report := models.ReplenishmentReport{GeneratedAt: time.Now().UTC(), Settings: settings, Suggestions: []models.ReplenishmentSuggestion{}}
+	for rows.Next() {
+		var r models.ReplenishmentSuggestion
+		var quantity, inLots, expired int
+		if err := rows.Scan(&r.SKU, &r.WarehouseID, &r.Name, &quantity, &inLots, &expired, &r.Sold, &r.Incoming); err != nil {
+			return models.ReplenishmentReport{}, err
+		}
+		r.OnHand = allocatableStock(quantity, inLots, expired)
+		r = suggestReplenishment(r, settings)
+		if filter.ReorderOnly && r.SuggestedQuantity == 0 {
+			continue
+		}
+		report.Suggestions = append(report.Suggestions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return models.ReplenishmentReport{}, err
+	}
+
+	sort.Slice(report.Suggestions, func(i, j int) bool {
+		a, b := report.Suggestions[i], report.Suggestions[j]
+		if a.DaysOfCover != b.DaysOfCover {
+			return a.DaysOfCover < b.DaysOfCover
+		}
+		if a.SKU != b.SKU {
+			return a.SKU < b.SKU
+		}
+		return a.WarehouseID < b.WarehouseID
+	})
+	return report, nil
+}
+
+// suggestReplenishment fills in the velocity, cover and reorder quantity of
+// r from the units sold in the window. Stock is reordered once on hand and
+// incoming stock no longer covers the lead time and safety stock, up to
+// that level plus the cover days.
+func suggestReplenishment(r models.ReplenishmentSuggestion, settings models.ReplenishmentSettings) models.ReplenishmentSuggestion {
+	window := settings.WindowDays
+	// Whole units needed to cover days of sales, rounded up
+	unitsFor := func(days int) int { return (r.Sold*days + window - 1) / window }
+
+	onHand := max(r.OnHand, 0)
+	r.DailyVelocity = math.Round(float64(r.Sold)/float64(window)*100) / 100
+	r.DaysOfCover = math.Round(float64(onHand*window)/float64(r.Sold)*10) / 10
+	r.ReorderPoint = unitsFor(settings.LeadTimeDays + settings.SafetyStockDays)
+	if position := onHand + r.Incoming; position <= r.ReorderPoint {
+		r.SuggestedQuantity = max(unitsFor(settings.LeadTimeDays+settings.SafetyStockDays+settings.CoverDays)-position, 0)
+	}
+	return r
+}
+
+// SendReplenishmentReport sends the SKUs and warehouses that should be
+// reordered now through the replenishment notifier, and returns how many
+// were reported. The run is claimed first so that each run is reported
+// by one instance; a run whose report cannot be queued is released.
+func (s *InventoryService) SendReplenishmentReport(ctx context.Context, at time.Time) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.SendReplenishmentReport")
+	defer end(span, &err)
+	if s.replenishmentNotifier == nil {
+		return 0, nil
+	}
+	at = at.UTC()
+
+	rows, err := s.db.Query(ctx, `
+		INSERT INTO replenishment_report_runs (run_at)
+		VALUES ($1)
+		ON CONFLICT (run_at) DO NOTHING
+		RETURNING run_at
+	`, at)
+	if err != nil {
+		return 0, err
+	}
+	claimed := rows.Next()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if !claimed {
+		return 0, nil
+	}
+
+	release := func() {
+		if err := s.db.Exec(ctx, `DELETE FROM replenishment_report_runs WHERE run_at = $1`, at); err != nil {
+			slog.ErrorContext(ctx, "error releasing replenishment report run", "error", err)
+		}
+	}
+	report, err := s.GetReplenishment(ctx, models.ReplenishmentFilter{ReorderOnly: true, Settings: s.replenishment})
+	if err != nil {
+		release()
+		return 0, err
+	}
+	if len(report.Suggestions) == 0 {
+		return 0, nil
+	}
+	if err := s.replenishmentNotifier.NotifyReplenishment(ctx, report); err != nil {
+		release()
+		return 0, err
+	}
+	slog.InfoContext(ctx, "replenishment report sent", "suggestions", len(report.Suggestions))
+	metrics.ReplenishmentReports.Inc()
+	return len(report.Suggestions), nil
+}
+
+// RunReplenishmentReports sends the replenishment report every interval
+// until ctx is done.
+func (s *InventoryService) RunReplenishmentReports(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.SendReplenishmentReport(ctx, now.Truncate(interval)); err != nil {
+				slog.ErrorContext(ctx, "error sending replenishment report", "error", err)
+			}
+		}
+	}
+}
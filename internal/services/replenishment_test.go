@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestReplenishment(t *testing.T) {
+	settings := models.ReplenishmentSettings{WindowDays: 28, LeadTimeDays: 7, SafetyStockDays: 3, CoverDays: 14}
+
+	// 2 a day: reorder at 20 units, up to 48
+	r := suggestReplenishment(models.ReplenishmentSuggestion{OnHand: 12, Incoming: 5, Sold: 56}, settings)
+	assert.Equal(t, models.ReplenishmentSuggestion{OnHand: 12, Incoming: 5, Sold: 56, DailyVelocity: 2, DaysOfCover: 6, ReorderPoint: 20, SuggestedQuantity: 31}, r)
+
+	// Incoming stock defers the reorder
+	r = suggestReplenishment(models.ReplenishmentSuggestion{OnHand: 12, Incoming: 20, Sold: 56}, settings)
+	assert.Equal(t, 0, r.SuggestedQuantity)
+
+	// Quantities round up to whole units and oversold stock counts as none
+	r = suggestReplenishment(models.ReplenishmentSuggestion{OnHand: -3, Sold: 10}, settings)
+	assert.Equal(t, 0.36, r.DailyVelocity)
+	assert.Equal(t, 0.0, r.DaysOfCover)
+	assert.Equal(t, 4, r.ReorderPoint)
+	assert.Equal(t, 9, r.SuggestedQuantity)
+}
+
+func TestGetReplenishment(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["WITH sales AS"] = [][]interface{}{
+		{"a", 1, "Main", 100, 0, 0, 28, 0},
+		{"b", 2, "East", 3, 0, 0, 56, 0},
+		{"a", 2, "East", 10, 0, 0, 28, 40},
+	}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	report, err := svc.GetReplenishment(context.Background(), models.ReplenishmentFilter{Settings: defaultReplenishmentSettings})
+	require.NoError(t, err)
+	var order []string
+	for _, r := range report.Suggestions {
+		order = append(order, r.SKU+"/"+r.Name)
+	}
+	assert.Equal(t, []string{"b/East", "a/East", "a/Main"}, order, "fewest days of cover first")
+
+	report, err = svc.GetReplenishment(context.Background(), models.ReplenishmentFilter{ReorderOnly: true, Settings: defaultReplenishmentSettings})
+	require.NoError(t, err)
+	assert.Equal(t, []models.ReplenishmentSuggestion{{SKU: "b", WarehouseID: 2, Name: "East", OnHand: 3, Sold: 56, DailyVelocity: 2, DaysOfCover: 1.5, ReorderPoint: 28, SuggestedQuantity: 85}}, report.Suggestions)
+
+	_, err = svc.GetReplenishment(context.Background(), models.ReplenishmentFilter{SKU: "a", WarehouseID: 2, Settings: defaultReplenishmentSettings})
+	require.NoError(t, err)
+	args := fdb.statements("WITH sales AS")[2].args
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -28), args[0].(time.Time), time.Minute, "sales are counted from the start of the window")
+	assert.Equal(t, time.Local, args[0].(time.Time).Location(), "ledger timestamps are in local time")
+	assert.Equal(t, []interface{}{"a", 2}, args[1:])
+
+	_, err = svc.GetReplenishment(context.Background(), models.ReplenishmentFilter{Settings: models.ReplenishmentSettings{LeadTimeDays: -1}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{
+		{Field: "window_days", Message: "must be between 1 and 365"},
+		{Field: "lead_time_days", Message: "must be between 0 and 365"},
+	}, invalid.Fields)
+}
+
+func TestGetReplenishmentExcludesExpiredLots(t *testing.T) {
+	fdb := newFakeDB()
+	// 100 units held, 90 of them in lots of which 80 have expired
+	fdb.results["WITH sales AS"] = [][]interface{}{{"a", 1, "Main", 100, 90, 80, 56, 0}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	report, err := svc.GetReplenishment(context.Background(), models.ReplenishmentFilter{ReorderOnly: true, Settings: defaultReplenishmentSettings})
+	require.NoError(t, err)
+	require.Len(t, report.Suggestions, 1, "expired stock does not cover sales")
+	assert.Equal(t, 20, report.Suggestions[0].OnHand)
+	assert.Equal(t, 10.0, report.Suggestions[0].DaysOfCover)
+}
+
+type fakeReplenishmentNotifier struct {
+	reports []models.ReplenishmentReport
+	err     error
+}
+
+func (f *fakeReplenishmentNotifier) NotifyReplenishment(ctx context.Context, report models.ReplenishmentReport) error {
+	f.reports = append(f.reports, report)
+	return f.err
+}
+
+func TestSendReplenishmentReport(t *testing.T) {
+	at := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	fdb, notifier := newFakeDB(), &fakeReplenishmentNotifier{}
+	fdb.results["INSERT INTO replenishment_report_runs"] = [][]interface{}{{at}}
+	fdb.results["WITH sales AS"] = [][]interface{}{{"a", 1, "Main", 100, 0, 0, 28, 0}, {"b", 2, "East", 3, 0, 0, 56, 0}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetReplenishmentNotifier(notifier)
+
+	sent, err := svc.SendReplenishmentReport(context.Background(), at)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent, "only SKUs to reorder are reported")
+	require.Len(t, notifier.reports, 1)
+	assert.Equal(t, "b", notifier.reports[0].Suggestions[0].SKU)
+	assert.Equal(t, []interface{}{at}, fdb.statements("INSERT INTO replenishment_report_runs")[0].args)
+
+	// A failed delivery releases the run for another attempt
+	notifier.err = errors.New("queue full")
+	_, err = svc.SendReplenishmentReport(context.Background(), at)
+	assert.Error(t, err)
+	assert.Len(t, fdb.statements("DELETE FROM replenishment_report_runs"), 1)
+
+	// A run claimed by another instance is not reported again
+	delete(fdb.results, "INSERT INTO replenishment_report_runs")
+	sent, err = svc.SendReplenishmentReport(context.Background(), at)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Len(t, notifier.reports, 2)
+}
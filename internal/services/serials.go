@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// serialUnit is a locked serial taken by an order.
+type serialUnit struct {
+	id     int
+	number string
+}
+
+// validateSerialNumbers reports serial numbers that are empty, too long or
+// repeated, and a count that does not match quantity.
+func validateSerialNumbers(v *ValidationError, serials []string, quantity int) {
+	if len(serials) == 0 {
+		return
+	}
+	seen := map[string]bool{}
+	valid := true
+	for _, serial := range serials {
+		valid = valid && serial != "" && len(serial) <= 100 && !seen[serial]
+		seen[serial] = true
+	}
+	v.add(valid, "serial_numbers", "must be distinct, non-empty and at most 100 characters each")
+	v.add(len(serials) == quantity, "serial_numbers", "must list one serial number per unit of quantity")
+}
+
+// checkSerialMode rejects serial numbers for SKUs that are not serialized
+// and requires them for SKUs that are.
+func checkSerialMode(serialized bool, serials []string, lotNumber string) error {
+	if !serialized {
+		if len(serials) > 0 {
+			return Invalid("serial_numbers", "are only accepted for serialized SKUs")
+		}
+		return nil
+	}
+	v := &ValidationError{}
+	v.add(len(serials) > 0, "serial_numbers", "are required for serialized SKUs")
+	v.add(lotNumber == "", "lot_number", "is not supported for serialized SKUs")
+	return v.err()
+}
+
+// moveSerials registers the serials of a stock update in its warehouse, or
+// removes them from it, and links them to the ledger entry. Serials that
+// were sold or removed earlier are returned to stock.
+func moveSerials(ctx context.Context, tx db.Tx, update models.StockUpdate, txID int) error {
+	ids := make([]int, 0, len(update.SerialNumbers))
+	for _, serial := range update.SerialNumbers {
+		var sql, problem string
+		if update.Quantity > 0 {
+			sql = `
+				INSERT INTO serials (sku, serial_number, status, warehouse_id)
+				VALUES ($1, $2, 'in_stock', $3)
+				ON CONFLICT (sku, serial_number) DO UPDATE
+				SET status = 'in_stock', warehouse_id = EXCLUDED.warehouse_id
+				WHERE serials.status <> 'in_stock'
+				RETURNING id
+			`
+			problem = fmt.Sprintf("%s is already in stock", serial)
+		} else {
+			sql = `
+				UPDATE serials
+				SET status = 'removed', warehouse_id = NULL
+				WHERE sku = $1 AND serial_number = $2 AND status = 'in_stock' AND warehouse_id = $3
+				RETURNING id
+			`
+			problem = fmt.Sprintf("%s is not in stock in warehouse %d", serial, update.WarehouseID)
+		}
+		var id int
+		if err := queryRow(ctx, tx, sql, []interface{}{update.SKU, serial, update.WarehouseID}, &id); err != nil {
+			return err
+		}
+		if id == 0 {
+			return Invalid("serial_numbers", problem)
+		}
+		ids = append(ids, id)
+	}
+	return recordSerialMovements(ctx, tx, ids, txID)
+}
+
+func recordSerialMovements(ctx context.Context, tx db.Tx, ids []int, txID int) error {
+	sql := `
+		INSERT INTO serial_movements (serial_id, transaction_id)
+		SELECT unnest($1::int[]), $2
+	`
+	return tx.Exec(ctx, sql, ids, txID)
+}
+
+// lockSerials locks the named in-stock serials of sku and returns them by
+// warehouse. Every serial must be in stock.
+func lockSerials(ctx context.Context, tx db.Tx, sku string, serials []string) (map[int][]serialUnit, error) {
+	sql := `
+		SELECT id, serial_number, warehouse_id
+		FROM serials
+		WHERE sku = $1 AND serial_number = ANY($2) AND status = 'in_stock'
+		ORDER BY warehouse_id, id
+		FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, sql, sku, serials)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byWarehouse := map[int][]serialUnit{}
+	found := map[string]bool{}
+	for rows.Next() {
+		var unit serialUnit
+		var warehouseID int
+		if err := rows.Scan(&unit.id, &unit.number, &warehouseID); err != nil {
+			return nil, err
+		}
+		byWarehouse[warehouseID] = append(byWarehouse[warehouseID], unit)
+		found[unit.number] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, serial := range serials {
+		if !found[serial] {
+			return nil, Invalid("serial_numbers", fmt.Sprintf("%s is not in stock", serial))
+		}
+	}
+	return byWarehouse, nil
+}
+
+// pickSerials locks the quantity longest-held in-stock serials of sku in a
+// warehouse.
+func pickSerials(ctx context.Context, tx db.Tx, sku string, warehouseID, quantity int) ([]serialUnit, error) {
+	sql := `
+		SELECT id, serial_number
+		FROM serials
+		WHERE sku = $1 AND warehouse_id = $2 AND status = 'in_stock'
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, sql, sku, warehouseID, quantity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []serialUnit
+	for rows.Next() {
+		var unit serialUnit
+		if err := rows.Scan(&unit.id, &unit.number); err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	return units, rows.Err()
+}
+
+// sellSerials marks the serials of an allocation sold and links them to its
+// ledger entry.
+func sellSerials(ctx context.Context, tx db.Tx, units []serialUnit, txID int) error {
+	ids := make([]int, len(units))
+	for i, unit := range units {
+		ids[i] = unit.id
+	}
+	sql := `
+		UPDATE serials
+		SET status = 'sold', warehouse_id = NULL
+		WHERE id = ANY($1)
+	`
+	if err := tx.Exec(ctx, sql, ids); err != nil {
+		return err
+	}
+	return recordSerialMovements(ctx, tx, ids, txID)
+}
+
+// TraceSerial returns every unit with serialNumber, with its current status
+// and location and every movement recorded for it, oldest first. It returns
+// a *NotFoundError if no unit has the serial number.
+func (s *InventoryService) TraceSerial(ctx context.Context, serialNumber string) (_ []models.SerialUnit, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.TraceSerial", attribute.String("serial_number", serialNumber))
+	defer end(span, &err)
+	sql := `
+		SELECT s.id, s.sku, s.serial_number, s.status, COALESCE(s.warehouse_id, 0), COALESCE(w.name, '')
+		FROM serials s
+		LEFT JOIN warehouses w ON w.id = s.warehouse_id
+		WHERE s.serial_number = $1
+		ORDER BY s.sku
+	`
+	rows, err := s.db.Query(ctx, sql, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	var units []models.SerialUnit
+	var ids []int
+	index := map[int]int{}
+	for rows.Next() {
+		var id int
+		unit := models.SerialUnit{Movements: []models.SerialMovement{}}
+		if err := rows.Scan(&id, &unit.SKU, &unit.SerialNumber, &unit.Status, &unit.WarehouseID, &unit.WarehouseName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[id] = len(units)
+		ids = append(ids, id)
+		units = append(units, unit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(units) == 0 {
+		return nil, &NotFoundError{Resource: "serial", ID: serialNumber}
+	}
+
+	sql = `
+		SELECT m.serial_id, t.id, t.warehouse_id, SIGN(t.change)::int, t.type, COALESCE(t.channel, ''), t.timestamp
+		FROM serial_movements m
+		JOIN inventory_transactions t ON t.id = m.transaction_id
+		WHERE m.serial_id = ANY($1)
+		ORDER BY t.timestamp, t.id
+	`
+	rows, err = s.db.Query(ctx, sql, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var m models.SerialMovement
+		if err := rows.Scan(&id, &m.TransactionID, &m.WarehouseID, &m.Change, &m.Type, &m.Channel, &m.Timestamp); err != nil {
+			return nil, err
+		}
+		unit := &units[index[id]]
+		unit.Movements = append(unit.Movements, m)
+	}
+	return units, rows.Err()
+}
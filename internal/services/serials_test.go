@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serializedDB returns a fakeDB on which "test" is a serialized SKU.
+func serializedDB() *fakeDB {
+	fdb := newFakeDB()
+	fdb.results["FROM products WHERE sku = $1 FOR SHARE"] = [][]interface{}{{true}}
+	return fdb
+}
+
+func TestAddOrUpdateStockRegistersSerials(t *testing.T) {
+	fdb := serializedDB()
+	fdb.results["INSERT INTO serials"] = [][]interface{}{{11}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 2, SerialNumbers: []string{"S1", "S2"}})
+	require.NoError(t, err)
+	assert.Len(t, fdb.statements("INSERT INTO serials"), 2)
+	assert.Len(t, fdb.statements("INSERT INTO serial_movements"), 1)
+}
+
+func TestAddOrUpdateStockSerialRules(t *testing.T) {
+	fdb := serializedDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	var invalid *ValidationError
+
+	// The serial is already in stock, so the upsert claims no row
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1, SerialNumbers: []string{"S1"}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "serial_numbers", Message: "S1 is already in stock"}}, invalid.Fields)
+
+	err = svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "serial_numbers", invalid.Fields[0].Field)
+
+	err = svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -1, SerialNumbers: []string{"S1"}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "serial_numbers", Message: "S1 is not in stock in warehouse 1"}}, invalid.Fields)
+	assert.Equal(t, 3, fdb.rollbacks)
+
+	// Serial numbers are only accepted for serialized SKUs
+	err = NewInventoryService(newFakeDB(), &fakeRedis{}).AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1, SerialNumbers: []string{"S1"}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "serial_numbers", invalid.Fields[0].Field)
+}
+
+func TestValidateStockUpdateSerialNumbers(t *testing.T) {
+	err := validateStockUpdate(models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -3, SerialNumbers: []string{"S1", "S1"}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{
+		{Field: "serial_numbers", Message: "must be distinct, non-empty and at most 100 characters each"},
+		{Field: "serial_numbers", Message: "must list one serial number per unit of quantity"},
+	}, invalid.Fields)
+}
+
+func TestSimulateOrderSellsNamedSerials(t *testing.T) {
+	fdb := serializedDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 3}, {2, 2}}
+	fdb.results["serial_number = ANY($2)"] = [][]interface{}{{12, "S2", 1}, {11, "S1", 2}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 2, SerialNumbers: []string{"S1", "S2"}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Allocation{
+		{WarehouseID: 1, Quantity: 1, SerialNumbers: []string{"S2"}},
+		{WarehouseID: 2, Quantity: 1, SerialNumbers: []string{"S1"}},
+	}, allocations)
+	sold := fdb.statements("SET status = 'sold'")
+	require.Len(t, sold, 2)
+	assert.Equal(t, []interface{}{[]int{12}}, sold[0].args)
+	assert.Empty(t, fdb.statements("FROM lot_stock"), "serialized SKUs are not lotted")
+}
+
+func TestSimulateOrderNamedSerialNotInStock(t *testing.T) {
+	fdb := serializedDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 3}}
+	fdb.results["serial_number = ANY($2)"] = [][]interface{}{{11, "S1", 1}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 2, SerialNumbers: []string{"S1", "S2"}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "serial_numbers", Message: "S2 is not in stock"}}, invalid.Fields)
+	assert.Empty(t, fdb.statements("UPDATE stock_levels"))
+}
+
+func TestSimulateOrderPicksSerials(t *testing.T) {
+	fdb := serializedDB()
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 3}}
+	fdb.results["AND warehouse_id = $2 AND status"] = [][]interface{}{{11, "S1"}, {12, "S2"}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Allocation{{WarehouseID: 1, Quantity: 2, SerialNumbers: []string{"S1", "S2"}}}, allocations)
+
+	// The serial registry holds fewer units than the stock level
+	_, err = svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 3})
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, 2, shortage.Available)
+}
+
+func TestTraceSerial(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fdb := newFakeDB()
+	fdb.results["FROM serials s"] = [][]interface{}{{11, "test", "S1", models.SerialSold, 0, ""}}
+	fdb.results["FROM serial_movements m"] = [][]interface{}{
+		{11, 100, 1, 1, "stock_update", "", at},
+		{11, 101, 1, -1, "order", "amazon", at.Add(time.Hour)},
+	}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	units, err := svc.TraceSerial(context.Background(), "S1")
+	require.NoError(t, err)
+	require.Len(t, units, 1)
+	assert.Equal(t, models.SerialSold, units[0].Status)
+	assert.Equal(t, []models.SerialMovement{
+		{TransactionID: 100, WarehouseID: 1, Change: 1, Type: "stock_update", Timestamp: at},
+		{TransactionID: 101, WarehouseID: 1, Change: -1, Type: "order", Channel: "amazon", Timestamp: at.Add(time.Hour)},
+	}, units[0].Movements)
+
+	delete(fdb.results, "FROM serials s")
+	_, err = svc.TraceSerial(context.Background(), "S1")
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
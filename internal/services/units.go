@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// unitPattern matches unit of measure names such as inner_pack or case.
+var unitPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// maxUnitFactor bounds conversion factors so that converted quantities
+// stay within the range of the database columns.
+const maxUnitFactor = 1000000
+
+// validateUnits reports unit names that are malformed or repeated and
+// factors out of range. The base unit may be listed with a factor of 1.
+func validateUnits(v *ValidationError, units []models.UnitOfMeasure) {
+	seen := map[string]bool{}
+	for _, u := range units {
+		switch {
+		case !unitPattern.MatchString(u.Unit):
+			v.add(false, "units", fmt.Sprintf("%q must be at most 20 lowercase letters, digits and underscores, starting with a letter", u.Unit))
+		case seen[u.Unit]:
+			v.add(false, "units", fmt.Sprintf("%s is listed more than once", u.Unit))
+		case u.Unit == models.BaseUnit:
+			v.add(u.Factor == 1, "units", fmt.Sprintf("%s is the base unit and must have a factor of 1", u.Unit))
+		default:
+			v.add(u.Factor >= 1 && u.Factor <= maxUnitFactor, "units", fmt.Sprintf("%s must have a factor between 1 and %d", u.Unit, maxUnitFactor))
+		}
+		seen[u.Unit] = true
+	}
+}
+
+// unitFactors returns the number of base units in unit for each of skus.
+// It returns a *ValidationError naming the first SKU that does not define
+// unit.
+func (s *InventoryService) unitFactors(ctx context.Context, skus []string, unit string) (map[string]int, error) {
+	factors := make(map[string]int, len(skus))
+	if models.IsBaseUnit(unit) {
+		for _, sku := range skus {
+			factors[sku] = 1
+		}
+		return factors, nil
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT sku, factor FROM product_units WHERE sku = ANY($1) AND unit = $2`, skus, unit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sku string
+		var factor int
+		if err := rows.Scan(&sku, &factor); err != nil {
+			return nil, err
+		}
+		factors[sku] = factor
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, sku := range skus {
+		if factors[sku] == 0 {
+			return nil, Invalid("unit", fmt.Sprintf("%s is not a unit of measure of %s", unit, sku))
+		}
+	}
+	return factors, nil
+}
+
+// toBaseUnits converts a quantity of sku given in unit to base units.
+func (s *InventoryService) toBaseUnits(ctx context.Context, sku, unit string, quantity int) (int, error) {
+	factors, err := s.unitFactors(ctx, []string{sku}, unit)
+	if err != nil {
+		return 0, err
+	}
+	base := int64(quantity) * int64(factors[sku])
+	if base > math.MaxInt32 || base < math.MinInt32 {
+		return 0, Invalid("quantity", "is too large")
+	}
+	return int(base), nil
+}
+
+// StockSummariesInUnit restates summaries in unit. It returns a
+// *ValidationError if a SKU does not define the unit.
+func (s *InventoryService) StockSummariesInUnit(ctx context.Context, summaries []models.StockSummary, unit string) (_ []models.UnitStockSummary, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.StockSummariesInUnit", attribute.String("unit", unit))
+	defer end(span, &err)
+
+	skus := make([]string, len(summaries))
+	for i, summary := range summaries {
+		skus[i] = summary.SKU
+	}
+	factors, err := s.unitFactors(ctx, skus, unit)
+	if err != nil {
+		return nil, err
+	}
+	if models.IsBaseUnit(unit) {
+		unit = models.BaseUnit
+	}
+
+	converted := make([]models.UnitStockSummary, len(summaries))
+	for i, summary := range summaries {
+		converted[i] = summary.InUnit(unit, factors[summary.SKU])
+	}
+	return converted, nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddOrUpdateStockConvertsUnits(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM product_units"] = [][]interface{}{{"test", 24}}
+	fredis := &fakeRedis{}
+	svc := NewInventoryService(fdb, fredis)
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 2, Unit: "case"})
+	require.NoError(t, err)
+	assert.Equal(t, 48, fdb.statements("INSERT INTO stock_levels")[0].args[2])
+	assert.Equal(t, 48, fdb.statements("INSERT INTO inventory_transactions")[0].args[2])
+	assert.Equal(t, models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 48, ReasonCode: models.ReasonAdjustment}, fredis.published[0], "published in base units")
+
+	delete(fdb.results, "FROM product_units")
+	err = svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1, Unit: "pallet"})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "unit", Message: "pallet is not a unit of measure of test"}}, invalid.Fields)
+}
+
+func TestSimulateOrderConvertsUnits(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM product_units"] = [][]interface{}{{"test", 6}}
+	fdb.results["FROM stock_levels"] = [][]interface{}{{1, 20}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 3, Unit: "inner_pack"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Allocation{{WarehouseID: 1, Quantity: 18}}, allocations)
+
+	// Shortages are reported in base units
+	_, err = svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 4, Unit: "inner_pack"})
+	var shortage *InsufficientStockError
+	require.ErrorAs(t, err, &shortage)
+	assert.Equal(t, &InsufficientStockError{SKU: "test", Requested: 24, Available: 20}, shortage)
+}
+
+func TestValidateStockUpdateSerialsNeedBaseUnits(t *testing.T) {
+	err := validateStockUpdate(models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 1, Unit: "case", SerialNumbers: []string{"S1"}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "unit", Message: "must be each when serial numbers are given"}}, invalid.Fields)
+}
+
+func TestValidateUnits(t *testing.T) {
+	v := &ValidationError{}
+	validateUnits(v, []models.UnitOfMeasure{
+		{Unit: "each", Factor: 2},
+		{Unit: "Case", Factor: 24},
+		{Unit: "case", Factor: 0},
+		{Unit: "pallet", Factor: 960},
+		{Unit: "pallet", Factor: 960},
+	})
+	assert.Equal(t, []FieldError{
+		{Field: "units", Message: "each is the base unit and must have a factor of 1"},
+		{Field: "units", Message: `"Case" must be at most 20 lowercase letters, digits and underscores, starting with a letter`},
+		{Field: "units", Message: "case must have a factor between 1 and 1000000"},
+		{Field: "units", Message: "pallet is listed more than once"},
+	}, v.Fields)
+}
+
+func TestSaveProductReplacesUnits(t *testing.T) {
+	fdb := newFakeDB()
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	product, err := svc.SaveProduct(context.Background(), models.Product{SKU: "test", Name: "Soda", Units: []models.UnitOfMeasure{
+		{Unit: "case", Factor: 24},
+		{Unit: "each", Factor: 1},
+		{Unit: "inner_pack", Factor: 6},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.UnitOfMeasure{{Unit: "each", Factor: 1}, {Unit: "inner_pack", Factor: 6}, {Unit: "case", Factor: 24}}, product.Units)
+	assert.Len(t, fdb.statements("DELETE FROM product_units"), 1)
+	inserts := fdb.statements("INSERT INTO product_units")
+	require.Len(t, inserts, 1)
+	assert.Equal(t, []interface{}{"test", []string{"inner_pack", "case"}, []int{6, 24}}, inserts[0].args)
+}
+
+func TestStockSummariesInUnit(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM product_units"] = [][]interface{}{{"a", 24}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	summary := models.StockSummary{SKU: "a", OnHand: 30, Available: 24, Warehouses: []models.WarehouseStock{{WarehouseID: 1, OnHand: 30, Available: 24}}}
+
+	converted, err := svc.StockSummariesInUnit(context.Background(), []models.StockSummary{summary}, "case")
+	require.NoError(t, err)
+	assert.Equal(t, []models.UnitStockSummary{{
+		SKU: "a", Unit: "case", Factor: 24, OnHand: 1.25, Available: 1,
+		Warehouses: []models.UnitWarehouseStock{{WarehouseID: 1, OnHand: 1.25, Available: 1}},
+	}}, converted)
+
+	_, err = svc.StockSummariesInUnit(context.Background(), []models.StockSummary{summary, {SKU: "b"}}, "case")
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "case is not a unit of measure of b", invalid.Fields[0].Message)
+}
+
+func TestListStockInUnit(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["COALESCE(p.name"] = [][]interface{}{{"a", "", 1, "", "", 36, 24}, {"b", "", 1, "", "", 5, 0}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	page, err := svc.ListStock(context.Background(), models.StockFilter{Unit: "case", MinQuantity: new(int)})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "case", page.Items[0].Unit)
+	assert.Equal(t, 1.5, *page.Items[0].UnitQuantity)
+	assert.Nil(t, page.Items[1].UnitQuantity, "b does not define cases")
+
+	count := fdb.queries[0]
+	assert.Contains(t, count.sql, "LEFT JOIN product_units pu ON pu.sku = sl.sku AND pu.unit = $1 WHERE sl.quantity >= $2")
+	assert.Equal(t, []interface{}{"case", 0}, count.args)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SetValuationMethod sets how issued stock is costed, models.ValuationFIFO
+// or models.ValuationAverage.
+func (s *InventoryService) SetValuationMethod(method string) {
+	s.valuationMethod = method
+}
+
+// roundCost rounds a value to the four decimal places costs are stored with.
+func roundCost(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
+
+// costPerBaseUnit converts a unit cost given per unit of quantity to a cost
+// per base unit, once quantity has been converted to base units.
+func costPerBaseUnit(cost *float64, quantity, base int) *float64 {
+	if cost == nil || quantity == base {
+		return cost
+	}
+	perBase := *cost * float64(quantity) / float64(base)
+	return &perBase
+}
+
+// costLayer is the part of a cost layer not yet issued, or the part of it
+// drawn by an issue.
+type costLayer struct {
+	id        int
+	remaining int
+	value     float64
+}
+
+// lockCostLayers returns the open cost layers of sku in a warehouse, oldest
+// first, locking them for the rest of the transaction.
+func lockCostLayers(ctx context.Context, tx db.Tx, sku string, warehouseID int) ([]costLayer, error) {
+	sql := `
+		SELECT id, remaining, value::float8
+		FROM cost_layers
+		WHERE sku = $1 AND warehouse_id = $2 AND remaining > 0
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, sql, sku, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var layers []costLayer
+	for rows.Next() {
+		var l costLayer
+		if err := rows.Scan(&l.id, &l.remaining, &l.value); err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return layers, rows.Err()
+}
+
+// averageCostLayers folds open layers into the newest, so that every unit
+// held carries the weighted average cost.
+func averageCostLayers(layers []costLayer) []costLayer {
+	if len(layers) < 2 {
+		return layers
+	}
+	merged := costLayer{id: layers[len(layers)-1].id}
+	for _, l := range layers {
+		merged.remaining += l.remaining
+		merged.value += l.value
+	}
+	merged.value = roundCost(merged.value)
+	return []costLayer{merged}
+}
+
+// drawCostLayers plans taking quantity from layers oldest first, and returns
+// what is drawn from each layer and its total value. A layer drawn in part
+// gives up its value pro rata; quantity beyond the layers has no cost.
+func drawCostLayers(layers []costLayer, quantity int) ([]costLayer, float64) {
+	var draws []costLayer
+	var total float64
+	for _, l := range layers {
+		if quantity == 0 {
+			break
+		}
+		take := min(l.remaining, quantity)
+		value := l.value
+		if take < l.remaining {
+			value = roundCost(l.value * float64(take) / float64(l.remaining))
+		}
+		draws = append(draws, costLayer{id: l.id, remaining: take, value: value})
+		total += value
+		quantity -= take
+	}
+	return draws, roundCost(total)
+}
+
+// issueCost draws quantity of sku from the cost layers of a warehouse by
+// the valuation method and returns its cost. Under the average method the
+// open layers are first folded into the newest.
+func (s *InventoryService) issueCost(ctx context.Context, tx db.Tx, sku string, warehouseID, quantity int) (float64, error) {
+	layers, err := lockCostLayers(ctx, tx, sku, warehouseID)
+	if err != nil {
+		return 0, err
+	}
+	if s.valuationMethod == models.ValuationAverage && len(layers) > 1 {
+		ids := make([]int, 0, len(layers)-1)
+		for _, l := range layers[:len(layers)-1] {
+			ids = append(ids, l.id)
+		}
+		layers = averageCostLayers(layers)
+		if err := tx.Exec(ctx, `UPDATE cost_layers SET remaining = 0, value = 0 WHERE id = ANY($1)`, ids); err != nil {
+			return 0, err
+		}
+		if err := tx.Exec(ctx, `UPDATE cost_layers SET remaining = $2, value = $3 WHERE id = $1`, layers[0].id, layers[0].remaining, layers[0].value); err != nil {
+			return 0, err
+		}
+	}
+
+	draws, cost := drawCostLayers(layers, quantity)
+	for _, d := range draws {
+		sql := `
+			UPDATE cost_layers
+			SET remaining = remaining - $2, value = value - $3
+			WHERE id = $1
+		`
+		if err := tx.Exec(ctx, sql, d.id, d.remaining, d.value); err != nil {
+			return 0, err
+		}
+	}
+	return cost, nil
+}
+
+// receiptUnitCost returns the cost per base unit of stock added to a
+// warehouse: the cost given, or else the average cost of the open layers.
+func receiptUnitCost(ctx context.Context, tx db.Tx, update models.StockUpdate) (float64, error) {
+	if update.UnitCost != nil {
+		return *update.UnitCost, nil
+	}
+	sql := `
+		SELECT COALESCE(SUM(value) / NULLIF(SUM(remaining), 0), 0)::float8
+		FROM cost_layers
+		WHERE sku = $1 AND warehouse_id = $2 AND remaining > 0
+	`
+	var unitCost float64
+	err := queryRow(ctx, tx, sql, []interface{}{update.SKU, update.WarehouseID}, &unitCost)
+	return unitCost, err
+}
+
+// addCostLayer records stock added by the ledger entry txID as a new cost
+// layer.
+func addCostLayer(ctx context.Context, tx db.Tx, update models.StockUpdate, txID int, unitCost, value float64) error {
+	sql := `
+		INSERT INTO cost_layers (sku, warehouse_id, transaction_id, unit_cost, quantity, remaining, value)
+		VALUES ($1, $2, $3, $4, $5, $5, $6)
+	`
+	return tx.Exec(ctx, sql, update.SKU, update.WarehouseID, txID, roundCost(unitCost), update.Quantity, value)
+}
+
+// ListCostLayers returns the open cost layers of sku, by warehouse and
+// oldest first. Under the average method a warehouse holds a single open
+// layer once stock has been issued from it.
+func (s *InventoryService) ListCostLayers(ctx context.Context, sku string) (_ []models.CostLayer, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.ListCostLayers", attribute.String("sku", sku))
+	defer end(span, &err)
+	sql := `
+		SELECT id, sku, warehouse_id, transaction_id, unit_cost::float8, quantity, remaining, value::float8, created_at
+		FROM cost_layers
+		WHERE sku = $1 AND remaining > 0
+		ORDER BY warehouse_id, id
+	`
+	rows, err := s.db.Query(ctx, sql, sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	layers := []models.CostLayer{}
+	for rows.Next() {
+		var l models.CostLayer
+		if err := rows.Scan(&l.ID, &l.SKU, &l.WarehouseID, &l.TransactionID, &l.UnitCost, &l.Quantity, &l.Remaining, &l.Value, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return layers, rows.Err()
+}
+
+// GetValuation values the stock held at filter.AsOf, or now, by warehouse.
+// Quantities and values are reconstructed from the most recent snapshot
+// plus the ledger entries recorded after it, so each issue counts at the
+// cost it was recorded with. Stock received before costs were tracked has
+// no value.
+func (s *InventoryService) GetValuation(ctx context.Context, filter models.ValuationFilter) (_ models.ValuationReport, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetValuation",
+		attribute.String("sku", filter.SKU), attribute.Int("warehouse_id", filter.WarehouseID))
+	defer end(span, &err)
+	if filter.WarehouseID < 0 {
+		return models.ValuationReport{}, Invalid("warehouse_id", "must be a positive integer")
+	}
+	asOf := filter.AsOf
+	if asOf.IsZero() {
+		asOf = time.Now()
+	}
+
+	sql := `
+		WITH base AS (
+			SELECT snapshot_at
+			FROM stock_snapshot_runs
+			WHERE snapshot_at <= $1
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		)
+		SELECT ledger.warehouse_id, COALESCE(w.name, ''), ledger.sku, SUM(ledger.quantity)::int, SUM(ledger.value)::float8
+		FROM (
+			SELECT s.sku, s.warehouse_id, s.quantity, s.value
+			FROM stock_snapshots s
+			JOIN base ON s.snapshot_at = base.snapshot_at
+			WHERE ($2 = '' OR s.sku = $2) AND ($3 = 0 OR s.warehouse_id = $3)
+			UNION ALL
+			SELECT t.sku, t.warehouse_id, t.change, t.cost
+			FROM inventory_transactions t
+			WHERE t.timestamp <= $1
+				AND t.timestamp > COALESCE((SELECT snapshot_at FROM base), '-infinity')
+				AND ($2 = '' OR t.sku = $2) AND ($3 = 0 OR t.warehouse_id = $3)
+		) ledger
+		LEFT JOIN warehouses w ON w.id = ledger.warehouse_id
+		GROUP BY ledger.warehouse_id, w.name, ledger.sku
+		HAVING SUM(ledger.quantity) <> 0 OR SUM(ledger.value) <> 0
+		ORDER BY ledger.warehouse_id, ledger.sku
+	`
+	rows, err := s.db.Query(ctx, sql, ledgerTime(asOf), filter.SKU, filter.WarehouseID)
+	if err != nil {
+		return models.ValuationReport{}, err
+	}
+	defer rows.Close()
+
+	report := models.ValuationReport{AsOf: asOf.UTC(), Method: s.valuationMethod, Warehouses: []models.WarehouseValuation{}}
+	for rows.Next() {
+		var warehouseID int
+		var name string
+		var item models.ItemValuation
+		if err := rows.Scan(&warehouseID, &name, &item.SKU, &item.Quantity, &item.Value); err != nil {
+			return models.ValuationReport{}, err
+		}
+		if item.Quantity > 0 {
+			item.UnitCost = roundCost(item.Value / float64(item.Quantity))
+		}
+		n := len(report.Warehouses)
+		if n == 0 || report.Warehouses[n-1].WarehouseID != warehouseID {
+			report.Warehouses = append(report.Warehouses, models.WarehouseValuation{WarehouseID: warehouseID, Name: name})
+			n++
+		}
+		w := &report.Warehouses[n-1]
+		w.Items = append(w.Items, item)
+		w.Value = roundCost(w.Value + item.Value)
+		report.Value = roundCost(report.Value + item.Value)
+	}
+	return report, rows.Err()
+}
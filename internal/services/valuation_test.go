@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrawCostLayers(t *testing.T) {
+	layers := []costLayer{{id: 1, remaining: 3, value: 30}, {id: 2, remaining: 3, value: 10}}
+
+	draws, cost := drawCostLayers(layers, 4)
+	assert.Equal(t, []costLayer{{id: 1, remaining: 3, value: 30}, {id: 2, remaining: 1, value: 3.3333}}, draws, "oldest first, the rest pro rata")
+	assert.Equal(t, 33.3333, cost)
+
+	draws, cost = drawCostLayers(layers, 8)
+	assert.Len(t, draws, 2)
+	assert.Equal(t, 40.0, cost, "stock beyond the layers has no cost")
+
+	assert.Equal(t, []costLayer{{id: 2, remaining: 6, value: 40}}, averageCostLayers(layers))
+}
+
+func TestSimulateOrderCostsGoodsSold(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		cost   float64
+	}{
+		{models.ValuationFIFO, 54},
+		{models.ValuationAverage, 57.6923},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			fdb := newFakeDB()
+			fdb.results["FROM stock_levels"] = [][]interface{}{{1, 13}}
+			fdb.results["FROM cost_layers"] = [][]interface{}{{1, 3, 30.0}, {2, 10, 120.0}}
+			svc := NewInventoryService(fdb, &fakeRedis{})
+			svc.SetValuationMethod(tc.method)
+
+			allocations, err := svc.SimulateOrder(context.Background(), models.Order{SKU: "test", Channel: "amazon", Quantity: 5})
+			require.NoError(t, err)
+			assert.Equal(t, []models.Allocation{{WarehouseID: 1, Quantity: 5, Cost: tc.cost}}, allocations)
+			assert.Equal(t, -tc.cost, fdb.statements("INSERT INTO inventory_transactions")[0].args[7])
+		})
+	}
+}
+
+func TestAverageCostFoldsLayers(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["FROM cost_layers"] = [][]interface{}{{1, 3, 30.0}, {2, 10, 120.0}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetValuationMethod(models.ValuationAverage)
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -13})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]int{1}}, fdb.statements("SET remaining = 0, value = 0")[0].args)
+	assert.Equal(t, []interface{}{2, 13, 150.0}, fdb.statements("SET remaining = $2, value = $3")[0].args)
+	assert.Equal(t, []interface{}{2, 13, 150.0}, fdb.statements("SET remaining = remaining - $2")[0].args)
+	assert.Equal(t, -150.0, fdb.statements("INSERT INTO inventory_transactions")[0].args[7])
+	assert.Empty(t, fdb.statements("INSERT INTO cost_layers"))
+}
+
+func TestAddOrUpdateStockOpensCostLayer(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["RETURNING id"] = [][]interface{}{{42}}
+	fdb.results["FROM product_units"] = [][]interface{}{{"test", 12}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	cost := 30.0
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 2, Unit: "case", UnitCost: &cost})
+	require.NoError(t, err)
+	assert.Equal(t, 60.0, fdb.statements("INSERT INTO inventory_transactions")[0].args[7])
+	assert.Equal(t, []interface{}{"test", 1, 42, 2.5, 24, 60.0}, fdb.statements("INSERT INTO cost_layers")[0].args, "the cost is given per case of 12")
+
+	// Without a cost, stock is added at the warehouse's average cost
+	fdb = newFakeDB()
+	fdb.results["RETURNING id"] = [][]interface{}{{43}}
+	fdb.results["NULLIF(SUM(remaining), 0)"] = [][]interface{}{{1.25}}
+	svc = NewInventoryService(fdb, &fakeRedis{})
+	require.NoError(t, svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: 4}))
+	assert.Equal(t, []interface{}{"test", 1, 43, 1.25, 4, 5.0}, fdb.statements("INSERT INTO cost_layers")[0].args)
+
+	err = svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "test", WarehouseID: 1, Quantity: -4, UnitCost: &cost})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "unit_cost", Message: "is only accepted for stock added"}}, invalid.Fields)
+}
+
+func TestGetValuation(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SUM(ledger.value)"] = [][]interface{}{
+		{1, "Main", "a", 10, 25.0},
+		{1, "Main", "b", 0, 0.5},
+		{2, "", "a", 4, 10.0},
+	}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	asOf := time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC)
+
+	report, err := svc.GetValuation(context.Background(), models.ValuationFilter{AsOf: asOf})
+	require.NoError(t, err)
+	assert.Equal(t, models.ValuationReport{
+		AsOf:   asOf,
+		Method: "fifo",
+		Value:  35.5,
+		Warehouses: []models.WarehouseValuation{
+			{WarehouseID: 1, Name: "Main", Value: 25.5, Items: []models.ItemValuation{
+				{SKU: "a", Quantity: 10, Value: 25, UnitCost: 2.5},
+				{SKU: "b", Value: 0.5},
+			}},
+			{WarehouseID: 2, Value: 10, Items: []models.ItemValuation{{SKU: "a", Quantity: 4, Value: 10, UnitCost: 2.5}}},
+		},
+	}, report)
+	assert.Equal(t, []interface{}{asOf.Local(), "", 0}, fdb.statements("SUM(ledger.value)")[0].args)
+
+	_, err = svc.GetValuation(context.Background(), models.ValuationFilter{WarehouseID: -1})
+	var invalid *ValidationError
+	assert.ErrorAs(t, err, &invalid)
+}
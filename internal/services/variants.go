@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"omnichannel_inventory/internal/db"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// attributePattern matches variant attribute names such as size or colour.
+var attributePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,29}$`)
+
+const (
+	// maxVariantAttributes bounds the attributes of a parent product.
+	maxVariantAttributes = 5
+	// maxVariantValues bounds the values of one variant attribute.
+	maxVariantValues = 100
+)
+
+// validateVariants reports variant fields that are malformed or that do not
+// fit together: a product is either a parent or a variant, and only
+// variants give attribute values.
+func validateVariants(v *ValidationError, product models.Product) {
+	v.add(len(product.Parent) <= 100, "parent", "must be at most 100 characters")
+	v.add(product.Parent != product.SKU, "parent", "must not be the product itself")
+	v.add(product.Parent == "" || len(product.VariantAttributes) == 0, "parent", "must be empty for parent products")
+	v.add(product.Parent != "" || len(product.Attributes) == 0, "attributes", "are only accepted for variants")
+	v.add(product.Parent == "" || len(product.Attributes) > 0, "attributes", "are required for variants")
+	if len(product.VariantAttributes) == 0 {
+		return
+	}
+
+	v.add(!product.Serialized && len(product.Components) == 0, "variant_attributes", "cannot be defined for serialized products or kits")
+	v.add(len(product.VariantAttributes) <= maxVariantAttributes, "variant_attributes", fmt.Sprintf("must list at most %d attributes", maxVariantAttributes))
+	names := map[string]bool{}
+	for _, a := range product.VariantAttributes {
+		switch {
+		case !attributePattern.MatchString(a.Name):
+			v.add(false, "variant_attributes", fmt.Sprintf("%q must be at most 30 lowercase letters, digits and underscores, starting with a letter", a.Name))
+		case names[a.Name]:
+			v.add(false, "variant_attributes", fmt.Sprintf("%s is listed more than once", a.Name))
+		case len(a.Values) == 0 || len(a.Values) > maxVariantValues:
+			v.add(false, "variant_attributes", fmt.Sprintf("%s must list between 1 and %d values", a.Name, maxVariantValues))
+		default:
+			values := map[string]bool{}
+			for _, value := range a.Values {
+				if value == "" || len(value) > 50 || values[value] {
+					v.add(false, "variant_attributes", fmt.Sprintf("%s values must be distinct and between 1 and 50 characters", a.Name))
+					break
+				}
+				values[value] = true
+			}
+		}
+		names[a.Name] = true
+	}
+}
+
+// variantMismatch describes how values fail to give one of the allowed
+// values of each attribute, or returns "" if they do not.
+func variantMismatch(attributes []models.VariantAttribute, values map[string]string) string {
+	for _, a := range attributes {
+		value, ok := values[a.Name]
+		if !ok {
+			return fmt.Sprintf("%s is required", a.Name)
+		}
+		if valueIndex(a, value) < 0 {
+			return fmt.Sprintf("%s must be one of %s", a.Name, strings.Join(a.Values, ", "))
+		}
+	}
+	var extra []string
+	for name := range values {
+		if variantAttributeIndex(attributes, name) < 0 {
+			extra = append(extra, name)
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		return fmt.Sprintf("%s is not a variant attribute", extra[0])
+	}
+	return ""
+}
+
+func valueIndex(a models.VariantAttribute, value string) int {
+	for i, v := range a.Values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func variantAttributeIndex(attributes []models.VariantAttribute, name string) int {
+	for i, a := range attributes {
+		if a.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// variantAttributes returns the attributes parent defines for its
+// variants, or none if it is not a parent product.
+func variantAttributes(ctx context.Context, q querier, parent string) ([]models.VariantAttribute, error) {
+	rows, err := q.Query(ctx, `SELECT name, options FROM variant_attributes WHERE parent_sku = $1 ORDER BY position`, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attributes []models.VariantAttribute
+	for rows.Next() {
+		var a models.VariantAttribute
+		if err := rows.Scan(&a.Name, &a.Values); err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, a)
+	}
+	return attributes, rows.Err()
+}
+
+// variant is a variant of a parent product with its attribute values.
+type variant struct {
+	sku    string
+	name   string
+	values map[string]string
+}
+
+// loadVariants returns the variants of parent in SKU order.
+func loadVariants(ctx context.Context, q querier, parent string) ([]variant, error) {
+	sql := `
+		SELECT p.sku, p.name, COALESCE(v.attribute, ''), COALESCE(v.value, '')
+		FROM products p
+		LEFT JOIN variant_values v ON v.sku = p.sku
+		WHERE p.parent_sku = $1
+		ORDER BY p.sku, v.attribute
+	`
+	rows, err := q.Query(ctx, sql, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []variant
+	for rows.Next() {
+		var sku, name, attribute, value string
+		if err := rows.Scan(&sku, &name, &attribute, &value); err != nil {
+			return nil, err
+		}
+		if len(variants) == 0 || variants[len(variants)-1].sku != sku {
+			variants = append(variants, variant{sku: sku, name: name, values: map[string]string{}})
+		}
+		if attribute != "" {
+			variants[len(variants)-1].values[attribute] = value
+		}
+	}
+	return variants, rows.Err()
+}
+
+// isParentProduct reports whether sku groups variants, and so holds no
+// stock of its own.
+func isParentProduct(ctx context.Context, tx db.Tx, sku string) (bool, error) {
+	var parent bool
+	err := queryRow(ctx, tx, `SELECT EXISTS (SELECT 1 FROM variant_attributes WHERE parent_sku = $1)`, []interface{}{sku}, &parent)
+	return parent, err
+}
+
+// checkVariants checks a variant against the attributes of its parent and
+// its siblings, and a parent product's attributes against its variants.
+// Saving a variant locks its parent, so no two variants of a parent are
+// saved with the same attribute values.
+func checkVariants(ctx context.Context, tx db.Tx, product models.Product, stocked bool) error {
+	if product.Parent != "" {
+		var locked string
+		if err := queryRow(ctx, tx, `SELECT sku FROM products WHERE sku = $1 FOR UPDATE`, []interface{}{product.Parent}, &locked); err != nil {
+			return err
+		}
+		attributes, err := variantAttributes(ctx, tx, product.Parent)
+		if err != nil {
+			return err
+		}
+		if len(attributes) == 0 {
+			return Invalid("parent", fmt.Sprintf("%s is not a parent product", product.Parent))
+		}
+		if mismatch := variantMismatch(attributes, product.Attributes); mismatch != "" {
+			return Invalid("attributes", mismatch)
+		}
+		siblings, err := loadVariants(ctx, tx, product.Parent)
+		if err != nil {
+			return err
+		}
+		for _, sibling := range siblings {
+			if sibling.sku != product.SKU && sameValues(sibling.values, product.Attributes) {
+				return Invalid("attributes", fmt.Sprintf("are already those of variant %s", sibling.sku))
+			}
+		}
+	}
+
+	variants, err := loadVariants(ctx, tx, product.SKU)
+	if err != nil {
+		return err
+	}
+	if len(variants) > 0 && len(product.VariantAttributes) == 0 {
+		return Invalid("variant_attributes", "are required while the product has variants")
+	}
+	for _, variant := range variants {
+		if mismatch := variantMismatch(product.VariantAttributes, variant.values); mismatch != "" {
+			return Invalid("variant_attributes", fmt.Sprintf("do not fit variant %s: %s", variant.sku, mismatch))
+		}
+	}
+	if len(product.VariantAttributes) == 0 {
+		return nil
+	}
+	if stocked {
+		return Invalid("variant_attributes", "cannot be defined while the SKU holds stock")
+	}
+	var component bool
+	sql := `SELECT EXISTS (SELECT 1 FROM kit_components WHERE component_sku = $1)`
+	if err := queryRow(ctx, tx, sql, []interface{}{product.SKU}, &component); err != nil {
+		return err
+	}
+	if component {
+		return Invalid("variant_attributes", "cannot be defined for a component of a kit")
+	}
+	return nil
+}
+
+func sameValues(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if b[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// saveVariants replaces the attributes a parent product defines and the
+// attribute values of a variant.
+func saveVariants(ctx context.Context, tx db.Tx, product models.Product) error {
+	if err := tx.Exec(ctx, `DELETE FROM variant_attributes WHERE parent_sku = $1`, product.SKU); err != nil {
+		return err
+	}
+	for i, a := range product.VariantAttributes {
+		sql := `
+			INSERT INTO variant_attributes (parent_sku, position, name, options)
+			VALUES ($1, $2, $3, $4)
+		`
+		if err := tx.Exec(ctx, sql, product.SKU, i, a.Name, a.Values); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec(ctx, `DELETE FROM variant_values WHERE sku = $1`, product.SKU); err != nil {
+		return err
+	}
+	if len(product.Attributes) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(product.Attributes))
+	for name := range product.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = product.Attributes[name]
+	}
+	sql := `
+		INSERT INTO variant_values (sku, attribute, value)
+		SELECT $1, unnest($2::text[]), unnest($3::text[])
+	`
+	return tx.Exec(ctx, sql, product.SKU, names, values)
+}
+
+// GetVariantMatrix returns the stock of each variant of the parent product
+// sku, ordered along its attributes, with the totals of the parent. It
+// returns a *NotFoundError if sku is not a parent product.
+func (s *InventoryService) GetVariantMatrix(ctx context.Context, sku string) (_ models.VariantMatrix, err error) {
+	ctx, span := tracing.Start(ctx, "InventoryService.GetVariantMatrix", attribute.String("sku", sku))
+	defer end(span, &err)
+
+	attributes, err := variantAttributes(ctx, s.db, sku)
+	if err != nil {
+		return models.VariantMatrix{}, err
+	}
+	if len(attributes) == 0 {
+		return models.VariantMatrix{}, &NotFoundError{Resource: "parent product", ID: sku}
+	}
+	variants, err := loadVariants(ctx, s.db, sku)
+	if err != nil {
+		return models.VariantMatrix{}, err
+	}
+
+	// Lay the variants out in the order of the attribute values
+	position := func(v variant) []int {
+		indexes := make([]int, len(attributes))
+		for i, a := range attributes {
+			indexes[i] = valueIndex(a, v.values[a.Name])
+		}
+		return indexes
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		a, b := position(variants[i]), position(variants[j])
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	matrix := models.VariantMatrix{SKU: sku, Attributes: attributes, Warehouses: []models.WarehouseStock{}, Variants: []models.VariantStock{}}
+	totals := map[int]int{}
+	for _, v := range variants {
+		summary, err := s.stockSummary(ctx, v.sku)
+		if err != nil {
+			return models.VariantMatrix{}, err
+		}
+		matrix.Variants = append(matrix.Variants, models.VariantStock{
+			SKU:         v.sku,
+			Name:        v.name,
+			Attributes:  v.values,
+			OnHand:      summary.OnHand,
+			Available:   summary.Available,
+			Incoming:    summary.Incoming,
+			NextArrival: summary.NextArrival,
+			Warehouses:  summary.Warehouses,
+		})
+		matrix.OnHand += summary.OnHand
+		matrix.Available += summary.Available
+		matrix.Incoming += summary.Incoming
+		for _, w := range summary.Warehouses {
+			i, ok := totals[w.WarehouseID]
+			if !ok {
+				i = len(matrix.Warehouses)
+				totals[w.WarehouseID] = i
+				matrix.Warehouses = append(matrix.Warehouses, models.WarehouseStock{WarehouseID: w.WarehouseID, Name: w.Name, Location: w.Location})
+			}
+			matrix.Warehouses[i].OnHand += w.OnHand
+			matrix.Warehouses[i].Available += w.Available
+			matrix.Warehouses[i].Incoming += w.Incoming
+		}
+	}
+	sort.Slice(matrix.Warehouses, func(i, j int) bool { return matrix.Warehouses[i].WarehouseID < matrix.Warehouses[j].WarehouseID })
+	return matrix, nil
+}
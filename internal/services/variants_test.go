@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateProductVariants(t *testing.T) {
+	err := validateProduct(models.Product{SKU: "tee", Name: "Tee", Parent: "shirts", VariantAttributes: []models.VariantAttribute{
+		{Name: "Size", Values: []string{"S"}},
+		{Name: "colour", Values: []string{"red", "red"}},
+		{Name: "fit"},
+	}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{
+		{Field: "parent", Message: "must be empty for parent products"},
+		{Field: "attributes", Message: "are required for variants"},
+		{Field: "variant_attributes", Message: `"Size" must be at most 30 lowercase letters, digits and underscores, starting with a letter`},
+		{Field: "variant_attributes", Message: "colour values must be distinct and between 1 and 50 characters"},
+		{Field: "variant_attributes", Message: "fit must list between 1 and 100 values"},
+	}, invalid.Fields)
+
+	err = validateProduct(models.Product{SKU: "tee", Name: "Tee", Attributes: map[string]string{"size": "S"}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "attributes", Message: "are only accepted for variants"}}, invalid.Fields)
+}
+
+func TestVariantMismatch(t *testing.T) {
+	attributes := []models.VariantAttribute{{Name: "size", Values: []string{"S", "M"}}, {Name: "colour", Values: []string{"red"}}}
+	assert.Equal(t, "", variantMismatch(attributes, map[string]string{"size": "M", "colour": "red"}))
+	assert.Equal(t, "colour is required", variantMismatch(attributes, map[string]string{"size": "M"}))
+	assert.Equal(t, "size must be one of S, M", variantMismatch(attributes, map[string]string{"size": "XL", "colour": "red"}))
+	assert.Equal(t, "fit is not a variant attribute", variantMismatch(attributes, map[string]string{"size": "M", "colour": "red", "fit": "slim"}))
+}
+
+func TestSaveProductVariant(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT name, options"] = [][]interface{}{{"size", []string{"S", "M"}}, {"colour", []string{"red", "blue"}}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.SaveProduct(context.Background(), models.Product{SKU: "tee-s-red", Name: "Tee", Parent: "tee", Attributes: map[string]string{"size": "S", "colour": "red"}})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"tee-s-red", "Tee", false, "tee"}, fdb.statements("INSERT INTO products")[0].args)
+	values := fdb.statements("INSERT INTO variant_values")
+	require.Len(t, values, 1)
+	assert.Equal(t, []interface{}{"tee-s-red", []string{"colour", "size"}, []string{"red", "S"}}, values[0].args)
+
+	// Values must be allowed by the parent
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "tee-xl-red", Name: "Tee", Parent: "tee", Attributes: map[string]string{"size": "XL", "colour": "red"}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "attributes", Message: "size must be one of S, M"}}, invalid.Fields)
+
+	// and not repeat those of another variant
+	fdb.results["WHERE p.parent_sku = $1"] = [][]interface{}{{"tee-s-red", "Tee", "colour", "red"}, {"tee-s-red", "Tee", "size", "S"}}
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "tee-small-red", Name: "Tee", Parent: "tee", Attributes: map[string]string{"size": "S", "colour": "red"}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "attributes", Message: "are already those of variant tee-s-red"}}, invalid.Fields)
+
+	delete(fdb.results, "SELECT name, options")
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "tee-s-red", Name: "Tee", Parent: "other", Attributes: map[string]string{"size": "S"}})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "parent", Message: "other is not a parent product"}}, invalid.Fields)
+	assert.Len(t, fdb.statements("INSERT INTO products"), 1)
+}
+
+func TestSaveProductParentKeepsVariantsValid(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["WHERE p.parent_sku = $1"] = [][]interface{}{{"tee-s", "Tee", "size", "S"}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	_, err := svc.SaveProduct(context.Background(), models.Product{SKU: "tee", Name: "Tee", VariantAttributes: []models.VariantAttribute{{Name: "size", Values: []string{"M", "L"}}}})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "variant_attributes", Message: "do not fit variant tee-s: size must be one of M, L"}}, invalid.Fields)
+
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "tee", Name: "Tee"})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "variant_attributes", Message: "are required while the product has variants"}}, invalid.Fields)
+
+	_, err = svc.SaveProduct(context.Background(), models.Product{SKU: "tee", Name: "Tee", VariantAttributes: []models.VariantAttribute{{Name: "size", Values: []string{"S", "M", "L"}}}})
+	require.NoError(t, err)
+	attributes := fdb.statements("INSERT INTO variant_attributes")
+	require.Len(t, attributes, 1)
+	assert.Equal(t, []interface{}{"tee", 0, "size", []string{"S", "M", "L"}}, attributes[0].args)
+}
+
+func TestAddOrUpdateStockRejectsParentProducts(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["EXISTS (SELECT 1 FROM variant_attributes WHERE parent_sku = $1)"] = [][]interface{}{{true}}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+
+	err := svc.AddOrUpdateStock(context.Background(), models.StockUpdate{SKU: "tee", WarehouseID: 1, Quantity: 5})
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []FieldError{{Field: "sku", Message: "is a parent product; update the stock of its variants instead"}}, invalid.Fields)
+	assert.Empty(t, fdb.statements("INSERT INTO stock_levels"))
+}
+
+func TestGetVariantMatrix(t *testing.T) {
+	fdb := newFakeDB()
+	fdb.results["SELECT name, options"] = [][]interface{}{{"size", []string{"S", "M"}}, {"colour", []string{"red", "blue"}}}
+	fdb.results["WHERE p.parent_sku = $1"] = [][]interface{}{
+		{"tee-1", "Tee", "colour", "blue"}, {"tee-1", "Tee", "size", "S"},
+		{"tee-2", "Tee", "colour", "red"}, {"tee-2", "Tee", "size", "M"},
+		{"tee-3", "Tee", "colour", "red"}, {"tee-3", "Tee", "size", "S"},
+	}
+	svc := NewInventoryService(fdb, &fakeRedis{})
+	svc.SetStockCache(&fakeCache{summaries: map[string]models.StockSummary{
+		"tee-1": {SKU: "tee-1", OnHand: 2, Available: 2, Warehouses: []models.WarehouseStock{{WarehouseID: 2, OnHand: 2, Available: 2}}},
+		"tee-2": {SKU: "tee-2", OnHand: -1, Available: 0, Warehouses: []models.WarehouseStock{{WarehouseID: 1, OnHand: -1}}},
+		"tee-3": {SKU: "tee-3", OnHand: 5, Available: 5, Warehouses: []models.WarehouseStock{{WarehouseID: 1, OnHand: 3, Available: 3}, {WarehouseID: 2, OnHand: 2, Available: 2}}},
+	}})
+
+	matrix, err := svc.GetVariantMatrix(context.Background(), "tee")
+	require.NoError(t, err)
+	var order []string
+	for _, v := range matrix.Variants {
+		order = append(order, v.SKU)
+	}
+	assert.Equal(t, []string{"tee-3", "tee-1", "tee-2"}, order, "ordered by size, then colour")
+	assert.Equal(t, 6, matrix.OnHand)
+	assert.Equal(t, 7, matrix.Available)
+	assert.Equal(t, []models.WarehouseStock{{WarehouseID: 1, OnHand: 2, Available: 3}, {WarehouseID: 2, OnHand: 4, Available: 4}}, matrix.Warehouses)
+
+	delete(fdb.results, "SELECT name, options")
+	_, err = svc.GetVariantMatrix(context.Background(), "tee-1")
+	var notFound *NotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"omnichannel_inventory/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{
+		Exporter:    config.TraceExporterNone,
+		ServiceName: "test",
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+	defer shutdown(context.Background())
+
+	ctx, span := Start(context.Background(), "request")
+	defer span.End()
+
+	fields := map[string]interface{}{"sku": "test"}
+	Inject(ctx, fields)
+	assert.Contains(t, fields, "traceparent")
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), fields))
+	assert.True(t, extracted.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), extracted.SpanID())
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), config.TracingConfig{Exporter: "zipkin", SampleRatio: 1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,150 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/metrics"
+	"omnichannel_inventory/internal/models"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueueSize is the number of alerts that may wait for delivery.
+const QueueSize = 100
+
+var (
+	ErrQueueFull   = errors.New("webhook queue is full")
+	ErrQueueClosed = errors.New("webhook queue is closed")
+)
+
+// Notifier delivers low stock and near-expiry alerts and replenishment
+// reports.
+type Notifier interface {
+	NotifyLowStock(ctx context.Context, sku string, warehouseID int, stock int) error
+	NotifyNearExpiry(ctx context.Context, lot models.ExpiringLot) error
+	NotifyReplenishment(ctx context.Context, report models.ReplenishmentReport) error
+}
+
+// alert is a queued low stock alert, a near-expiry alert if lot is set or
+// a replenishment report if report is set.
+type alert struct {
+	// span and requestID link the delivery to the request that raised it
+	span        trace.SpanContext
+	requestID   string
+	sku         string
+	warehouseID int
+	stock       int
+	lot         *models.ExpiringLot
+	report      *models.ReplenishmentReport
+}
+
+// Queue delivers alerts in the background so that slow webhook calls do
+// not hold up event processing.
+type Queue struct {
+	notifier Notifier
+	alerts   chan alert
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewQueue(notifier Notifier, size int) *Queue {
+	q := &Queue{
+		notifier: notifier,
+		alerts:   make(chan alert, size),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for a := range q.alerts {
+		ctx := trace.ContextWithSpanContext(context.Background(), a.span)
+		ctx = logging.WithRequestID(ctx, a.requestID)
+		start := time.Now()
+		var err error
+		switch {
+		case a.lot != nil:
+			err = q.notifier.NotifyNearExpiry(ctx, *a.lot)
+		case a.report != nil:
+			err = q.notifier.NotifyReplenishment(ctx, *a.report)
+		default:
+			err = q.notifier.NotifyLowStock(ctx, a.sku, a.warehouseID, a.stock)
+		}
+		metrics.WebhookDeliveryDuration.Observe(time.Since(start).Seconds())
+		metrics.WebhookDeliveries.WithLabelValues(metrics.Result(err)).Inc()
+		if err != nil {
+			switch {
+			case a.lot != nil:
+				slog.ErrorContext(ctx, "failed to deliver near expiry alert",
+					"sku", a.lot.SKU, "lot_number", a.lot.LotNumber, "error", err)
+			case a.report != nil:
+				slog.ErrorContext(ctx, "failed to deliver replenishment report",
+					"suggestions", len(a.report.Suggestions), "error", err)
+			default:
+				slog.ErrorContext(ctx, "failed to deliver low stock alert",
+					"sku", a.sku, "warehouse_id", a.warehouseID, "error", err)
+			}
+		}
+	}
+}
+
+// NotifyLowStock queues the alert for delivery. It fails rather than
+// blocking when the queue is full.
+func (q *Queue) NotifyLowStock(ctx context.Context, sku string, warehouseID int, stock int) error {
+	return q.enqueue(ctx, alert{sku: sku, warehouseID: warehouseID, stock: stock})
+}
+
+// NotifyNearExpiry queues the alert for delivery. It fails rather than
+// blocking when the queue is full.
+func (q *Queue) NotifyNearExpiry(ctx context.Context, lot models.ExpiringLot) error {
+	return q.enqueue(ctx, alert{lot: &lot})
+}
+
+// NotifyReplenishment queues the report for delivery. It fails rather than
+// blocking when the queue is full.
+func (q *Queue) NotifyReplenishment(ctx context.Context, report models.ReplenishmentReport) error {
+	return q.enqueue(ctx, alert{report: &report})
+}
+
+func (q *Queue) enqueue(ctx context.Context, a alert) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	a.span = trace.SpanContextFromContext(ctx)
+	a.requestID = logging.RequestID(ctx)
+	select {
+	case q.alerts <- a:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting alerts and waits for queued ones to be delivered
+// or ctx to expire.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.alerts)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slowNotifier struct {
+	delay     time.Duration
+	delivered []string
+}
+
+func (n *slowNotifier) NotifyLowStock(ctx context.Context, sku string, warehouseID int, stock int) error {
+	time.Sleep(n.delay)
+	n.delivered = append(n.delivered, sku)
+	return nil
+}
+
+func (n *slowNotifier) NotifyNearExpiry(ctx context.Context, lot models.ExpiringLot) error {
+	time.Sleep(n.delay)
+	n.delivered = append(n.delivered, lot.SKU+"/"+lot.LotNumber)
+	return nil
+}
+
+func (n *slowNotifier) NotifyReplenishment(ctx context.Context, report models.ReplenishmentReport) error {
+	time.Sleep(n.delay)
+	n.delivered = append(n.delivered, fmt.Sprintf("report/%d", len(report.Suggestions)))
+	return nil
+}
+
+func TestQueueCloseFlushesPendingAlerts(t *testing.T) {
+	notifier := &slowNotifier{delay: 10 * time.Millisecond}
+	queue := NewQueue(notifier, 10)
+
+	assert.NoError(t, queue.NotifyLowStock(context.Background(), "a", 1, 1))
+	assert.NoError(t, queue.NotifyNearExpiry(context.Background(), models.ExpiringLot{SKU: "b", LotNumber: "L1"}))
+	assert.NoError(t, queue.NotifyReplenishment(context.Background(), models.ReplenishmentReport{Suggestions: make([]models.ReplenishmentSuggestion, 2)}))
+	assert.NoError(t, queue.Close(context.Background()))
+	assert.Equal(t, []string{"a", "b/L1", "report/2"}, notifier.delivered)
+
+	assert.ErrorIs(t, queue.NotifyLowStock(context.Background(), "c", 1, 1), ErrQueueClosed)
+}
+
+func TestQueueCloseHonoursDeadline(t *testing.T) {
+	queue := NewQueue(&slowNotifier{delay: time.Second}, 10)
+	assert.NoError(t, queue.NotifyLowStock(context.Background(), "a", 1, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, queue.Close(ctx), context.DeadlineExceeded)
+}
+
+func TestQueueRejectsWhenFull(t *testing.T) {
+	queue := NewQueue(&slowNotifier{delay: 100 * time.Millisecond}, 1)
+	defer queue.Close(context.Background())
+
+	// The worker may take the first alert off the queue before the rest arrive
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = queue.NotifyLowStock(context.Background(), "a", 1, 1)
+	}
+	assert.ErrorIs(t, err, ErrQueueFull)
+}
@@ -2,13 +2,24 @@ package webhooks
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"omnichannel_inventory/internal/config"
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/models"
+	"omnichannel_inventory/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type LowStockPayload struct {
@@ -24,11 +35,11 @@ type SlackMessage struct {
 }
 
 type Attachment struct {
-	Color     string   `json:"color"`
-	Title     string   `json:"title"`
-	Text      string   `json:"text"`
-	Fields    []Field  `json:"fields"`
-	Timestamp int64    `json:"ts"`
+	Color     string  `json:"color"`
+	Title     string  `json:"title"`
+	Text      string  `json:"text"`
+	Fields    []Field `json:"fields"`
+	Timestamp int64   `json:"ts"`
 }
 
 type Field struct {
@@ -37,15 +48,24 @@ type Field struct {
 	Short bool   `json:"short"`
 }
 
-func NotifyLowStock(sku string, warehouseID int, stock int) error {
-	slackURL := os.Getenv("SLACK_WEBHOOK_URL")
-	if slackURL == "" {
-		log.Printf("SLACK_WEBHOOK_URL not set in environment variables")
-		return fmt.Errorf("SLACK_WEBHOOK_URL not set")
+// SlackNotifier posts alerts to a Slack incoming webhook.
+type SlackNotifier struct {
+	webhookURL string
+	threshold  int
+	client     *http.Client
+}
+
+func NewSlackNotifier(cfg config.SlackConfig, threshold int) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: cfg.WebhookURL.Value(),
+		threshold:  threshold,
+		client: &http.Client{
+			Timeout: cfg.Timeout.Duration(),
+		},
 	}
-	log.Printf("Slack webhook URL found: %s", slackURL)
+}
 
-	// Create Slack message
+func (n *SlackNotifier) NotifyLowStock(ctx context.Context, sku string, warehouseID int, stock int) error {
 	message := SlackMessage{
 		Text: "⚠️ Low Stock Alert",
 		Attachments: []Attachment{
@@ -71,7 +91,7 @@ func NotifyLowStock(sku string, warehouseID int, stock int) error {
 					},
 					{
 						Title: "Threshold",
-						Value: "10",
+						Value: fmt.Sprintf("%d", n.threshold),
 						Short: true,
 					},
 				},
@@ -79,42 +99,136 @@ func NotifyLowStock(sku string, warehouseID int, stock int) error {
 			},
 		},
 	}
+	if err := n.send(ctx, message, attribute.String("sku", sku), attribute.Int("warehouse_id", warehouseID)); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "low stock alert sent", "sku", sku, "warehouse_id", warehouseID, "stock", stock)
+	return nil
+}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling Slack message: %v", err)
-		return fmt.Errorf("error marshaling message: %v", err)
+// NotifyNearExpiry alerts that a stocked lot expires soon or has expired.
+func (n *SlackNotifier) NotifyNearExpiry(ctx context.Context, lot models.ExpiringLot) error {
+	warehouses := make([]string, len(lot.WarehouseIDs))
+	for i, id := range lot.WarehouseIDs {
+		warehouses[i] = strconv.Itoa(id)
+	}
+	message := SlackMessage{
+		Text: "⏳ Near Expiry Alert",
+		Attachments: []Attachment{
+			{
+				Color: "warning",
+				Title: "Near Expiry Alert",
+				Text:  "A stocked lot is nearing its expiry date",
+				Fields: []Field{
+					{Title: "SKU", Value: lot.SKU, Short: true},
+					{Title: "Lot", Value: lot.LotNumber, Short: true},
+					{Title: "Expires On", Value: lot.ExpiresOn, Short: true},
+					{Title: "Quantity", Value: strconv.Itoa(lot.Quantity), Short: true},
+					{Title: "Warehouse IDs", Value: strings.Join(warehouses, ", "), Short: false},
+				},
+				Timestamp: time.Now().Unix(),
+			},
+		},
+	}
+	if err := n.send(ctx, message, attribute.String("sku", lot.SKU), attribute.String("lot_number", lot.LotNumber)); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "near expiry alert sent", "sku", lot.SKU, "lot_number", lot.LotNumber, "expires_on", lot.ExpiresOn)
+	return nil
+}
+
+// maxReportLines bounds how many suggestions a replenishment report lists.
+const maxReportLines = 20
+
+// NotifyReplenishment posts the SKUs and warehouses that should be
+// reordered, fewest days of cover first.
+func (n *SlackNotifier) NotifyReplenishment(ctx context.Context, report models.ReplenishmentReport) error {
+	lines := make([]string, 0, maxReportLines+1)
+	for i, r := range report.Suggestions {
+		if i == maxReportLines {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(report.Suggestions)-maxReportLines))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s in warehouse %d: order %d (%.1f days of cover, %d incoming)",
+			r.SKU, r.WarehouseID, r.SuggestedQuantity, r.DaysOfCover, r.Incoming))
+	}
+	settings := report.Settings
+	message := SlackMessage{
+		Text: "📦 Replenishment Report",
+		Attachments: []Attachment{
+			{
+				Color: "good",
+				Title: "Replenishment Report",
+				Text:  strings.Join(lines, "\n"),
+				Fields: []Field{
+					{Title: "Suggestions", Value: strconv.Itoa(len(report.Suggestions)), Short: true},
+					{Title: "Velocity Window", Value: fmt.Sprintf("%d days", settings.WindowDays), Short: true},
+					{Title: "Lead Time", Value: fmt.Sprintf("%d days", settings.LeadTimeDays), Short: true},
+					{Title: "Safety Stock", Value: fmt.Sprintf("%d days", settings.SafetyStockDays), Short: true},
+				},
+				Timestamp: report.GeneratedAt.Unix(),
+			},
+		},
+	}
+	if err := n.send(ctx, message, attribute.Int("suggestions", len(report.Suggestions))); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "replenishment report sent", "suggestions", len(report.Suggestions))
+	return nil
+}
+
+// send posts message to the webhook, tracing the call with attrs.
+func (n *SlackNotifier) send(ctx context.Context, message SlackMessage, attrs ...attribute.KeyValue) (err error) {
+	// The webhook URL is a credential, so only its host is recorded
+	ctx, span := tracing.Start(ctx, "webhook.slack", attrs...)
+	defer func() { tracing.End(span, err) }()
+	if u, parseErr := url.Parse(n.webhookURL); parseErr == nil {
+		span.SetAttributes(attribute.String("server.address", u.Host))
 	}
 
-	log.Printf("Preparing to send Slack notification with payload: %s", string(data))
+	if n.webhookURL == "" {
+		return fmt.Errorf("SLACK_WEBHOOK_URL not set")
+	}
 
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+	// Correlate the alert with the request that caused the stock change
+	requestID := logging.RequestID(ctx)
+	if requestID != "" {
+		message.Attachments[0].Fields = append(message.Attachments[0].Fields, Field{
+			Title: "Request ID",
+			Value: requestID,
+			Short: false,
+		})
 	}
 
-	log.Printf("Sending POST request to Slack webhook URL: %s", slackURL)
-	req, err := http.NewRequest("POST", slackURL, bytes.NewBuffer(data))
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error marshaling message: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", n.webhookURL, bytes.NewBuffer(data))
 	if err != nil {
-		log.Printf("Error creating request: %v", err)
 		return fmt.Errorf("error creating request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 
-	resp, err := client.Do(req)
+	resp, err := n.client.Do(req)
 	if err != nil {
-		log.Printf("Error sending Slack notification: %v", err)
+		// The webhook URL is a credential; keep it out of logs and errors
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = "[REDACTED]"
+		}
 		return fmt.Errorf("error sending request: %v", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	body, _ := io.ReadAll(resp.Body)
-	log.Printf("Slack webhook response - Status: %d, Body: %s", resp.StatusCode, string(body))
-
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Slack notification failed with status: %d", resp.StatusCode)
 		return fmt.Errorf("slack notification failed with status %d: %s", resp.StatusCode, string(body))
 	}
-
-	log.Printf("Slack notification sent successfully")
 	return nil
-} 
\ No newline at end of file
+}
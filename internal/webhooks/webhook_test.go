@@ -1,12 +1,105 @@
 package webhooks
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"omnichannel_inventory/internal/config"
+	"omnichannel_inventory/internal/logging"
+	"omnichannel_inventory/internal/models"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNotifyLowStock(t *testing.T) {
-	err := NotifyLowStock("test", 0)
-	assert.Nil(t, err) // No webhook URL configured
-} 
\ No newline at end of file
+	var received SlackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	notifier := NewSlackNotifier(config.SlackConfig{WebhookURL: config.Secret(server.URL), Timeout: config.Duration(time.Second)}, 10)
+	err := notifier.NotifyLowStock(context.Background(), "test", 1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "Low Stock Alert", received.Attachments[0].Title)
+	assert.Equal(t, "3", received.Attachments[0].Fields[2].Value)
+	assert.Equal(t, "10", received.Attachments[0].Fields[3].Value)
+}
+
+func TestNotifyNearExpiry(t *testing.T) {
+	var received SlackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	notifier := NewSlackNotifier(config.SlackConfig{WebhookURL: config.Secret(server.URL), Timeout: config.Duration(time.Second)}, 10)
+	err := notifier.NotifyNearExpiry(context.Background(), models.ExpiringLot{
+		SKU: "test", LotNumber: "L1", ExpiresOn: "2025-01-31", Quantity: 12, WarehouseIDs: []int{1, 3},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Near Expiry Alert", received.Attachments[0].Title)
+	assert.Equal(t, "L1", received.Attachments[0].Fields[1].Value)
+	assert.Equal(t, "2025-01-31", received.Attachments[0].Fields[2].Value)
+	assert.Equal(t, "1, 3", received.Attachments[0].Fields[4].Value)
+}
+
+func TestNotifyReplenishment(t *testing.T) {
+	var received SlackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	suggestions := make([]models.ReplenishmentSuggestion, maxReportLines+2)
+	for i := range suggestions {
+		suggestions[i] = models.ReplenishmentSuggestion{SKU: "test", WarehouseID: 1, SuggestedQuantity: 40, DaysOfCover: 2.5, Incoming: 10}
+	}
+	notifier := NewSlackNotifier(config.SlackConfig{WebhookURL: config.Secret(server.URL), Timeout: config.Duration(time.Second)}, 10)
+	err := notifier.NotifyReplenishment(context.Background(), models.ReplenishmentReport{
+		Settings:    models.ReplenishmentSettings{WindowDays: 28, LeadTimeDays: 7, SafetyStockDays: 3},
+		Suggestions: suggestions,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Replenishment Report", received.Attachments[0].Title)
+	assert.Equal(t, "22", received.Attachments[0].Fields[0].Value)
+	assert.Contains(t, received.Attachments[0].Text, "test in warehouse 1: order 40 (2.5 days of cover, 10 incoming)")
+	assert.Contains(t, received.Attachments[0].Text, "…and 2 more")
+}
+
+func TestNotifyLowStockCarriesRequestID(t *testing.T) {
+	var received SlackMessage
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Request-ID")
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	notifier := NewSlackNotifier(config.SlackConfig{WebhookURL: config.Secret(server.URL), Timeout: config.Duration(time.Second)}, 10)
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	err := notifier.NotifyLowStock(ctx, "test", 1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "req-1", header)
+	fields := received.Attachments[0].Fields
+	assert.Equal(t, "Request ID", fields[len(fields)-1].Title)
+	assert.Equal(t, "req-1", fields[len(fields)-1].Value)
+}
+
+func TestNotifyLowStockWithoutURL(t *testing.T) {
+	notifier := NewSlackNotifier(config.SlackConfig{Timeout: config.Duration(time.Second)}, 10)
+	err := notifier.NotifyLowStock(context.Background(), "test", 1, 0)
+	assert.NotNil(t, err) // No webhook URL configured
+}
+
+func TestNotifyLowStockRedactsURL(t *testing.T) {
+	secretURL := "http://127.0.0.1:1/services/T000/B000/secret-token"
+	notifier := NewSlackNotifier(config.SlackConfig{WebhookURL: config.Secret(secretURL), Timeout: config.Duration(time.Second)}, 10)
+	err := notifier.NotifyLowStock(context.Background(), "test", 1, 0)
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+}